@@ -1,12 +1,27 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+	"uber-system/pkg/anomaly"
 	"uber-system/pkg/api"
+	"uber-system/pkg/dispatch"
+	"uber-system/pkg/geospatial"
+	"uber-system/pkg/history"
+	"uber-system/pkg/ingest"
 	"uber-system/pkg/manager"
+	"uber-system/pkg/models"
+	"uber-system/pkg/replay"
+	"uber-system/pkg/snapshot"
+	"uber-system/pkg/validation"
 )
 
 func main() {
@@ -23,14 +38,23 @@ func main() {
 		fmt.Printf("Redis address: %s\n", redisAddr)
 	}
 
-	mgr, err := manager.NewDriverManager(
-		18.5204,
-		19.0760,
-		72.8777,
-		72.9982,
-		redisAddr,
-		useRedis,
-	)
+	if carTypes := os.Getenv("CAR_TYPES"); carTypes != "" {
+		validation.KnownCarTypes = validation.ParseCarTypes(carTypes)
+	}
+	fmt.Printf("Car types: %s\n", strings.Join(validation.KnownCarTypes, ", "))
+
+	quadTreeOptions := geospatial.DefaultQuadTreeOptions()
+	quadTreeOptions.MaxCapacity = intFromEnv("QUADTREE_MAX_CAPACITY", quadTreeOptions.MaxCapacity)
+	quadTreeOptions.MaxDepth = intFromEnv("QUADTREE_MAX_DEPTH", quadTreeOptions.MaxDepth)
+	if quadTreeOptions.MaxCapacity <= 0 || quadTreeOptions.MaxDepth <= 0 {
+		log.Fatalf("QUADTREE_MAX_CAPACITY and QUADTREE_MAX_DEPTH must be positive")
+	}
+	geospatial.RegisterIndex("quadtree", func(bounds geospatial.BoundingBox) geospatial.SpatialIndex {
+		return geospatial.NewQuadTreeWithOptions(bounds, quadTreeOptions)
+	})
+	fmt.Printf("QuadTree capacity %d, max depth %d\n", quadTreeOptions.MaxCapacity, quadTreeOptions.MaxDepth)
+
+	mgr, err := manager.NewDriverManager(redisAddr, useRedis)
 
 	if err != nil {
 		log.Fatalf("Failed to initialize manager: %v", err)
@@ -38,26 +62,272 @@ func main() {
 
 	defer mgr.Close()
 
+	anomalyConfig := anomaly.DefaultConfig()
+	anomalyConfig.FlagSpeedKmh = floatFromEnv("ANOMALY_FLAG_SPEED_KMH", anomalyConfig.FlagSpeedKmh)
+	anomalyConfig.RejectSpeedKmh = floatFromEnv("ANOMALY_REJECT_SPEED_KMH", anomalyConfig.RejectSpeedKmh)
+	mgr.SetAnomalyDetector(anomaly.NewDetector(anomalyConfig))
+	fmt.Printf("Anomaly speed limits: flag %.0f km/h, reject %.0f km/h\n", anomalyConfig.FlagSpeedKmh, anomalyConfig.RejectSpeedKmh)
+
+	if boundariesDir := os.Getenv("CITY_BOUNDARIES_DIR"); boundariesDir != "" {
+		cities, err := mgr.GeoRouter().LoadGeoJSONDir(boundariesDir)
+		if err != nil {
+			log.Fatalf("Failed to load city boundaries: %v", err)
+		}
+		fmt.Printf("Loaded %d city boundaries from %s\n", len(cities), boundariesDir)
+	}
+
+	snapshotPath := os.Getenv("SNAPSHOT_PATH")
+	if snapshotPath == "" {
+		snapshotPath = "data/snapshot.bin"
+	}
+	info, report, err := snapshot.Load(mgr, snapshotPath)
+	switch {
+	case os.IsNotExist(err):
+		fmt.Printf("No snapshot at %s, starting empty\n", snapshotPath)
+	case err != nil:
+		log.Fatalf("Failed to restore snapshot: %v", err)
+	default:
+		fmt.Printf("Restored %d drivers from snapshot taken %s (%d rerouted, %d dropped) in %v\n",
+			report.Drivers, info.TakenAt.Format(time.RFC3339), report.Rerouted, len(report.Dropped), info.Duration)
+	}
+	snapshots := snapshot.Start(mgr, snapshotPath, durationFromEnv("SNAPSHOT_INTERVAL", time.Minute))
+
+	// Start the janitor once the restored drivers are in place so its first
+	// sweep sees them instead of racing the restore.
+	janitorConfig := manager.JanitorConfig{
+		StaleAfter: durationFromEnv("DRIVER_STALE_AFTER", 5*time.Minute),
+		EvictAfter: durationFromEnv("DRIVER_EVICT_AFTER", 30*time.Minute),
+		Interval:   durationFromEnv("DRIVER_JANITOR_INTERVAL", 30*time.Second),
+	}
+	mgr.StartJanitor(janitorConfig)
+	fmt.Printf("Stale driver TTL: %v (evict after %v)\n", janitorConfig.StaleAfter, janitorConfig.EvictAfter)
+
+	adminHandler := api.NewAdminHandler(mgr, snapshots)
+
+	mgr.Subscribe(func(event models.DriverEvent) {
+		switch event.Type {
+		case models.EventDriverRemoved:
+			log.Printf("Driver %s removed from %s", event.DriverID, event.City)
+		case models.EventDriverEvicted:
+			log.Printf("Driver %s evicted from %s after missing heartbeats", event.DriverID, event.City)
+		}
+	})
+
+	historyDir := os.Getenv("HISTORY_DIR")
+	if historyDir == "" {
+		historyDir = "data/history"
+	}
+	historyStore, err := history.Open(history.Config{
+		Dir:       historyDir,
+		Partition: durationFromEnv("HISTORY_PARTITION", time.Hour),
+		Retention: durationFromEnv("HISTORY_RETENTION", 7*24*time.Hour),
+	})
+	if err != nil {
+		log.Fatalf("Failed to open location history: %v", err)
+	}
+	defer historyStore.Close()
+	mgr.Subscribe(historyStore.HandleEvent)
+	fmt.Printf("Location history: %s\n", historyDir)
+
 	handler := api.NewHandler(mgr)
+	handler.SetHistoryStore(historyStore)
+
+	ingestMode, err := ingest.ParseMode(os.Getenv("INGEST_MODE"))
+	if err != nil {
+		log.Fatalf("Invalid INGEST_MODE: %v", err)
+	}
+	ingestConfig := ingest.Config{
+		Mode:    ingestMode,
+		LogDir:  os.Getenv("LOCATION_LOG_DIR"),
+		LogSync: os.Getenv("LOCATION_LOG_SYNC") == "true",
+		Kafka: ingest.KafkaConfig{
+			Topic:              os.Getenv("KAFKA_TOPIC"),
+			GroupID:            os.Getenv("KAFKA_GROUP"),
+			WriterBatchTimeout: durationFromEnv("KAFKA_WRITER_BATCH_TIMEOUT", 0),
+		},
+	}
+	if ingestConfig.LogDir == "" {
+		ingestConfig.LogDir = "data/stream"
+	}
+	if brokers := os.Getenv("KAFKA_BROKERS"); brokers != "" {
+		ingestConfig.Kafka.Brokers = strings.Split(brokers, ",")
+	}
+	if source := os.Getenv("REPLAY_SOURCE"); source != "" {
+		replayIndexes(mgr, source, ingestConfig.LogDir, historyStore, useRedis)
+	}
+
+	publisher, err := ingest.Open(ingestConfig, mgr)
+	if err != nil {
+		log.Fatalf("Failed to start %s ingestion: %v", ingestMode, err)
+	}
+	if publisher != nil {
+		defer publisher.Close()
+		handler.SetPublisher(publisher)
+	}
+	fmt.Printf("Location ingestion: %s\n", ingestMode)
+
+	dispatchConfig := dispatch.DefaultConfig()
+	dispatchConfig.OfferTimeout = durationFromEnv("DISPATCH_OFFER_TIMEOUT", dispatchConfig.OfferTimeout)
+	dispatchConfig.BatchWindow = durationFromEnv("DISPATCH_BATCH_WINDOW", dispatchConfig.BatchWindow)
+	dispatchConfig.TripTTL = durationFromEnv("DISPATCH_TRIP_TTL", dispatchConfig.TripTTL)
+	if mode := os.Getenv("DISPATCH_MODE"); mode != "" {
+		dispatchConfig.Mode = dispatch.Mode(mode)
+		if !dispatchConfig.Mode.IsValid() {
+			log.Fatalf("Invalid DISPATCH_MODE %q: want %s or %s", mode, dispatch.ModeGreedy, dispatch.ModeBatch)
+		}
+	}
+	matcher := dispatch.NewMatcher(mgr, dispatchConfig)
+	defer matcher.Close()
+	fmt.Printf("Dispatch mode: %s\n", matcher.Mode())
+	rideHandler := api.NewRideHandler(matcher)
 
 	http.HandleFunc("/drivers", handler.AddDriver)
+	http.HandleFunc("/drivers/", handler.DriverByID)
 	http.HandleFunc("/drivers/location", handler.UpdateLocation)
+	http.HandleFunc("/drivers/locations:batch", handler.BatchUpdateLocations)
 	http.HandleFunc("/drivers/status", handler.UpdateStatus)
 	http.HandleFunc("/drivers/search", handler.SearchDrivers)
+	http.HandleFunc("/drivers/nearest", handler.FindNearest)
 	http.HandleFunc("/drivers/compare", handler.CompareIndexes)
+	http.HandleFunc("/rides", rideHandler.RequestRide)
+	http.HandleFunc("/rides/", rideHandler.RideByID)
+	http.HandleFunc("/rides/stats", rideHandler.GetStats)
+	http.HandleFunc("/anomalies", handler.GetAnomalies)
 	http.HandleFunc("/stats", handler.GetStats)
 	http.HandleFunc("/health", handler.Health)
+	http.HandleFunc("/admin/snapshot", adminHandler.Snapshot)
+	http.HandleFunc("/admin/restore", adminHandler.Restore)
+	http.HandleFunc("/admin/rebuild", adminHandler.Rebuild)
 
 	fmt.Println("\nServer starting on :8080")
 	fmt.Println("\nAvailable endpoints:")
 	fmt.Println("  POST   /drivers              - Add new driver")
+	fmt.Println("  DELETE /drivers/{id}         - Remove driver")
+	fmt.Println("  GET    /drivers/{id}/status-history - Driver status transitions")
+	fmt.Println("  GET    /drivers/{id}/history - Location history (?from=&to=)")
+	fmt.Println("  GET    /drivers/{id}/at      - Location at a point in time (?ts=)")
 	fmt.Println("  PUT    /drivers/location     - Update driver location")
+	fmt.Println("  POST   /drivers/locations:batch - Bulk location updates (JSON array or NDJSON)")
 	fmt.Println("  PUT    /drivers/status       - Update driver status")
 	fmt.Println("  POST   /drivers/search       - Search nearby drivers")
+	fmt.Println("  POST   /drivers/nearest      - Find k nearest drivers")
 	fmt.Println("  POST   /drivers/compare      - Compare all indexes")
+	fmt.Println("  POST   /rides                - Request a ride")
+	fmt.Println("  GET    /rides/{id}           - Get trip status")
+	fmt.Println("  POST   /rides/{id}/accept    - Driver accepts offer")
+	fmt.Println("  POST   /rides/{id}/decline   - Driver declines offer")
+	fmt.Println("  GET    /rides/stats          - Dispatch statistics")
+	fmt.Println("  GET    /anomalies            - Flagged location anomalies")
 	fmt.Println("  GET    /stats                - Get system statistics")
 	fmt.Println("  GET    /health               - Health check")
+	fmt.Println("  GET    /admin/snapshot       - Show the last snapshot taken")
+	fmt.Println("  POST   /admin/snapshot       - Write a snapshot of driver state")
+	fmt.Println("  POST   /admin/restore        - Restore driver state from the snapshot")
+	fmt.Println("  POST   /admin/rebuild        - Rebuild a spatial index without blocking searches (?index=)")
 	fmt.Println("\nPress Ctrl+C to stop")
 
-	log.Fatal(http.ListenAndServe(":8080", nil))
+	server := &http.Server{Addr: ":8080"}
+	go func() {
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Fatal(err)
+		}
+	}()
+
+	// Shut down on a signal so the deferred closes flush the location
+	// history and ingestion log that a later replay depends on.
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	<-signals
+	fmt.Println("\nShutting down")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		log.Printf("Server shutdown error: %v", err)
+	}
+
+	snapshots.Stop()
+	if info, err := snapshots.Save(); err != nil {
+		log.Printf("Final snapshot failed: %v", err)
+	} else {
+		fmt.Printf("Wrote snapshot of %d drivers to %s\n", info.Drivers, info.Path)
+	}
+}
+
+func replayIndexes(mgr *manager.DriverManager, sourceName, logDir string, historyStore *history.Store, checkRedis bool) {
+	source, err := replay.ParseSource(sourceName)
+	if err != nil {
+		log.Fatalf("Invalid REPLAY_SOURCE: %v", err)
+	}
+
+	options := replay.Options{
+		Progress: func(progress replay.Progress) {
+			fmt.Println(progress)
+		},
+	}
+	if value := os.Getenv("REPLAY_FROM"); value != "" {
+		if options.From, err = time.Parse(time.RFC3339Nano, value); err != nil {
+			log.Fatalf("Invalid REPLAY_FROM: %v", err)
+		}
+	}
+	if value := os.Getenv("REPLAY_FROM_OFFSET"); value != "" {
+		if options.FromOffset, err = strconv.ParseInt(value, 10, 64); err != nil {
+			log.Fatalf("Invalid REPLAY_FROM_OFFSET: %v", err)
+		}
+	}
+
+	if source == replay.SourceHistory {
+		_, err = replay.FromHistory(mgr, historyStore, options)
+	} else {
+		_, err = replay.Run(mgr, source, logDir, options)
+	}
+	if err != nil {
+		log.Fatalf("Failed to replay %s: %v", source, err)
+	}
+
+	if !checkRedis {
+		return
+	}
+	report, err := mgr.CheckRedisConsistency(0.005)
+	if err != nil {
+		log.Printf("Redis consistency check failed: %v", err)
+		return
+	}
+	fmt.Printf("Redis consistency: %v\n", report)
+}
+
+func durationFromEnv(key string, fallback time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		log.Fatalf("Invalid %s: %v", key, err)
+	}
+	return duration
+}
+
+func intFromEnv(key string, fallback int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+	parsed, err := strconv.Atoi(value)
+	if err != nil {
+		log.Fatalf("Invalid %s: %v", key, err)
+	}
+	return parsed
+}
+
+func floatFromEnv(key string, fallback float64) float64 {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+	parsed, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		log.Fatalf("Invalid %s: %v", key, err)
+	}
+	return parsed
 }
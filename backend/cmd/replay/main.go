@@ -0,0 +1,101 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+	"uber-system/pkg/manager"
+	"uber-system/pkg/replay"
+	"uber-system/pkg/snapshot"
+)
+
+func main() {
+	sourceFlag := flag.String("source", "log", "what to replay: log or history")
+	dir := flag.String("dir", "", "directory of the ingestion log or location history (default data/stream or data/history)")
+	fromOffset := flag.Int64("from-offset", 0, "first offset to replay in every log partition")
+	from := flag.String("from", "", "only replay positions recorded at or after this RFC 3339 time")
+	to := flag.String("to", "", "only replay positions recorded at or before this RFC 3339 time")
+	boundaries := flag.String("boundaries", os.Getenv("CITY_BOUNDARIES_DIR"), "directory of GeoJSON city boundaries")
+	redisAddr := flag.String("redis", "", "Redis address for driver metadata and the consistency check")
+	tolerance := flag.Float64("tolerance-m", 5, "distance in metres beyond which a Redis position counts as mismatched")
+	progressEvery := flag.Int("progress-every", replay.DefaultProgressEvery, "report progress every N records")
+	snapshotPath := flag.String("snapshot", "", "write the rebuilt state to this snapshot file, for a server to load with SNAPSHOT_PATH")
+	flag.Parse()
+
+	source, err := replay.ParseSource(*sourceFlag)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *dir == "" {
+		*dir = "data/stream"
+		if source == replay.SourceHistory {
+			*dir = "data/history"
+		}
+	}
+
+	options := replay.Options{
+		FromOffset:    *fromOffset,
+		ProgressEvery: *progressEvery,
+		Progress: func(progress replay.Progress) {
+			fmt.Println(progress)
+		},
+	}
+	if options.From, err = parseTime(*from); err != nil {
+		log.Fatalf("Invalid -from: %v", err)
+	}
+	if options.To, err = parseTime(*to); err != nil {
+		log.Fatalf("Invalid -to: %v", err)
+	}
+
+	mgr, err := manager.NewDriverManager(*redisAddr, *redisAddr != "")
+	if err != nil {
+		log.Fatalf("Failed to initialize manager: %v", err)
+	}
+	defer mgr.Close()
+
+	if *boundaries != "" {
+		if _, err := mgr.GeoRouter().LoadGeoJSONDir(*boundaries); err != nil {
+			log.Fatalf("Failed to load city boundaries: %v", err)
+		}
+	}
+
+	if _, err := replay.Run(mgr, source, *dir, options); err != nil {
+		log.Fatalf("Replay failed: %v", err)
+	}
+
+	stats := mgr.GetStats()
+	fmt.Printf("Rebuilt %v drivers\n", stats["total_drivers"])
+
+	if *snapshotPath != "" {
+		info, err := snapshot.Save(mgr, *snapshotPath)
+		if err != nil {
+			log.Fatalf("Failed to write snapshot: %v", err)
+		}
+		fmt.Printf("Wrote snapshot of %d drivers in %d cities to %s (%d bytes)\n", info.Drivers, info.Cities, info.Path, info.Bytes)
+	}
+
+	if *redisAddr == "" {
+		return
+	}
+	report, err := mgr.CheckRedisConsistency(*tolerance / 1000)
+	if err != nil {
+		log.Fatalf("Consistency check failed: %v", err)
+	}
+	fmt.Println(report)
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(report)
+	if !report.Consistent {
+		os.Exit(2)
+	}
+}
+
+func parseTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339Nano, value)
+}
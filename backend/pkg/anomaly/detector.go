@@ -0,0 +1,310 @@
+package anomaly
+
+import (
+	"hash/fnv"
+	"sync"
+	"time"
+	"uber-system/pkg/geospatial"
+	"uber-system/pkg/models"
+)
+
+type Action string
+
+const (
+	ActionAllow  Action = "allow"
+	ActionFlag   Action = "flag"
+	ActionReject Action = "reject"
+)
+
+type Kind string
+
+const (
+	KindSpeed       Kind = "speed"
+	KindOscillation Kind = "oscillation"
+)
+
+type Config struct {
+	// FlagSpeedKmh and RejectSpeedKmh bound the speed implied by two
+	// consecutive updates; zero disables the check.
+	FlagSpeedKmh   float64
+	RejectSpeedKmh float64
+	// MinElapsed floors the time between updates so back-to-back samples
+	// do not imply infinite speed.
+	MinElapsed time.Duration
+	// A jump of at least OscillationJumpKm that returns within
+	// OscillationReturnKm of an earlier fix inside OscillationWindow is
+	// treated as a spoofed position bouncing between two locations.
+	OscillationJumpKm   float64
+	OscillationReturnKm float64
+	OscillationWindow   time.Duration
+	MaxEvents           int
+}
+
+func DefaultConfig() Config {
+	return Config{
+		FlagSpeedKmh:        180,
+		RejectSpeedKmh:      400,
+		MinElapsed:          time.Second,
+		OscillationJumpKm:   1,
+		OscillationReturnKm: 0.1,
+		OscillationWindow:   2 * time.Minute,
+		MaxEvents:           1000,
+	}
+}
+
+type Event struct {
+	DriverID   string          `json:"driver_id"`
+	Kind       Kind            `json:"kind"`
+	Action     Action          `json:"action"`
+	SpeedKmh   float64         `json:"speed_kmh"`
+	DistanceKm float64         `json:"distance_km"`
+	Elapsed    float64         `json:"elapsed_seconds"`
+	From       models.Location `json:"from"`
+	To         models.Location `json:"to"`
+	Timestamp  time.Time       `json:"timestamp"`
+}
+
+// Sample is an incoming position to evaluate.
+type Sample struct {
+	Location models.Location
+	// At is when the position was received. It orders the driver's history,
+	// so every sample for a driver must be stamped by the same clock as
+	// driver.LocationUpdatedAt.
+	At time.Time
+	// Elapsed, when positive, replaces At minus driver.LocationUpdatedAt as
+	// the time taken to cover the distance, for callers with a more accurate
+	// measure such as two device clocks.
+	Elapsed time.Duration
+	// Pending holds positions accepted earlier in the same batch that have
+	// not been committed yet, oldest first. Only the last MaxHistory matter.
+	Pending []Fix
+}
+
+type Verdict struct {
+	Action Action
+	Events []Event
+	// Fixes are the positions to Commit once the sample has been applied:
+	// the driver's last known position if the detector had no history for
+	// it, then the sample itself.
+	Fixes []Fix
+}
+
+type Fix struct {
+	Location models.Location
+	At       time.Time
+}
+
+const recentShardCount = 64
+
+// MaxHistory is how many of a driver's latest fixes the detector keeps and
+// compares a new position against.
+const MaxHistory = 3
+
+// recentShard holds the last accepted fixes for a slice of the driver ID
+// space. Evaluate and Commit run under the caller's driver shard lock, so they
+// only lock
+// the driver's own shard here and leaves unrelated drivers free to proceed.
+type recentShard struct {
+	fixes map[string][]Fix
+	mu    sync.Mutex
+}
+
+// Detector's mu guards only the event log and counters, which are touched
+// when an anomaly is found rather than on every update.
+type Detector struct {
+	config   Config
+	recent   [recentShardCount]*recentShard
+	events   []Event
+	next     int
+	flagged  int
+	rejected int
+	mu       sync.Mutex
+}
+
+func NewDetector(config Config) *Detector {
+	if config.MaxEvents <= 0 {
+		config.MaxEvents = DefaultConfig().MaxEvents
+	}
+	d := &Detector{
+		config: config,
+		events: make([]Event, 0, config.MaxEvents),
+	}
+	for i := range d.recent {
+		d.recent[i] = &recentShard{fixes: make(map[string][]Fix)}
+	}
+	return d
+}
+
+func (d *Detector) shardFor(driverID string) *recentShard {
+	hash := fnv.New32a()
+	hash.Write([]byte(driverID))
+	return d.recent[hash.Sum32()%recentShardCount]
+}
+
+// Evaluate compares an incoming position against the driver's previous one
+// and reports any anomalies without changing the detector. Callers Record the
+// events of a rejected verdict and, once the position has actually been
+// applied, Record the events of an accepted one and Commit its Fixes, so a
+// position that never took effect is not measured against later.
+func (d *Detector) Evaluate(driver models.Driver, sample Sample) Verdict {
+	to := sample.Location
+	located := driver.LocationUpdatedAt
+	verdict := Verdict{Action: ActionAllow}
+
+	elapsed := sample.Elapsed
+	if elapsed <= 0 {
+		elapsed = sample.At.Sub(located)
+	}
+	if elapsed < d.config.MinElapsed {
+		elapsed = d.config.MinElapsed
+	}
+	distance := geospatial.Haversine(driver.Location.Lat, driver.Location.Lng, to.Lat, to.Lng)
+	speed := 0.0
+	if elapsed > 0 {
+		speed = distance / elapsed.Hours()
+	}
+
+	event := Event{
+		DriverID:   driver.ID,
+		SpeedKmh:   speed,
+		DistanceKm: distance,
+		Elapsed:    elapsed.Seconds(),
+		From:       driver.Location,
+		To:         to,
+		Timestamp:  sample.At,
+	}
+
+	if !located.IsZero() {
+		switch {
+		case d.config.RejectSpeedKmh > 0 && speed >= d.config.RejectSpeedKmh:
+			event.Kind, event.Action = KindSpeed, ActionReject
+			verdict.Events = append(verdict.Events, event)
+		case d.config.FlagSpeedKmh > 0 && speed >= d.config.FlagSpeedKmh:
+			event.Kind, event.Action = KindSpeed, ActionFlag
+			verdict.Events = append(verdict.Events, event)
+		}
+	}
+
+	history := append(d.history(driver.ID), sample.Pending...)
+	if len(history) > MaxHistory {
+		history = history[len(history)-MaxHistory:]
+	}
+	if len(history) == 0 && !located.IsZero() {
+		history = append(history, Fix{Location: driver.Location, At: located})
+		verdict.Fixes = append(verdict.Fixes, history[0])
+	}
+	verdict.Fixes = append(verdict.Fixes, Fix{Location: to, At: sample.At})
+	if d.oscillates(history, driver.Location, to, sample.At) {
+		event.Kind, event.Action = KindOscillation, ActionFlag
+		verdict.Events = append(verdict.Events, event)
+	}
+
+	for _, e := range verdict.Events {
+		if e.Action == ActionReject {
+			verdict.Action = ActionReject
+		} else if verdict.Action == ActionAllow {
+			verdict.Action = ActionFlag
+		}
+	}
+	return verdict
+}
+
+func (d *Detector) history(driverID string) []Fix {
+	shard := d.shardFor(driverID)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+	return append([]Fix(nil), shard.fixes[driverID]...)
+}
+
+// Commit remembers fixes, oldest first, as the driver's latest applied
+// positions.
+func (d *Detector) Commit(driverID string, fixes ...Fix) {
+	shard := d.shardFor(driverID)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+
+	history := append(shard.fixes[driverID], fixes...)
+	if len(history) > MaxHistory {
+		history = history[len(history)-MaxHistory:]
+	}
+	shard.fixes[driverID] = history
+}
+
+func (d *Detector) oscillates(history []Fix, from, to models.Location, now time.Time) bool {
+	if d.config.OscillationJumpKm <= 0 || len(history) < 2 {
+		return false
+	}
+	if geospatial.Haversine(from.Lat, from.Lng, to.Lat, to.Lng) < d.config.OscillationJumpKm {
+		return false
+	}
+	for _, earlier := range history[:len(history)-1] {
+		if now.Sub(earlier.At) > d.config.OscillationWindow {
+			continue
+		}
+		if geospatial.Haversine(earlier.Location.Lat, earlier.Location.Lng, to.Lat, to.Lng) <= d.config.OscillationReturnKm {
+			return true
+		}
+	}
+	return false
+}
+
+// Record adds events to the event log and counters.
+func (d *Detector) Record(events []Event) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for _, event := range events {
+		if event.Action == ActionReject {
+			d.rejected++
+		} else {
+			d.flagged++
+		}
+		if len(d.events) < d.config.MaxEvents {
+			d.events = append(d.events, event)
+			continue
+		}
+		d.events[d.next] = event
+		d.next = (d.next + 1) % d.config.MaxEvents
+	}
+}
+
+func (d *Detector) Forget(driverID string) {
+	shard := d.shardFor(driverID)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+	delete(shard.fixes, driverID)
+}
+
+// Events returns recorded anomalies, newest first. An empty driverID matches
+// every driver and a non-positive limit returns everything retained.
+func (d *Detector) Events(driverID string, since time.Time, limit int) []Event {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	results := make([]Event, 0)
+	for i := len(d.events) - 1; i >= 0; i-- {
+		event := d.events[(d.next+i)%len(d.events)]
+		if driverID != "" && event.DriverID != driverID {
+			continue
+		}
+		if event.Timestamp.Before(since) {
+			continue
+		}
+		results = append(results, event)
+		if limit > 0 && len(results) >= limit {
+			break
+		}
+	}
+	return results
+}
+
+func (d *Detector) Stats() map[string]interface{} {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return map[string]interface{}{
+		"flagged":  d.flagged,
+		"rejected": d.rejected,
+		"retained": len(d.events),
+	}
+}
@@ -0,0 +1,200 @@
+package anomaly
+
+import (
+	"testing"
+	"time"
+	"uber-system/pkg/models"
+)
+
+var (
+	testStart = time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	home      = models.Location{Lat: 12.9700, Lng: 77.5900}
+)
+
+// north returns a location about km kilometres north of home.
+func north(km float64) models.Location {
+	return models.Location{Lat: home.Lat + km/111.2, Lng: home.Lng}
+}
+
+func driverAt(location models.Location, at time.Time) models.Driver {
+	return models.Driver{ID: "driver-1", Location: location, LocationUpdatedAt: at}
+}
+
+func kinds(verdict Verdict) []Kind {
+	var kinds []Kind
+	for _, event := range verdict.Events {
+		kinds = append(kinds, event.Kind)
+	}
+	return kinds
+}
+
+func TestEvaluateSpeed(t *testing.T) {
+	tests := []struct {
+		name    string
+		located time.Time
+		to      models.Location
+		elapsed time.Duration
+		action  Action
+	}{
+		{"first fix", time.Time{}, north(50), 0, ActionAllow},
+		{"city traffic", testStart.Add(-time.Minute), north(0.5), 0, ActionAllow},
+		{"flagged", testStart.Add(-10 * time.Second), north(0.7), 0, ActionFlag},
+		{"rejected", testStart.Add(-10 * time.Second), north(2), 0, ActionReject},
+		{"back to back", testStart, north(0.2), 0, ActionReject},
+		{"device clocks", testStart.Add(-time.Second), north(1), time.Minute, ActionAllow},
+	}
+
+	d := NewDetector(DefaultConfig())
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			verdict := d.Evaluate(driverAt(home, tt.located), Sample{Location: tt.to, At: testStart, Elapsed: tt.elapsed})
+			if verdict.Action != tt.action {
+				t.Fatalf("action = %s (%v), want %s", verdict.Action, verdict.Events, tt.action)
+			}
+			if tt.action == ActionAllow {
+				if len(verdict.Events) != 0 {
+					t.Fatalf("events = %v, want none", verdict.Events)
+				}
+				return
+			}
+			if len(verdict.Events) != 1 || verdict.Events[0].Kind != KindSpeed || verdict.Events[0].Action != tt.action {
+				t.Fatalf("events = %+v, want one %s speed event", verdict.Events, tt.action)
+			}
+		})
+	}
+}
+
+func TestEvaluateOscillation(t *testing.T) {
+	tests := []struct {
+		name    string
+		back    time.Duration
+		to      models.Location
+		pending bool
+		kinds   []Kind
+	}{
+		{"returns within window", time.Minute, north(0.05), false, []Kind{KindOscillation}},
+		{"returns within window from pending", time.Minute, north(0.05), true, []Kind{KindOscillation}},
+		{"returns after window", 3 * time.Minute, north(0.05), false, nil},
+		{"moves elsewhere", time.Minute, north(4), false, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := NewDetector(DefaultConfig())
+			away := north(2)
+			arrived := testStart.Add(tt.back)
+			fixes := []Fix{{Location: home, At: testStart}, {Location: away, At: arrived}}
+			sample := Sample{Location: tt.to, At: arrived.Add(time.Minute)}
+			if tt.pending {
+				sample.Pending = fixes
+			} else {
+				for _, fix := range fixes {
+					d.Commit("driver-1", fix)
+				}
+			}
+
+			verdict := d.Evaluate(driverAt(away, arrived), sample)
+			got := kinds(verdict)
+			if len(got) != len(tt.kinds) || (len(got) > 0 && got[0] != tt.kinds[0]) {
+				t.Fatalf("events = %+v, want kinds %v", verdict.Events, tt.kinds)
+			}
+			if len(got) > 0 && verdict.Action != ActionFlag {
+				t.Fatalf("action = %s, want %s", verdict.Action, ActionFlag)
+			}
+		})
+	}
+}
+
+func TestEvaluateKeepsOnlyRecentPending(t *testing.T) {
+	d := NewDetector(DefaultConfig())
+	// home is MaxHistory+1 fixes back, so a sequence of single updates would
+	// already have forgotten it; a batch must not remember it either.
+	pending := []Fix{{Location: home, At: testStart}}
+	for i := 0; i < MaxHistory; i++ {
+		pending = append(pending, Fix{Location: north(2 + float64(i)*0.01), At: testStart.Add(time.Duration(i+1) * time.Second)})
+	}
+	last := pending[len(pending)-1]
+	verdict := d.Evaluate(driverAt(last.Location, last.At), Sample{Location: home, At: last.At.Add(time.Minute), Pending: pending})
+	if got := kinds(verdict); len(got) != 0 {
+		t.Fatalf("events = %+v, want none", verdict.Events)
+	}
+
+	verdict = d.Evaluate(driverAt(last.Location, last.At), Sample{Location: home, At: last.At.Add(time.Minute), Pending: pending[:MaxHistory]})
+	if got := kinds(verdict); len(got) != 1 || got[0] != KindOscillation {
+		t.Fatalf("events = %+v, want an oscillation", verdict.Events)
+	}
+}
+
+func TestEvaluateSeedsHistoryFromLastLocation(t *testing.T) {
+	d := NewDetector(DefaultConfig())
+	away := north(2)
+	// The detector has no history yet, so the record's position is kept
+	// along with the new one.
+	verdict := d.Evaluate(driverAt(home, testStart), Sample{Location: away, At: testStart.Add(time.Minute)})
+	if len(verdict.Events) != 0 {
+		t.Fatalf("events = %+v, want none", verdict.Events)
+	}
+	if len(verdict.Fixes) != 2 || verdict.Fixes[0].Location != home || verdict.Fixes[1].Location != away {
+		t.Fatalf("fixes = %+v, want home then away", verdict.Fixes)
+	}
+	d.Commit("driver-1", verdict.Fixes...)
+	verdict = d.Evaluate(driverAt(away, testStart.Add(time.Minute)), Sample{Location: home, At: testStart.Add(2 * time.Minute)})
+	if got := kinds(verdict); len(got) != 1 || got[0] != KindOscillation {
+		t.Fatalf("events = %+v, want an oscillation", verdict.Events)
+	}
+}
+
+func TestEvaluateDoesNotChangeDetector(t *testing.T) {
+	d := NewDetector(DefaultConfig())
+	driver := driverAt(home, testStart.Add(-10*time.Second))
+	sample := Sample{Location: north(2), At: testStart}
+
+	first := d.Evaluate(driver, sample)
+	second := d.Evaluate(driver, sample)
+	if first.Action != ActionReject || second.Action != ActionReject {
+		t.Fatalf("actions = %s, %s, want reject twice", first.Action, second.Action)
+	}
+	if history := d.history("driver-1"); len(history) != 0 {
+		t.Fatalf("history = %+v after Evaluate, want empty", history)
+	}
+	if events := d.Events("", time.Time{}, 0); len(events) != 0 {
+		t.Fatalf("events = %+v after Evaluate, want none", events)
+	}
+
+	d.Record(first.Events)
+	stats := d.Stats()
+	if stats["rejected"] != 1 || stats["flagged"] != 0 {
+		t.Fatalf("stats = %v, want one rejection", stats)
+	}
+}
+
+func TestCommitKeepsRecentFixes(t *testing.T) {
+	d := NewDetector(DefaultConfig())
+	for i := 0; i < 5; i++ {
+		d.Commit("driver-1", Fix{Location: north(float64(i)), At: testStart.Add(time.Duration(i) * time.Minute)})
+	}
+	history := d.history("driver-1")
+	if len(history) != MaxHistory || history[0].Location != north(2) || history[MaxHistory-1].Location != north(4) {
+		t.Fatalf("history = %+v, want the last %d fixes", history, MaxHistory)
+	}
+
+	d.Forget("driver-1")
+	if history := d.history("driver-1"); len(history) != 0 {
+		t.Fatalf("history after Forget = %+v", history)
+	}
+}
+
+func TestEvaluateStampsFixesWithSampleClock(t *testing.T) {
+	d := NewDetector(DefaultConfig())
+	d.Commit("driver-1", Fix{Location: home, At: testStart})
+	// Device clocks say a minute passed; the server received both fixes a
+	// second apart. Speed uses the device clocks, history the server's.
+	received := testStart.Add(time.Second)
+	verdict := d.Evaluate(driverAt(home, testStart), Sample{Location: north(1), At: received, Elapsed: time.Minute})
+	if verdict.Action != ActionAllow {
+		t.Fatalf("action = %s (%+v), want allow", verdict.Action, verdict.Events)
+	}
+	if len(verdict.Fixes) != 1 || !verdict.Fixes[0].At.Equal(received) {
+		t.Fatalf("fixes = %+v, want one stamped %v", verdict.Fixes, received)
+	}
+}
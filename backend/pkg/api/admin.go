@@ -0,0 +1,110 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"uber-system/pkg/manager"
+	"uber-system/pkg/snapshot"
+)
+
+type AdminHandler struct {
+	manager   *manager.DriverManager
+	snapshots *snapshot.Scheduler
+}
+
+func NewAdminHandler(mgr *manager.DriverManager, snapshots *snapshot.Scheduler) *AdminHandler {
+	return &AdminHandler{manager: mgr, snapshots: snapshots}
+}
+
+type snapshotResponse struct {
+	snapshot.Info
+	Duration string                 `json:"duration"`
+	Restored *manager.RestoreReport `json:"restored,omitempty"`
+}
+
+// Snapshot writes the in-memory driver state to the configured snapshot file
+// on POST, and reports the last snapshot taken on GET.
+func (h *AdminHandler) Snapshot(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(h.snapshots.Stats())
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	info, err := h.snapshots.Save()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(snapshotResponse{Info: info, Duration: info.Duration.String()})
+}
+
+// Restore replaces the in-memory driver state with the configured snapshot
+// file. Redis is not rewritten.
+func (h *AdminHandler) Restore(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	info, report, err := h.snapshots.Restore()
+	if err != nil {
+		status := http.StatusInternalServerError
+		switch {
+		case os.IsNotExist(err):
+			status = http.StatusNotFound
+		case errors.Is(err, snapshot.ErrCorrupt):
+			status = http.StatusUnprocessableEntity
+		}
+		writeError(w, status, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(snapshotResponse{Info: info, Duration: info.Duration.String(), Restored: &report})
+}
+
+type rebuildResponse struct {
+	manager.RebuildReport
+	Duration string `json:"duration"`
+	Paused   string `json:"paused"`
+}
+
+// Rebuild rebuilds one spatial index for every city, ?index=quadtree by
+// default, and swaps it in without blocking searches.
+func (h *AdminHandler) Rebuild(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	indexType := manager.IndexTypeQuadTree
+	if value := r.URL.Query().Get("index"); value != "" {
+		indexType = manager.IndexType(value)
+	}
+
+	report, err := h.manager.RebuildIndex(indexType)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, manager.ErrUnknownIndex) {
+			status = http.StatusBadRequest
+		}
+		writeError(w, status, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rebuildResponse{
+		RebuildReport: report,
+		Duration:      report.Duration.String(),
+		Paused:        report.Paused.String(),
+	})
+}
@@ -0,0 +1,191 @@
+package api
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"uber-system/pkg/manager"
+	"uber-system/pkg/models"
+	"uber-system/pkg/validation"
+)
+
+const (
+	MaxBatchUpdates   = 10000
+	maxBatchBodyBytes = 8 << 20
+)
+
+var errBatchTooLarge = fmt.Errorf("batch exceeds %d updates", MaxBatchUpdates)
+
+type batchItemResult struct {
+	Index    int                     `json:"index"`
+	DriverID string                  `json:"driver_id"`
+	Status   int                     `json:"status"`
+	Outcome  models.UpdateOutcome    `json:"outcome,omitempty"`
+	Error    string                  `json:"error,omitempty"`
+	Fields   []validation.FieldError `json:"fields,omitempty"`
+}
+
+// BatchUpdateLocations accepts either a JSON array of location updates or an
+// NDJSON stream (one update per line) and reports a result for every item.
+func (h *Handler) BatchUpdateLocations(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	reqs, err := decodeLocationBatch(http.MaxBytesReader(w, r.Body, maxBatchBodyBytes), r.Header.Get("Content-Type"))
+	if err != nil {
+		status := http.StatusBadRequest
+		var tooLarge *http.MaxBytesError
+		if errors.Is(err, errBatchTooLarge) || errors.As(err, &tooLarge) {
+			status = http.StatusRequestEntityTooLarge
+		}
+		writeError(w, status, err)
+		return
+	}
+
+	counts := make(map[string]int)
+	items := make([]batchItemResult, len(reqs))
+	if h.publisher != nil {
+		for i, req := range reqs {
+			item := batchItemResult{
+				Index:    i,
+				DriverID: validation.NormalizeID(req.DriverID),
+				Status:   http.StatusAccepted,
+			}
+			if _, err := h.publishLocation(r.Context(), req); err != nil {
+				item.Status = publishErrorStatus(err)
+				item.setError(err)
+				counts["failed"]++
+			} else {
+				counts["accepted"]++
+			}
+			items[i] = item
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"total":    len(reqs),
+			"accepted": counts["accepted"],
+			"failed":   counts["failed"],
+			"results":  items,
+		})
+		return
+	}
+
+	for i, result := range h.manager.ApplyLocationUpdates(reqs) {
+		item := batchItemResult{
+			Index:    i,
+			DriverID: result.DriverID,
+			Status:   http.StatusOK,
+			Outcome:  result.Outcome,
+		}
+		if result.Err != nil {
+			item.Status = updateErrorStatus(result.Err)
+			item.setError(result.Err)
+			counts["failed"]++
+		} else {
+			counts[string(result.Outcome)]++
+		}
+		items[i] = item
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"total":     len(reqs),
+		"applied":   counts[string(models.UpdateApplied)],
+		"duplicate": counts[string(models.UpdateDuplicate)],
+		"stale":     counts[string(models.UpdateStale)],
+		"failed":    counts["failed"],
+		"results":   items,
+	})
+}
+
+func (item *batchItemResult) setError(err error) {
+	item.Error = err.Error()
+	var fieldErrs validation.Errors
+	if errors.As(err, &fieldErrs) {
+		item.Error = "validation failed"
+		item.Fields = fieldErrs
+	}
+}
+
+func updateErrorStatus(err error) int {
+	var fieldErrs validation.Errors
+	switch {
+	case errors.As(err, &fieldErrs):
+		return http.StatusBadRequest
+	case errors.Is(err, manager.ErrDriverNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, manager.ErrLocationRejected):
+		return http.StatusUnprocessableEntity
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+func decodeLocationBatch(body io.Reader, contentType string) ([]models.UpdateLocationRequest, error) {
+	reader := bufio.NewReader(body)
+	if !strings.Contains(contentType, "ndjson") {
+		first, err := peekNonSpace(reader)
+		if err != nil {
+			return nil, err
+		}
+		if first == '[' {
+			var reqs []models.UpdateLocationRequest
+			if err := json.NewDecoder(reader).Decode(&reqs); err != nil {
+				return nil, err
+			}
+			if len(reqs) > MaxBatchUpdates {
+				return nil, errBatchTooLarge
+			}
+			return reqs, nil
+		}
+	}
+
+	reqs := make([]models.UpdateLocationRequest, 0)
+	line := 0
+	for {
+		raw, err := reader.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			// A body cut off at the size limit ends in a partial line, so
+			// report the read error rather than the line's syntax.
+			return nil, err
+		}
+		if len(bytes.TrimSpace(raw)) > 0 {
+			line++
+			if len(reqs) == MaxBatchUpdates {
+				return nil, errBatchTooLarge
+			}
+			var req models.UpdateLocationRequest
+			if decodeErr := json.Unmarshal(raw, &req); decodeErr != nil {
+				return nil, fmt.Errorf("line %d: %w", line, decodeErr)
+			}
+			reqs = append(reqs, req)
+		}
+		if err == io.EOF {
+			return reqs, nil
+		}
+	}
+}
+
+func peekNonSpace(reader *bufio.Reader) (byte, error) {
+	for {
+		b, err := reader.ReadByte()
+		if err == io.EOF {
+			return 0, errors.New("empty batch")
+		}
+		if err != nil {
+			return 0, err
+		}
+		if !strings.ContainsRune(" \t\r\n", rune(b)) {
+			return b, reader.UnreadByte()
+		}
+	}
+}
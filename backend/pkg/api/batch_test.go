@@ -0,0 +1,157 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"uber-system/pkg/models"
+)
+
+type batchResponse struct {
+	Total     int               `json:"total"`
+	Applied   int               `json:"applied"`
+	Duplicate int               `json:"duplicate"`
+	Stale     int               `json:"stale"`
+	Failed    int               `json:"failed"`
+	Results   []batchItemResult `json:"results"`
+}
+
+func postBatch(h *Handler, contentType, body string) *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+	req.Header.Set("Content-Type", contentType)
+	h.BatchUpdateLocations(recorder, req)
+	return recorder
+}
+
+func newBatchHandler(t *testing.T) *Handler {
+	t.Helper()
+	h, mgr := newTestHandler(t)
+	for _, id := range []string{"driver-1", "driver-2"} {
+		driver := &models.Driver{ID: id, Location: models.Location{Lat: 12.97, Lng: 77.59}, Status: models.StatusAvailable}
+		if err := mgr.AddDriver(driver); err != nil {
+			t.Fatalf("AddDriver: %v", err)
+		}
+	}
+	return h
+}
+
+func decodeBatch(t *testing.T, recorder *httptest.ResponseRecorder) batchResponse {
+	t.Helper()
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("status = %d (%s), want 200", recorder.Code, recorder.Body)
+	}
+	var resp batchResponse
+	if err := json.NewDecoder(recorder.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	return resp
+}
+
+func TestBatchUpdateLocationsMixed(t *testing.T) {
+	h := newBatchHandler(t)
+	body := `[
+		{"driver_id": "driver-1", "lat": 12.9701, "lng": 77.59, "seq": 2},
+		{"driver_id": "", "lat": 12.97, "lng": 77.59},
+		{"driver_id": "driver-9", "lat": 12.97, "lng": 77.59},
+		{"driver_id": "driver-2", "lat": 95, "lng": 77.59},
+		{"driver_id": "driver-1", "lat": 12.9701, "lng": 77.59, "seq": 2},
+		{"driver_id": "driver-1", "lat": 12.97, "lng": 77.59, "seq": 1},
+		{"driver_id": "driver-2", "lat": 13.97, "lng": 77.59},
+		{"driver_id": " driver-2 ", "lat": 12.9701, "lng": 77.5901}
+	]`
+	resp := decodeBatch(t, postBatch(h, "application/json", body))
+
+	if resp.Total != 8 || resp.Applied != 2 || resp.Duplicate != 1 || resp.Stale != 1 || resp.Failed != 4 {
+		t.Fatalf("counts = %+v", resp)
+	}
+	want := []struct {
+		driverID string
+		status   int
+		outcome  models.UpdateOutcome
+		field    string
+	}{
+		{"driver-1", http.StatusOK, models.UpdateApplied, ""},
+		{"", http.StatusBadRequest, "", "driver_id"},
+		{"driver-9", http.StatusNotFound, "", ""},
+		{"driver-2", http.StatusBadRequest, "", "lat"},
+		{"driver-1", http.StatusOK, models.UpdateDuplicate, ""},
+		{"driver-1", http.StatusOK, models.UpdateStale, ""},
+		{"driver-2", http.StatusUnprocessableEntity, "", ""},
+		{"driver-2", http.StatusOK, models.UpdateApplied, ""},
+	}
+	for i, w := range want {
+		got := resp.Results[i]
+		if got.Index != i || got.DriverID != w.driverID || got.Status != w.status || got.Outcome != w.outcome {
+			t.Errorf("result %d = %+v, want %s %d %q", i, got, w.driverID, w.status, w.outcome)
+		}
+		if w.field != "" && (len(got.Fields) == 0 || got.Fields[0].Field != w.field) {
+			t.Errorf("result %d fields = %+v, want %s", i, got.Fields, w.field)
+		}
+	}
+}
+
+func TestBatchUpdateLocationsNDJSON(t *testing.T) {
+	line := func(id string, seq int) string {
+		return fmt.Sprintf(`{"driver_id": %q, "lat": 12.9701, "lng": 77.59, "seq": %d}`, id, seq)
+	}
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+	}{
+		{"trailing newline", "application/x-ndjson", line("driver-1", 1) + "\n" + line("driver-2", 1) + "\n"},
+		{"no trailing newline", "application/x-ndjson", line("driver-1", 1) + "\n" + line("driver-2", 1)},
+		{"blank lines", "application/x-ndjson", "\n" + line("driver-1", 1) + "\n\n  \n" + line("driver-2", 1) + "\n\n"},
+		{"crlf", "application/x-ndjson", line("driver-1", 1) + "\r\n" + line("driver-2", 1) + "\r\n"},
+		{"objects without ndjson content type", "application/json", line("driver-1", 1) + "\n" + line("driver-2", 1) + "\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := decodeBatch(t, postBatch(newBatchHandler(t), tt.contentType, tt.body))
+			if resp.Total != 2 || resp.Applied != 2 {
+				t.Fatalf("counts = %+v, want 2 applied", resp)
+			}
+		})
+	}
+}
+
+func TestBatchUpdateLocationsRejectsBadBodies(t *testing.T) {
+	line := `{"driver_id": "driver-1", "lat": 12.97, "lng": 77.59}`
+	tooMany := strings.Repeat(line+"\n", MaxBatchUpdates+1)
+	tooManyArray := "[" + strings.TrimSuffix(strings.Repeat(line+",", MaxBatchUpdates+1), ",") + "]"
+	tooBig := `{"driver_id": "driver-1", "lat": 12.97, "lng": 77.59, "pad": "` + strings.Repeat("x", maxBatchBodyBytes) + `"}`
+
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		status      int
+		err         string
+	}{
+		{"empty", "application/json", "  \n", http.StatusBadRequest, "empty batch"},
+		{"malformed line", "application/x-ndjson", line + "\n\n{\"driver_id\": \n", http.StatusBadRequest, "line 2"},
+		{"malformed array", "application/json", "[" + line + ",]", http.StatusBadRequest, ""},
+		{"too many lines", "application/x-ndjson", tooMany, http.StatusRequestEntityTooLarge, "exceeds"},
+		{"too many items", "application/json", tooManyArray, http.StatusRequestEntityTooLarge, "exceeds"},
+		{"body over the limit", "application/x-ndjson", tooBig, http.StatusRequestEntityTooLarge, ""},
+		{"array over the limit", "application/json", "[" + tooBig + "]", http.StatusRequestEntityTooLarge, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := postBatch(newBatchHandler(t), tt.contentType, tt.body)
+			if got.Code != tt.status || !strings.Contains(got.Body.String(), tt.err) {
+				t.Fatalf("status = %d (%.200s), want %d with %q", got.Code, got.Body, tt.status, tt.err)
+			}
+		})
+	}
+
+	// Exactly MaxBatchUpdates is accepted.
+	resp := decodeBatch(t, postBatch(newBatchHandler(t), "application/x-ndjson", strings.Repeat(line+"\n", MaxBatchUpdates)))
+	if resp.Total != MaxBatchUpdates {
+		t.Fatalf("total = %d, want %d", resp.Total, MaxBatchUpdates)
+	}
+}
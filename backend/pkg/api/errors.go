@@ -0,0 +1,33 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"uber-system/pkg/validation"
+)
+
+type errorResponse struct {
+	Error  string                  `json:"error"`
+	Fields []validation.FieldError `json:"fields,omitempty"`
+}
+
+// writeError renders write-endpoint failures as JSON. Validation failures list
+// one entry per offending field and are reported as 400 unless the caller has
+// already picked a more specific client error.
+func writeError(w http.ResponseWriter, status int, err error) {
+	response := errorResponse{Error: err.Error()}
+
+	var fieldErrs validation.Errors
+	if errors.As(err, &fieldErrs) {
+		if status < 400 || status >= 500 {
+			status = http.StatusBadRequest
+		}
+		response.Error = "validation failed"
+		response.Fields = fieldErrs
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(response)
+}
@@ -2,19 +2,45 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"uber-system/pkg/history"
+	"uber-system/pkg/ingest"
 	"uber-system/pkg/manager"
 	"uber-system/pkg/models"
+	"uber-system/pkg/validation"
 )
 
+// MaxNearestK bounds the k a client may ask /drivers/nearest for.
+const MaxNearestK = 1000
+
 type Handler struct {
-	manager *manager.DriverManager
+	manager   *manager.DriverManager
+	history   *history.Store
+	publisher ingest.Publisher
 }
 
 func NewHandler(mgr *manager.DriverManager) *Handler {
 	return &Handler{manager: mgr}
 }
 
+func (h *Handler) SetHistoryStore(store *history.Store) {
+	h.history = store
+}
+
+// SetPublisher switches location writes to asynchronous ingestion: updates
+// are validated, routed to their city and acknowledged with 202 once the
+// publisher has accepted them; its consumer applies them to the manager.
+// Updates for a driver crossing cities may land on different partitions, so
+// their order relies on the client timestamp or seq.
+func (h *Handler) SetPublisher(publisher ingest.Publisher) {
+	h.publisher = publisher
+}
+
 func (h *Handler) AddDriver(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -23,12 +49,17 @@ func (h *Handler) AddDriver(w http.ResponseWriter, r *http.Request) {
 
 	var driver models.Driver
 	if err := json.NewDecoder(r.Body).Decode(&driver); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, err)
 		return
 	}
 
 	if err := h.manager.AddDriver(&driver); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		status := http.StatusInternalServerError
+		if errors.Is(err, manager.ErrDriverExists) {
+			status = http.StatusConflict
+			err = validation.Errors{{Field: "id", Code: validation.CodeDuplicate, Message: err.Error()}}
+		}
+		writeError(w, status, err)
 		return
 	}
 
@@ -39,6 +70,154 @@ func (h *Handler) AddDriver(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+func (h *Handler) DriverByID(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/drivers/"), "/")
+	driverID := validation.NormalizeID(parts[0])
+	if driverID == "" || len(parts) > 2 {
+		http.NotFound(w, r)
+		return
+	}
+
+	resource := ""
+	if len(parts) == 2 {
+		resource = parts[1]
+	}
+
+	switch {
+	case resource == "" && r.Method == http.MethodDelete:
+		h.RemoveDriver(w, r, driverID)
+	case resource == "status-history" && r.Method == http.MethodGet:
+		h.GetStatusHistory(w, r, driverID)
+	case resource == "history" && r.Method == http.MethodGet:
+		h.GetLocationHistory(w, r, driverID)
+	case resource == "at" && r.Method == http.MethodGet:
+		h.GetLocationAt(w, r, driverID)
+	case resource == "" || resource == "status-history" || resource == "history" || resource == "at":
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (h *Handler) GetStatusHistory(w http.ResponseWriter, r *http.Request, driverID string) {
+	history, err := h.manager.GetStatusHistory(driverID)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, manager.ErrDriverNotFound) {
+			status = http.StatusNotFound
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"driver_id":   driverID,
+		"transitions": history,
+	})
+}
+
+func (h *Handler) GetLocationHistory(w http.ResponseWriter, r *http.Request, driverID string) {
+	if h.history == nil {
+		http.Error(w, "Location history is disabled", http.StatusNotImplemented)
+		return
+	}
+
+	now := time.Now()
+	from, err := parseTimeParam(r, "from", now.Add(-time.Hour))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	to, err := parseTimeParam(r, "to", now)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if to.Before(from) {
+		http.Error(w, "to must not be before from", http.StatusBadRequest)
+		return
+	}
+
+	records, err := h.history.Query(driverID, from, to)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"driver_id": driverID,
+		"from":      from,
+		"to":        to,
+		"count":     len(records),
+		"locations": records,
+	})
+}
+
+func (h *Handler) GetLocationAt(w http.ResponseWriter, r *http.Request, driverID string) {
+	if h.history == nil {
+		http.Error(w, "Location history is disabled", http.StatusNotImplemented)
+		return
+	}
+
+	ts, err := parseTimeParam(r, "ts", time.Time{})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if ts.IsZero() {
+		http.Error(w, "ts is required", http.StatusBadRequest)
+		return
+	}
+
+	record, found, err := h.history.At(driverID, ts)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !found {
+		http.Error(w, "no recorded location for driver at "+ts.Format(time.RFC3339), http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(record)
+}
+
+// parseTimeParam accepts RFC 3339 timestamps or unix seconds.
+func parseTimeParam(r *http.Request, name string, fallback time.Time) (time.Time, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return fallback, nil
+	}
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(seconds, 0), nil
+	}
+	ts, err := time.Parse(time.RFC3339Nano, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid %s: expected RFC 3339 or unix seconds", name)
+	}
+	return ts, nil
+}
+
+func (h *Handler) RemoveDriver(w http.ResponseWriter, r *http.Request, driverID string) {
+	if err := h.manager.RemoveDriver(driverID); err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, manager.ErrDriverNotFound) {
+			status = http.StatusNotFound
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Driver removed successfully",
+		"id":      driverID,
+	})
+}
+
 func (h *Handler) UpdateLocation(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPut {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -47,21 +226,48 @@ func (h *Handler) UpdateLocation(w http.ResponseWriter, r *http.Request) {
 
 	var req models.UpdateLocationRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, err)
 		return
 	}
 
-	if err := h.manager.UpdateLocation(req.DriverID, req.Lat, req.Lng); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	if h.publisher != nil {
+		receipt, err := h.publishLocation(r.Context(), req)
+		if err != nil {
+			writeError(w, publishErrorStatus(err), err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"message":   "Location update accepted",
+			"partition": receipt.Partition,
+			"offset":    receipt.Offset,
+		})
 		return
 	}
 
+	outcome, err := h.manager.ApplyLocationUpdate(req)
+	if err != nil {
+		writeError(w, updateErrorStatus(err), err)
+		return
+	}
+
+	message := "Location updated successfully"
+	if outcome != models.UpdateApplied {
+		message = "Location update ignored"
+	}
+
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{
-		"message": "Location updated successfully",
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message": message,
+		"outcome": outcome,
 	})
 }
 
+// UpdateStatus moves a driver through the status transitions in
+// models.DriverStatus and answers 409 for a transition the table forbids.
+// Location updates never change status, so a driver the janitor marked
+// offline as stale must be set available here again.
 func (h *Handler) UpdateStatus(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPut {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -70,12 +276,28 @@ func (h *Handler) UpdateStatus(w http.ResponseWriter, r *http.Request) {
 
 	var req models.UpdateStatusRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, err)
 		return
 	}
 
-	if err := h.manager.UpdateStatus(req.DriverID, req.Status); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	var errs validation.Errors
+	validation.CheckID(&errs, "driver_id", validation.NormalizeID(req.DriverID))
+	if err := errs.Err(); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := h.manager.UpdateStatus(validation.NormalizeID(req.DriverID), req.Status); err != nil {
+		status := http.StatusInternalServerError
+		switch {
+		case errors.Is(err, manager.ErrDriverNotFound):
+			status = http.StatusNotFound
+		case errors.Is(err, manager.ErrInvalidStatus):
+			status = http.StatusBadRequest
+		case errors.Is(err, manager.ErrInvalidTransition):
+			status = http.StatusConflict
+		}
+		writeError(w, status, err)
 		return
 	}
 
@@ -107,10 +329,70 @@ func (h *Handler) SearchDrivers(w http.ResponseWriter, r *http.Request) {
 		req.Location.Lng,
 		req.Radius,
 		indexType,
+		req.SearchFilter,
 	)
 
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		status := http.StatusInternalServerError
+		if errors.Is(err, manager.ErrUnknownIndex) {
+			status = http.StatusBadRequest
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	response := models.SearchResponse{
+		Drivers:   results,
+		Count:     len(results),
+		Duration:  duration.String(),
+		IndexType: string(indexType),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+func (h *Handler) FindNearest(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req models.NearestRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if req.K <= 0 {
+		http.Error(w, "k must be positive", http.StatusBadRequest)
+		return
+	}
+	if req.K > MaxNearestK {
+		http.Error(w, fmt.Sprintf("k must not exceed %d", MaxNearestK), http.StatusBadRequest)
+		return
+	}
+
+	indexType := manager.IndexTypeQuadTree
+	if req.IndexType != "" {
+		indexType = manager.IndexType(req.IndexType)
+	}
+
+	results, duration, err := h.manager.FindNearest(
+		req.Location.Lat,
+		req.Location.Lng,
+		req.K,
+		req.MaxDistance,
+		indexType,
+		req.SearchFilter,
+	)
+
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, manager.ErrUnknownIndex) {
+			status = http.StatusBadRequest
+		}
+		http.Error(w, err.Error(), status)
 		return
 	}
 
@@ -137,12 +419,44 @@ func (h *Handler) CompareIndexes(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	comparison := h.manager.CompareIndexes(req.Location.Lat, req.Location.Lng, req.Radius)
+	comparison := h.manager.CompareIndexes(req.Location.Lat, req.Location.Lng, req.Radius, req.SearchFilter)
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(comparison)
 }
 
+func (h *Handler) GetAnomalies(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	since, err := parseTimeParam(r, "since", time.Time{})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	limit := 100
+	if value := r.URL.Query().Get("limit"); value != "" {
+		limit, err = strconv.Atoi(value)
+		if err != nil || limit < 0 {
+			http.Error(w, "invalid limit", http.StatusBadRequest)
+			return
+		}
+	}
+
+	detector := h.manager.Anomalies()
+	events := detector.Events(r.URL.Query().Get("driver_id"), since, limit)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"count":     len(events),
+		"anomalies": events,
+		"stats":     detector.Stats(),
+	})
+}
+
 func (h *Handler) GetStats(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -150,6 +464,9 @@ func (h *Handler) GetStats(w http.ResponseWriter, r *http.Request) {
 	}
 
 	stats := h.manager.GetStats()
+	if h.publisher != nil {
+		stats["ingestion"] = h.publisher.Stats()
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(stats)
@@ -159,4 +476,3 @@ func (h *Handler) Health(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 	w.Write([]byte("OK"))
 }
-
@@ -0,0 +1,100 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"uber-system/pkg/manager"
+	"uber-system/pkg/models"
+)
+
+func newTestHandler(t *testing.T) (*Handler, *manager.DriverManager) {
+	t.Helper()
+	mgr, err := manager.NewDriverManager("", false)
+	if err != nil {
+		t.Fatalf("NewDriverManager: %v", err)
+	}
+	t.Cleanup(func() { mgr.Close() })
+	return NewHandler(mgr), mgr
+}
+
+func serve(handler http.HandlerFunc, method, target, body string) *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+	handler(recorder, httptest.NewRequest(method, target, strings.NewReader(body)))
+	return recorder
+}
+
+func TestSearchRejectsUnknownIndexType(t *testing.T) {
+	h, _ := newTestHandler(t)
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		body    string
+		status  int
+	}{
+		{"search", h.SearchDrivers, `{"location":{"lat":12.97,"lng":77.59},"radius":1,"index_type":"rtree"}`, http.StatusBadRequest},
+		{"search known", h.SearchDrivers, `{"location":{"lat":12.97,"lng":77.59},"radius":1,"index_type":"grid"}`, http.StatusOK},
+		{"nearest", h.FindNearest, `{"location":{"lat":12.97,"lng":77.59},"k":5,"index_type":"rtree"}`, http.StatusBadRequest},
+		{"nearest known", h.FindNearest, `{"location":{"lat":12.97,"lng":77.59},"k":5,"index_type":"s2"}`, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := serve(tt.handler, http.MethodPost, "/", tt.body); got.Code != tt.status {
+				t.Fatalf("status = %d (%s), want %d", got.Code, got.Body, tt.status)
+			}
+		})
+	}
+}
+
+func TestUpdateStatusCodes(t *testing.T) {
+	h, mgr := newTestHandler(t)
+	driver := &models.Driver{ID: "driver-1", Location: models.Location{Lat: 12.97, Lng: 77.59}, Status: models.StatusAvailable}
+	if err := mgr.AddDriver(driver); err != nil {
+		t.Fatalf("AddDriver: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		body   string
+		status int
+	}{
+		{"available to on_trip", `{"driver_id":"driver-1","status":"on_trip"}`, http.StatusConflict},
+		{"unknown status", `{"driver_id":"driver-1","status":"Available"}`, http.StatusBadRequest},
+		{"unknown driver", `{"driver_id":"driver-2","status":"offline"}`, http.StatusNotFound},
+		{"available to reserved", `{"driver_id":"driver-1","status":"reserved"}`, http.StatusOK},
+		{"reserved again", `{"driver_id":"driver-1","status":"reserved"}`, http.StatusOK},
+		{"reserved to on_trip", `{"driver_id":" driver-1 ","status":"on_trip"}`, http.StatusOK},
+		{"on_trip to reserved", `{"driver_id":"driver-1","status":"reserved"}`, http.StatusConflict},
+		{"on_trip to offline", `{"driver_id":"driver-1","status":"offline"}`, http.StatusOK},
+		{"offline to reserved", `{"driver_id":"driver-1","status":"reserved"}`, http.StatusConflict},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := serve(h.UpdateStatus, http.MethodPut, "/", tt.body); got.Code != tt.status {
+				t.Fatalf("status = %d (%s), want %d", got.Code, got.Body, tt.status)
+			}
+		})
+	}
+}
+
+func TestDriverByIDNormalizesPathID(t *testing.T) {
+	h, mgr := newTestHandler(t)
+	driver := &models.Driver{ID: "driver-1", Location: models.Location{Lat: 12.97, Lng: 77.59}, Status: models.StatusAvailable}
+	if err := mgr.AddDriver(driver); err != nil {
+		t.Fatalf("AddDriver: %v", err)
+	}
+
+	if got := serve(h.DriverByID, http.MethodGet, "/drivers/%20driver-1%09/status-history", ""); got.Code != http.StatusOK {
+		t.Fatalf("status history = %d (%s), want 200", got.Code, got.Body)
+	}
+	if got := serve(h.DriverByID, http.MethodDelete, "/drivers/%20driver-1%20", ""); got.Code != http.StatusOK || !strings.Contains(got.Body.String(), `"id":"driver-1"`) {
+		t.Fatalf("remove = %d (%s), want 200 for driver-1", got.Code, got.Body)
+	}
+	if got := serve(h.DriverByID, http.MethodDelete, "/drivers/driver-1", ""); got.Code != http.StatusNotFound {
+		t.Fatalf("second remove = %d, want 404", got.Code)
+	}
+	if got := serve(h.DriverByID, http.MethodDelete, "/drivers/%20", ""); got.Code != http.StatusNotFound {
+		t.Fatalf("remove of a blank ID = %d, want 404", got.Code)
+	}
+}
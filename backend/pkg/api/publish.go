@@ -0,0 +1,41 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+	"uber-system/pkg/ingest"
+	"uber-system/pkg/models"
+	"uber-system/pkg/validation"
+)
+
+var errUnroutable = errors.New("location is outside every served city")
+
+// publishLocation validates an update and hands it to the publisher together
+// with the city it falls in, which the pipelines use as the partition key.
+func (h *Handler) publishLocation(ctx context.Context, req models.UpdateLocationRequest) (ingest.Receipt, error) {
+	if err := validation.LocationUpdate(req, time.Now()); err != nil {
+		return ingest.Receipt{}, err
+	}
+	req.DriverID = validation.NormalizeID(req.DriverID)
+
+	city, err := h.manager.GeoRouter().GetCity(req.Lat, req.Lng)
+	if err != nil {
+		return ingest.Receipt{}, fmt.Errorf("%w: %v", errUnroutable, err)
+	}
+	return h.publisher.Publish(ctx, city, req)
+}
+
+func publishErrorStatus(err error) int {
+	var fieldErrs validation.Errors
+	switch {
+	case errors.As(err, &fieldErrs):
+		return http.StatusBadRequest
+	case errors.Is(err, errUnroutable):
+		return http.StatusUnprocessableEntity
+	default:
+		return http.StatusServiceUnavailable
+	}
+}
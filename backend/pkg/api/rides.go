@@ -0,0 +1,123 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"uber-system/pkg/dispatch"
+)
+
+type RideHandler struct {
+	matcher *dispatch.Matcher
+}
+
+func NewRideHandler(matcher *dispatch.Matcher) *RideHandler {
+	return &RideHandler{matcher: matcher}
+}
+
+type offerResponseRequest struct {
+	DriverID string `json:"driver_id"`
+}
+
+func (h *RideHandler) RequestRide(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req dispatch.RideRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	trip, err := h.matcher.RequestRide(req)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(trip)
+}
+
+func (h *RideHandler) GetStats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	stats := map[string]interface{}{
+		"mode": h.matcher.Mode(),
+	}
+	if batchStats, enabled := h.matcher.BatchStats(); enabled {
+		stats["batch"] = batchStats
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(stats)
+}
+
+func (h *RideHandler) RideByID(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/rides/"), "/")
+	tripID := parts[0]
+	if tripID == "" || len(parts) > 2 {
+		http.NotFound(w, r)
+		return
+	}
+
+	if len(parts) == 1 {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		trip, err := h.matcher.GetTrip(tripID)
+		h.writeTrip(w, trip, err)
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req offerResponseRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.DriverID == "" {
+		http.Error(w, "driver_id is required", http.StatusBadRequest)
+		return
+	}
+
+	switch parts[1] {
+	case "accept":
+		trip, err := h.matcher.Accept(tripID, req.DriverID)
+		h.writeTrip(w, trip, err)
+	case "decline":
+		trip, err := h.matcher.Decline(tripID, req.DriverID)
+		h.writeTrip(w, trip, err)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (h *RideHandler) writeTrip(w http.ResponseWriter, trip dispatch.Trip, err error) {
+	if err != nil {
+		status := http.StatusInternalServerError
+		switch {
+		case errors.Is(err, dispatch.ErrTripNotFound):
+			status = http.StatusNotFound
+		case errors.Is(err, dispatch.ErrNoActiveOffer), errors.Is(err, dispatch.ErrDriverUnavailable):
+			status = http.StatusConflict
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(trip)
+}
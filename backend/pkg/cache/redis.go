@@ -4,11 +4,13 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"github.com/redis/go-redis/v9"
 	"time"
 	"uber-system/pkg/models"
-	"github.com/redis/go-redis/v9"
 )
 
+const maxGeoSearchRadiusKm = 20037.5
+
 type RedisCache struct {
 	client *redis.Client
 	ctx    context.Context
@@ -63,6 +65,42 @@ func (rc *RedisCache) UpdateLocation(driverID, city string, lat, lng float64) er
 	}).Err()
 }
 
+// LocationWrite is one entry in a pipelined location batch. OldCity is set
+// when the driver crossed into City and must leave its previous geo set.
+type LocationWrite struct {
+	Driver  models.Driver
+	City    string
+	OldCity string
+}
+
+func (rc *RedisCache) UpdateLocations(writes []LocationWrite) error {
+	if len(writes) == 0 {
+		return nil
+	}
+
+	_, err := rc.client.Pipelined(rc.ctx, func(pipe redis.Pipeliner) error {
+		for _, write := range writes {
+			pipe.GeoAdd(rc.ctx, fmt.Sprintf("drivers:%s", write.City), &redis.GeoLocation{
+				Name:      write.Driver.ID,
+				Longitude: write.Driver.Location.Lng,
+				Latitude:  write.Driver.Location.Lat,
+			})
+			if write.OldCity == "" || write.OldCity == write.City {
+				continue
+			}
+
+			pipe.ZRem(rc.ctx, fmt.Sprintf("drivers:%s", write.OldCity), write.Driver.ID)
+			driverData, err := json.Marshal(write.Driver)
+			if err != nil {
+				return err
+			}
+			pipe.Set(rc.ctx, fmt.Sprintf("driver:%s:meta", write.Driver.ID), driverData, rc.ttl)
+		}
+		return nil
+	})
+	return err
+}
+
 func (rc *RedisCache) RemoveDriver(driverID, city string) error {
 	key := fmt.Sprintf("drivers:%s", city)
 	metaKey := fmt.Sprintf("driver:%s:meta", driverID)
@@ -93,6 +131,22 @@ func (rc *RedisCache) SearchRadius(city string, lat, lng, radiusKm float64) ([]s
 	return driverIDs, nil
 }
 
+func (rc *RedisCache) SearchNearest(city string, lat, lng float64, count int, maxDistanceKm float64) ([]string, error) {
+	key := fmt.Sprintf("drivers:%s", city)
+	radius := maxDistanceKm
+	if radius <= 0 {
+		radius = maxGeoSearchRadiusKm
+	}
+	return rc.client.GeoSearch(rc.ctx, key, &redis.GeoSearchQuery{
+		Longitude:  lng,
+		Latitude:   lat,
+		Radius:     radius,
+		RadiusUnit: "km",
+		Sort:       "ASC",
+		Count:      count,
+	}).Result()
+}
+
 func (rc *RedisCache) GetDriver(driverID string) (*models.Driver, error) {
 	metaKey := fmt.Sprintf("driver:%s:meta", driverID)
 	data, err := rc.client.Get(rc.ctx, metaKey).Result()
@@ -107,6 +161,32 @@ func (rc *RedisCache) GetDriver(driverID string) (*models.Driver, error) {
 	return &driver, nil
 }
 
+// CityLocations returns every member of a city's geo set with the position
+// Redis has stored for it.
+func (rc *RedisCache) CityLocations(city string) (map[string]models.Location, error) {
+	key := fmt.Sprintf("drivers:%s", city)
+	members, err := rc.client.ZRange(rc.ctx, key, 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	locations := make(map[string]models.Location, len(members))
+	if len(members) == 0 {
+		return locations, nil
+	}
+	positions, err := rc.client.GeoPos(rc.ctx, key, members...).Result()
+	if err != nil {
+		return nil, err
+	}
+	for i, position := range positions {
+		if position == nil {
+			continue
+		}
+		locations[members[i]] = models.Location{Lat: position.Latitude, Lng: position.Longitude}
+	}
+	return locations, nil
+}
+
 func (rc *RedisCache) GetStats(city string) (map[string]interface{}, error) {
 	key := fmt.Sprintf("drivers:%s", city)
 	count, err := rc.client.ZCard(rc.ctx, key).Result()
@@ -124,4 +204,3 @@ func (rc *RedisCache) GetStats(city string) (map[string]interface{}, error) {
 func (rc *RedisCache) Close() error {
 	return rc.client.Close()
 }
-
@@ -0,0 +1,205 @@
+package dispatch
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+	"time"
+	"uber-system/pkg/geospatial"
+	"uber-system/pkg/models"
+)
+
+type Mode string
+
+const (
+	// ModeGreedy offers each trip to its nearest drivers one at a time and
+	// waits for an Accept or Decline before trying the next.
+	ModeGreedy Mode = "greedy"
+	// ModeBatch collects trips per city for BatchWindow and assigns them
+	// together. Matched drivers are reserved without an offer, so the trip
+	// goes straight to TripAssigned and Accept and Decline do not apply.
+	ModeBatch Mode = "batch"
+)
+
+func (mode Mode) IsValid() bool {
+	return mode == ModeGreedy || mode == ModeBatch
+}
+
+type BatchStats struct {
+	Batches                int     `json:"batches"`
+	Requests               int     `json:"requests"`
+	Assigned               int     `json:"assigned"`
+	PickupDistanceKm       float64 `json:"pickup_distance_km"`
+	GreedyAssigned         int     `json:"greedy_assigned"`
+	GreedyPickupDistanceKm float64 `json:"greedy_pickup_distance_km"`
+}
+
+type batcher struct {
+	pending map[string][]*tripState
+	stats   BatchStats
+	stop    chan struct{}
+	wg      sync.WaitGroup
+}
+
+func newBatcher() *batcher {
+	return &batcher{
+		pending: make(map[string][]*tripState),
+		stop:    make(chan struct{}),
+	}
+}
+
+func (m *Matcher) startBatching() {
+	m.batch = newBatcher()
+	m.batch.wg.Add(1)
+	go func() {
+		defer m.batch.wg.Done()
+		ticker := time.NewTicker(m.config.BatchWindow)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-m.batch.stop:
+				return
+			case now := <-ticker.C:
+				m.FlushBatches(now)
+			}
+		}
+	}()
+}
+
+func (m *Matcher) enqueue(state *tripState) {
+	pickup := state.trip.Request.Pickup
+	city, err := m.manager.GeoRouter().GetCity(pickup.Lat, pickup.Lng)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err != nil {
+		state.trip.Status = TripNoDrivers
+		state.trip.UpdatedAt = time.Now()
+		return
+	}
+	m.batch.pending[city] = append(m.batch.pending[city], state)
+}
+
+func (m *Matcher) FlushBatches(now time.Time) {
+	if m.batch == nil {
+		return
+	}
+
+	m.mu.Lock()
+	pending := m.batch.pending
+	m.batch.pending = make(map[string][]*tripState)
+	m.mu.Unlock()
+
+	for city, states := range pending {
+		remaining := m.assignBatch(states, now)
+
+		m.mu.Lock()
+		for _, state := range remaining {
+			if now.Sub(state.trip.CreatedAt) > m.config.MaxBatchWait {
+				state.trip.Status = TripNoDrivers
+				state.trip.UpdatedAt = now
+				continue
+			}
+			m.batch.pending[city] = append(m.batch.pending[city], state)
+		}
+		m.mu.Unlock()
+	}
+}
+
+// assignBatch matches states to nearby drivers with SolveAssignment and
+// reserves every matched driver outright; the driver is never asked. States
+// left unmatched, or whose driver was taken meanwhile, are returned.
+func (m *Matcher) assignBatch(states []*tripState, now time.Time) []*tripState {
+	drivers := make([]models.Driver, 0)
+	columns := make(map[string]int)
+
+	for _, state := range states {
+		req := state.trip.Request
+		candidates, _, err := m.manager.FindNearest(
+			req.Pickup.Lat,
+			req.Pickup.Lng,
+			m.config.MaxCandidates,
+			m.config.SearchRadiusKm,
+			m.config.IndexType,
+			filterFor(req),
+		)
+		if err != nil {
+			fmt.Printf("Batch dispatch search error for %s: %v\n", state.trip.ID, err)
+			continue
+		}
+		for _, candidate := range candidates {
+			if _, seen := columns[candidate.Driver.ID]; !seen {
+				columns[candidate.Driver.ID] = len(drivers)
+				drivers = append(drivers, candidate.Driver)
+			}
+		}
+	}
+
+	if len(drivers) == 0 {
+		return states
+	}
+
+	cost := make([][]float64, len(states))
+	for i, state := range states {
+		req := state.trip.Request
+		cost[i] = make([]float64, len(drivers))
+		for j, driver := range drivers {
+			cost[i][j] = math.Inf(1)
+			if req.CarType != "" && !strings.EqualFold(req.CarType, driver.CarType) {
+				continue
+			}
+			distance := geospatial.Haversine(req.Pickup.Lat, req.Pickup.Lng, driver.Location.Lat, driver.Location.Lng)
+			if distance <= m.config.SearchRadiusKm {
+				cost[i][j] = distance
+			}
+		}
+	}
+
+	optimal := SolveAssignment(cost)
+	greedyTotal, greedyAssigned := assignmentCost(cost, greedyAssignment(cost))
+
+	remaining := make([]*tripState, 0)
+	assigned := 0
+	total := 0.0
+	for i, j := range optimal {
+		state := states[i]
+		if j < 0 || m.reserve(drivers[j].ID) != nil {
+			remaining = append(remaining, state)
+			continue
+		}
+
+		assigned++
+		total += cost[i][j]
+
+		m.mu.Lock()
+		state.trip.Status = TripAssigned
+		state.trip.DriverID = drivers[j].ID
+		state.trip.PickupDistance = cost[i][j]
+		state.trip.UpdatedAt = now
+		m.mu.Unlock()
+	}
+
+	m.mu.Lock()
+	m.batch.stats.Batches++
+	m.batch.stats.Requests += len(states)
+	m.batch.stats.Assigned += assigned
+	m.batch.stats.PickupDistanceKm += total
+	m.batch.stats.GreedyAssigned += greedyAssigned
+	m.batch.stats.GreedyPickupDistanceKm += greedyTotal
+	m.mu.Unlock()
+
+	return remaining
+}
+
+func (m *Matcher) BatchStats() (BatchStats, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.batch == nil {
+		return BatchStats{}, false
+	}
+	return m.batch.stats, true
+}
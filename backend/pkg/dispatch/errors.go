@@ -0,0 +1,9 @@
+package dispatch
+
+import "errors"
+
+var (
+	ErrTripNotFound      = errors.New("trip not found")
+	ErrNoActiveOffer     = errors.New("no active offer for driver")
+	ErrDriverUnavailable = errors.New("driver is no longer available")
+)
@@ -0,0 +1,142 @@
+package dispatch
+
+import "math"
+
+// SolveAssignment returns, for each row of the cost matrix, the column that
+// minimises the total cost of a one-to-one assignment, or -1 when the row is
+// left unassigned. Infinite costs mark forbidden pairs.
+func SolveAssignment(cost [][]float64) []int {
+	rows := len(cost)
+	assignment := make([]int, rows)
+	for i := range assignment {
+		assignment[i] = -1
+	}
+	if rows == 0 || len(cost[0]) == 0 {
+		return assignment
+	}
+	cols := len(cost[0])
+
+	forbidden := 1.0
+	for _, row := range cost {
+		for _, c := range row {
+			if !math.IsInf(c, 1) {
+				forbidden += math.Abs(c)
+			}
+		}
+	}
+
+	transposed := rows > cols
+	n, m := rows, cols
+	if transposed {
+		n, m = cols, rows
+	}
+	at := func(i, j int) float64 {
+		if transposed {
+			i, j = j, i
+		}
+		c := cost[i][j]
+		if math.IsInf(c, 1) {
+			return forbidden
+		}
+		return c
+	}
+
+	u := make([]float64, n+1)
+	v := make([]float64, m+1)
+	p := make([]int, m+1)
+	way := make([]int, m+1)
+
+	for i := 1; i <= n; i++ {
+		p[0] = i
+		j0 := 0
+		minv := make([]float64, m+1)
+		used := make([]bool, m+1)
+		for j := range minv {
+			minv[j] = math.Inf(1)
+		}
+
+		for {
+			used[j0] = true
+			i0 := p[j0]
+			delta := math.Inf(1)
+			j1 := 0
+			for j := 1; j <= m; j++ {
+				if used[j] {
+					continue
+				}
+				cur := at(i0-1, j-1) - u[i0] - v[j]
+				if cur < minv[j] {
+					minv[j] = cur
+					way[j] = j0
+				}
+				if minv[j] < delta {
+					delta = minv[j]
+					j1 = j
+				}
+			}
+			for j := 0; j <= m; j++ {
+				if used[j] {
+					u[p[j]] += delta
+					v[j] -= delta
+				} else {
+					minv[j] -= delta
+				}
+			}
+			j0 = j1
+			if p[j0] == 0 {
+				break
+			}
+		}
+
+		for j0 != 0 {
+			j1 := way[j0]
+			p[j0] = p[j1]
+			j0 = j1
+		}
+	}
+
+	for j := 1; j <= m; j++ {
+		if p[j] == 0 {
+			continue
+		}
+		row, col := p[j]-1, j-1
+		if transposed {
+			row, col = col, row
+		}
+		if !math.IsInf(cost[row][col], 1) {
+			assignment[row] = col
+		}
+	}
+	return assignment
+}
+
+func greedyAssignment(cost [][]float64) []int {
+	assignment := make([]int, len(cost))
+	taken := make(map[int]bool)
+	for i, row := range cost {
+		assignment[i] = -1
+		best := math.Inf(1)
+		for j, c := range row {
+			if !taken[j] && c < best {
+				best = c
+				assignment[i] = j
+			}
+		}
+		if assignment[i] >= 0 {
+			taken[assignment[i]] = true
+		}
+	}
+	return assignment
+}
+
+func assignmentCost(cost [][]float64, assignment []int) (float64, int) {
+	total := 0.0
+	assigned := 0
+	for i, j := range assignment {
+		if j >= 0 {
+			total += cost[i][j]
+			assigned++
+		}
+	}
+	return total, assigned
+}
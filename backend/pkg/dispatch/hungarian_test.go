@@ -0,0 +1,99 @@
+package dispatch
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+// bruteForceAssignment tries every one-to-one assignment of rows to feasible
+// columns and returns the most rows that can be assigned and the lowest
+// total cost of doing so.
+func bruteForceAssignment(cost [][]float64) (int, float64) {
+	cols := 0
+	if len(cost) > 0 {
+		cols = len(cost[0])
+	}
+	taken := make([]bool, cols)
+	bestAssigned, bestTotal := 0, 0.0
+
+	var try func(row, assigned int, total float64)
+	try = func(row, assigned int, total float64) {
+		if row == len(cost) {
+			if assigned > bestAssigned || (assigned == bestAssigned && total < bestTotal) {
+				bestAssigned, bestTotal = assigned, total
+			}
+			return
+		}
+		try(row+1, assigned, total)
+		for col, c := range cost[row] {
+			if taken[col] || math.IsInf(c, 1) {
+				continue
+			}
+			taken[col] = true
+			try(row+1, assigned+1, total+c)
+			taken[col] = false
+		}
+	}
+	try(0, 0, 0)
+	return bestAssigned, bestTotal
+}
+
+func TestSolveAssignmentMatchesBruteForce(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for n := 0; n < 2000; n++ {
+		rows, cols := r.Intn(6), r.Intn(6)
+		forbidden := []float64{0, 0.2, 0.5, 0.9}[r.Intn(4)]
+		cost := make([][]float64, rows)
+		for i := range cost {
+			cost[i] = make([]float64, cols)
+			for j := range cost[i] {
+				switch {
+				case r.Float64() < forbidden:
+					cost[i][j] = math.Inf(1)
+				case n%2 == 0:
+					// Small whole numbers make ties between assignments likely.
+					cost[i][j] = float64(r.Intn(4))
+				default:
+					cost[i][j] = r.Float64() * 5
+				}
+			}
+		}
+
+		assignment := SolveAssignment(cost)
+		if len(assignment) != rows {
+			t.Fatalf("assignment has %d rows, want %d", len(assignment), rows)
+		}
+		used := make(map[int]bool)
+		for i, j := range assignment {
+			if j < 0 {
+				continue
+			}
+			if j >= cols || used[j] || math.IsInf(cost[i][j], 1) {
+				t.Fatalf("row %d assigned to column %d in %v", i, j, assignment)
+			}
+			used[j] = true
+		}
+
+		total, assigned := assignmentCost(cost, assignment)
+		wantAssigned, wantTotal := bruteForceAssignment(cost)
+		if assigned != wantAssigned || math.Abs(total-wantTotal) > 1e-9 {
+			t.Fatalf("assigned %d rows for %v, brute force %d for %v\ncost %v", assigned, total, wantAssigned, wantTotal, cost)
+		}
+	}
+}
+
+func TestSolveAssignmentBeatsGreedy(t *testing.T) {
+	// Greedy gives the first ride its nearest driver and leaves the second
+	// ride with a long pickup.
+	cost := [][]float64{
+		{1, 2},
+		{2, 10},
+	}
+	if got := SolveAssignment(cost); got[0] != 1 || got[1] != 0 {
+		t.Fatalf("SolveAssignment = %v, want [1 0]", got)
+	}
+	if total, _ := assignmentCost(cost, greedyAssignment(cost)); total != 11 {
+		t.Fatalf("greedy total = %v, want 11", total)
+	}
+}
@@ -0,0 +1,313 @@
+package dispatch
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+	"uber-system/pkg/manager"
+	"uber-system/pkg/models"
+)
+
+type Config struct {
+	Mode           Mode
+	OfferTimeout   time.Duration
+	MaxCandidates  int
+	SearchRadiusKm float64
+	IndexType      manager.IndexType
+	BatchWindow    time.Duration
+	MaxBatchWait   time.Duration
+	TripTTL        time.Duration
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Mode:           ModeGreedy,
+		OfferTimeout:   15 * time.Second,
+		MaxCandidates:  5,
+		SearchRadiusKm: 5,
+		IndexType:      manager.IndexTypeQuadTree,
+		BatchWindow:    2 * time.Second,
+		MaxBatchWait:   30 * time.Second,
+		TripTTL:        10 * time.Minute,
+	}
+}
+
+type offerResponse struct {
+	driverID string
+	accepted bool
+	result   chan error
+}
+
+type tripState struct {
+	trip      *Trip
+	responses chan offerResponse
+}
+
+type Matcher struct {
+	manager *manager.DriverManager
+	config  Config
+	trips   map[string]*tripState
+	offers  map[string]string
+	batch   *batcher
+	nextID  uint64
+	stop    chan struct{}
+	wg      sync.WaitGroup
+	mu      sync.Mutex
+}
+
+func NewMatcher(mgr *manager.DriverManager, config Config) *Matcher {
+	m := &Matcher{
+		manager: mgr,
+		config:  config,
+		trips:   make(map[string]*tripState),
+		offers:  make(map[string]string),
+		stop:    make(chan struct{}),
+	}
+	if config.Mode == ModeBatch {
+		m.startBatching()
+	}
+	if config.TripTTL > 0 {
+		m.startExpiry()
+	}
+	return m
+}
+
+func (m *Matcher) startExpiry() {
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		ticker := time.NewTicker(m.config.TripTTL / 2)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-m.stop:
+				return
+			case now := <-ticker.C:
+				m.ExpireTrips(now)
+			}
+		}
+	}()
+}
+
+// ExpireTrips forgets trips that finished matching more than TripTTL before
+// now and returns how many were dropped. Trips still searching or holding an
+// offer are kept however old they are.
+func (m *Matcher) ExpireTrips(now time.Time) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	expired := 0
+	for tripID, state := range m.trips {
+		if state.trip.Status.finished() && now.Sub(state.trip.UpdatedAt) > m.config.TripTTL {
+			delete(m.trips, tripID)
+			expired++
+		}
+	}
+	return expired
+}
+
+func (m *Matcher) Mode() Mode {
+	if m.batch != nil {
+		return ModeBatch
+	}
+	return ModeGreedy
+}
+
+func (m *Matcher) Close() {
+	if m.batch != nil {
+		close(m.batch.stop)
+		m.batch.wg.Wait()
+	}
+	close(m.stop)
+	m.wg.Wait()
+}
+
+func (m *Matcher) RequestRide(req RideRequest) (Trip, error) {
+	if err := validateRideRequest(&req); err != nil {
+		return Trip{}, err
+	}
+
+	now := time.Now()
+	state := &tripState{
+		trip: &Trip{
+			ID:        fmt.Sprintf("trip-%d", atomic.AddUint64(&m.nextID, 1)),
+			Request:   req,
+			Status:    TripSearching,
+			CreatedAt: now,
+			UpdatedAt: now,
+		},
+		responses: make(chan offerResponse, 1),
+	}
+
+	m.mu.Lock()
+	m.trips[state.trip.ID] = state
+	snapshot := state.trip.snapshot()
+	m.mu.Unlock()
+
+	if m.batch != nil {
+		m.enqueue(state)
+	} else {
+		go m.dispatch(state)
+	}
+	return snapshot, nil
+}
+
+func (m *Matcher) GetTrip(tripID string) (Trip, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	state, exists := m.trips[tripID]
+	if !exists {
+		return Trip{}, fmt.Errorf("%w: %s", ErrTripNotFound, tripID)
+	}
+	return state.trip.snapshot(), nil
+}
+
+func (m *Matcher) Accept(tripID, driverID string) (Trip, error) {
+	return m.respond(tripID, driverID, true)
+}
+
+func (m *Matcher) Decline(tripID, driverID string) (Trip, error) {
+	return m.respond(tripID, driverID, false)
+}
+
+func (m *Matcher) respond(tripID, driverID string, accepted bool) (Trip, error) {
+	result := make(chan error, 1)
+
+	m.mu.Lock()
+	state, exists := m.trips[tripID]
+	if !exists {
+		m.mu.Unlock()
+		return Trip{}, fmt.Errorf("%w: %s", ErrTripNotFound, tripID)
+	}
+	if state.trip.Status != TripOffered || state.trip.OfferedTo != driverID {
+		m.mu.Unlock()
+		return Trip{}, fmt.Errorf("%w: %s on %s", ErrNoActiveOffer, driverID, tripID)
+	}
+	select {
+	case state.responses <- offerResponse{driverID: driverID, accepted: accepted, result: result}:
+	default:
+		m.mu.Unlock()
+		return Trip{}, fmt.Errorf("%w: %s on %s", ErrNoActiveOffer, driverID, tripID)
+	}
+	m.mu.Unlock()
+
+	if err := <-result; err != nil {
+		return Trip{}, err
+	}
+	return m.GetTrip(tripID)
+}
+
+func (m *Matcher) dispatch(state *tripState) {
+	req := state.trip.Request
+	candidates, _, err := m.manager.FindNearest(
+		req.Pickup.Lat,
+		req.Pickup.Lng,
+		m.config.MaxCandidates,
+		m.config.SearchRadiusKm,
+		m.config.IndexType,
+		filterFor(req),
+	)
+	if err != nil {
+		fmt.Printf("Dispatch search error for %s: %v\n", state.trip.ID, err)
+	}
+
+	for _, candidate := range candidates {
+		if m.offer(state, candidate) {
+			return
+		}
+	}
+
+	m.mu.Lock()
+	state.trip.Status = TripNoDrivers
+	state.trip.UpdatedAt = time.Now()
+	m.mu.Unlock()
+}
+
+func filterFor(req RideRequest) models.SearchFilter {
+	filter := models.SearchFilter{}
+	if req.CarType != "" {
+		filter.CarTypes = []string{req.CarType}
+	}
+	return filter
+}
+
+func (m *Matcher) offer(state *tripState, candidate models.DriverWithDistance) bool {
+	driverID := candidate.Driver.ID
+	expires := time.Now().Add(m.config.OfferTimeout)
+
+	m.mu.Lock()
+	if _, busy := m.offers[driverID]; busy {
+		m.mu.Unlock()
+		return false
+	}
+	m.offers[driverID] = state.trip.ID
+	state.trip.Status = TripOffered
+	state.trip.OfferedTo = driverID
+	state.trip.OfferExpiresAt = &expires
+	state.trip.UpdatedAt = time.Now()
+	m.mu.Unlock()
+
+	timer := time.NewTimer(m.config.OfferTimeout)
+	defer timer.Stop()
+
+	var reply *offerResponse
+	var replyErr error
+	for reply == nil {
+		select {
+		case resp := <-state.responses:
+			if resp.driverID != driverID {
+				resp.result <- ErrNoActiveOffer
+				continue
+			}
+			reply = &resp
+			if resp.accepted {
+				replyErr = m.reserve(driverID)
+			}
+		case <-timer.C:
+			reply = &offerResponse{driverID: driverID}
+		}
+	}
+
+	accepted := reply.accepted && replyErr == nil
+
+	m.mu.Lock()
+	delete(m.offers, driverID)
+	state.trip.OfferedTo = ""
+	state.trip.OfferExpiresAt = nil
+	state.trip.UpdatedAt = time.Now()
+	if accepted {
+		state.trip.Status = TripAccepted
+		state.trip.DriverID = driverID
+		state.trip.PickupDistance = candidate.Distance
+	} else {
+		state.trip.Status = TripSearching
+		state.trip.Declined = append(state.trip.Declined, driverID)
+	}
+
+	for drained := false; !drained; {
+		select {
+		case resp := <-state.responses:
+			resp.result <- ErrNoActiveOffer
+		default:
+			drained = true
+		}
+	}
+	m.mu.Unlock()
+
+	if reply.result != nil {
+		reply.result <- replyErr
+	}
+	return accepted
+}
+
+func (m *Matcher) reserve(driverID string) error {
+	err := m.manager.UpdateStatusIf(driverID, models.StatusAvailable, models.StatusReserved, "dispatch")
+	if errors.Is(err, manager.ErrStatusConflict) || errors.Is(err, manager.ErrDriverNotFound) {
+		return fmt.Errorf("%w: %v", ErrDriverUnavailable, err)
+	}
+	return err
+}
@@ -0,0 +1,67 @@
+package dispatch
+
+import (
+	"time"
+	"uber-system/pkg/models"
+	"uber-system/pkg/validation"
+)
+
+type TripStatus string
+
+const (
+	TripSearching TripStatus = "searching"
+	TripOffered   TripStatus = "offered"
+	TripAccepted  TripStatus = "accepted"
+	TripAssigned  TripStatus = "assigned"
+	TripNoDrivers TripStatus = "no_drivers"
+)
+
+// finished reports whether a trip has left matching for good, so it can be
+// expired once nobody is likely to poll it.
+func (s TripStatus) finished() bool {
+	return s == TripAccepted || s == TripAssigned || s == TripNoDrivers
+}
+
+type RideRequest struct {
+	RiderID string          `json:"rider_id"`
+	Pickup  models.Location `json:"pickup"`
+	Dropoff models.Location `json:"dropoff"`
+	CarType string          `json:"car_type,omitempty"`
+}
+
+func validateRideRequest(req *RideRequest) error {
+	req.RiderID = validation.NormalizeID(req.RiderID)
+	req.CarType = validation.NormalizeCarType(req.CarType)
+
+	var errs validation.Errors
+	validation.CheckID(&errs, "rider_id", req.RiderID)
+	validation.CheckCoordinates(&errs, "pickup.", req.Pickup.Lat, req.Pickup.Lng)
+	if req.Dropoff != (models.Location{}) {
+		validation.CheckCoordinates(&errs, "dropoff.", req.Dropoff.Lat, req.Dropoff.Lng)
+	}
+	validation.CheckCarType(&errs, "car_type", req.CarType)
+	return errs.Err()
+}
+
+type Trip struct {
+	ID             string      `json:"id"`
+	Request        RideRequest `json:"request"`
+	Status         TripStatus  `json:"status"`
+	DriverID       string      `json:"driver_id,omitempty"`
+	OfferedTo      string      `json:"offered_to,omitempty"`
+	OfferExpiresAt *time.Time  `json:"offer_expires_at,omitempty"`
+	Declined       []string    `json:"declined,omitempty"`
+	PickupDistance float64     `json:"pickup_distance,omitempty"`
+	CreatedAt      time.Time   `json:"created_at"`
+	UpdatedAt      time.Time   `json:"updated_at"`
+}
+
+func (t *Trip) snapshot() Trip {
+	copied := *t
+	copied.Declined = append([]string(nil), t.Declined...)
+	if t.OfferExpiresAt != nil {
+		expires := *t.OfferExpiresAt
+		copied.OfferExpiresAt = &expires
+	}
+	return copied
+}
@@ -18,4 +18,3 @@ func Haversine(lat1, lng1, lat2, lng2 float64) float64 {
 	c := 2 * math.Atan2(math.Sqrt(a), math.Sqrt(1-a))
 	return EarthRadiusKm * c
 }
-
@@ -4,25 +4,32 @@ import (
 	"fmt"
 	"math"
 	"sync"
-	"uber-system/pkg/models"
 )
 
 type GridCell struct {
-	Drivers map[string]*models.Driver
-	mu      sync.RWMutex
+	Positions map[string]Position
+	mu        sync.RWMutex
 }
 
+const DefaultGridCellSizeKm = 0.5
+
 type GridIndex struct {
-	cells      map[string]*GridCell
-	cellSizeKm float64
-	boundary   BoundingBox
-	mu         sync.RWMutex
+	cells       map[string]*GridCell
+	driverCells map[string]string
+	cellSizeKm  float64
+	boundary    BoundingBox
+	minRow      int
+	maxRow      int
+	minCol      int
+	maxCol      int
+	mu          sync.RWMutex
 }
 
 func NewGridIndex(minLat, maxLat, minLng, maxLng, cellSizeKm float64) *GridIndex {
 	return &GridIndex{
-		cells:      make(map[string]*GridCell),
-		cellSizeKm: cellSizeKm,
+		cells:       make(map[string]*GridCell),
+		driverCells: make(map[string]string),
+		cellSizeKm:  cellSizeKm,
 		boundary: BoundingBox{
 			MinLat: minLat,
 			MaxLat: maxLat,
@@ -32,63 +39,111 @@ func NewGridIndex(minLat, maxLat, minLng, maxLng, cellSizeKm float64) *GridIndex
 	}
 }
 
-func (gi *GridIndex) getCellKey(lat, lng float64) string {
+func (gi *GridIndex) getCellCoords(lat, lng float64) (int, int) {
 	latDeg := gi.cellSizeKm / 111.0
 	lngDeg := gi.cellSizeKm / (111.0 * math.Cos(lat*math.Pi/180))
 	cellRow := int(math.Floor((lat - gi.boundary.MinLat) / latDeg))
 	cellCol := int(math.Floor((lng - gi.boundary.MinLng) / lngDeg))
-	return fmt.Sprintf("%d:%d", cellRow, cellCol)
+	return cellRow, cellCol
+}
+
+func cellKey(row, col int) string {
+	return fmt.Sprintf("%d:%d", row, col)
 }
 
-func (gi *GridIndex) Insert(driver *models.Driver) error {
-	key := gi.getCellKey(driver.Location.Lat, driver.Location.Lng)
+func (gi *GridIndex) Insert(position Position) error {
+	row, col := gi.getCellCoords(position.Lat, position.Lng)
+	key := cellKey(row, col)
 	gi.mu.Lock()
+	oldKey, indexed := gi.driverCells[position.ID]
 	cell, exists := gi.cells[key]
 	if !exists {
 		cell = &GridCell{
-			Drivers: make(map[string]*models.Driver),
+			Positions: make(map[string]Position),
 		}
+		gi.trackCell(row, col)
 		gi.cells[key] = cell
 	}
+	gi.driverCells[position.ID] = key
+	var oldCell *GridCell
+	if indexed && oldKey != key {
+		oldCell = gi.cells[oldKey]
+	}
 	gi.mu.Unlock()
 
+	if oldCell != nil {
+		oldCell.mu.Lock()
+		delete(oldCell.Positions, position.ID)
+		oldCell.mu.Unlock()
+	}
+
 	cell.mu.Lock()
-	cell.Drivers[driver.ID] = driver
+	cell.Positions[position.ID] = position
 	cell.mu.Unlock()
 	return nil
 }
 
-func (gi *GridIndex) Remove(driverID string, lat, lng float64) error {
-	key := gi.getCellKey(lat, lng)
-	gi.mu.RLock()
+func (gi *GridIndex) trackCell(row, col int) {
+	if len(gi.cells) == 0 {
+		gi.minRow, gi.maxRow, gi.minCol, gi.maxCol = row, row, col, col
+		return
+	}
+	if row < gi.minRow {
+		gi.minRow = row
+	}
+	if row > gi.maxRow {
+		gi.maxRow = row
+	}
+	if col < gi.minCol {
+		gi.minCol = col
+	}
+	if col > gi.maxCol {
+		gi.maxCol = col
+	}
+}
+
+func (gi *GridIndex) Remove(driverID string) error {
+	gi.mu.Lock()
+	key, indexed := gi.driverCells[driverID]
+	if !indexed {
+		gi.mu.Unlock()
+		return ErrDriverNotIndexed
+	}
+	delete(gi.driverCells, driverID)
 	cell, exists := gi.cells[key]
-	gi.mu.RUnlock()
+	gi.mu.Unlock()
 
 	if !exists {
 		return fmt.Errorf("cell not found")
 	}
 
 	cell.mu.Lock()
-	delete(cell.Drivers, driverID)
+	delete(cell.Positions, driverID)
 	cell.mu.Unlock()
 	return nil
 }
 
-func (gi *GridIndex) SearchRadius(lat, lng, radiusKm float64) []*models.Driver {
-	cellsToCheck := int(math.Ceil(radiusKm / gi.cellSizeKm))
-	centerKey := gi.getCellKey(lat, lng)
+func (gi *GridIndex) Update(position Position) error {
+	return gi.Insert(position)
+}
+
+func (gi *GridIndex) Len() int {
+	gi.mu.RLock()
+	defer gi.mu.RUnlock()
+	return len(gi.driverCells)
+}
 
-	var centerRow, centerCol int
-	fmt.Sscanf(centerKey, "%d:%d", &centerRow, &centerCol)
+func (gi *GridIndex) SearchRadius(lat, lng, radiusKm float64) []Position {
+	cellsToCheck := int(math.Ceil(radiusKm / gi.cellSizeKm))
+	centerRow, centerCol := gi.getCellCoords(lat, lng)
 
-	results := make([]*models.Driver, 0)
+	results := make([]Position, 0)
 	seen := make(map[string]bool)
 
 	for row := centerRow - cellsToCheck; row <= centerRow+cellsToCheck; row++ {
 		for col := centerCol - cellsToCheck; col <= centerCol+cellsToCheck; col++ {
-			cellKey := fmt.Sprintf("%d:%d", row, col)
 			gi.mu.RLock()
-			cell, exists := gi.cells[cellKey]
+			cell, exists := gi.cells[cellKey(row, col)]
 			gi.mu.RUnlock()
 
 			if !exists {
@@ -96,10 +151,10 @@ func (gi *GridIndex) SearchRadius(lat, lng, radiusKm float64) []*models.Driver {
 			}
 
 			cell.mu.RLock()
-			for _, driver := range cell.Drivers {
-				if !seen[driver.ID] {
-					results = append(results, driver)
-					seen[driver.ID] = true
+			for _, position := range cell.Positions {
+				if !seen[position.ID] {
+					results = append(results, position)
+					seen[position.ID] = true
 				}
 			}
 			cell.mu.RUnlock()
@@ -109,14 +164,96 @@ func (gi *GridIndex) SearchRadius(lat, lng, radiusKm float64) []*models.Driver {
 	return results
 }
 
-func (gi *GridIndex) GetStats() map[string]interface{} {
+func (gi *GridIndex) Nearest(lat, lng float64, k int, maxDistanceKm float64, filter Filter) []Neighbor {
+	candidates := make([]Neighbor, 0)
+	if k <= 0 {
+		return candidates
+	}
+
+	centerRow, centerCol := gi.getCellCoords(lat, lng)
+
+	gi.mu.RLock()
+	if len(gi.cells) == 0 {
+		gi.mu.RUnlock()
+		return candidates
+	}
+	maxRing := max(centerRow-gi.minRow, gi.maxRow-centerRow, centerCol-gi.minCol, gi.maxCol-centerCol)
+	gi.mu.RUnlock()
+
+	// Cells are locked one at a time, so a driver moving between cells
+	// during the scan can be visited in both.
+	seen := make(map[string]bool)
+	for ring := 0; ring <= maxRing; ring++ {
+		lowerBound := float64(ring-1) * gi.cellSizeKm
+		if !withinMaxDistance(lowerBound, maxDistanceKm) {
+			break
+		}
+		if len(candidates) >= k {
+			sortNeighbors(candidates)
+			if candidates[k-1].Distance <= lowerBound {
+				break
+			}
+		}
+
+		gi.scanRing(centerRow, centerCol, ring, func(position Position) {
+			if seen[position.ID] || !filter.accepts(position) {
+				return
+			}
+			seen[position.ID] = true
+			distance := Haversine(lat, lng, position.Lat, position.Lng)
+			if withinMaxDistance(distance, maxDistanceKm) {
+				candidates = append(candidates, Neighbor{Position: position, Distance: distance})
+			}
+		})
+	}
+
+	sortNeighbors(candidates)
+	if len(candidates) > k {
+		candidates = candidates[:k]
+	}
+	return candidates
+}
+
+func (gi *GridIndex) scanRing(centerRow, centerCol, ring int, visit func(position Position)) {
+	visitCell := func(row, col int) {
+		gi.mu.RLock()
+		cell, exists := gi.cells[cellKey(row, col)]
+		gi.mu.RUnlock()
+
+		if !exists {
+			return
+		}
+
+		cell.mu.RLock()
+		defer cell.mu.RUnlock()
+		for _, position := range cell.Positions {
+			visit(position)
+		}
+	}
+
+	if ring == 0 {
+		visitCell(centerRow, centerCol)
+		return
+	}
+
+	for col := centerCol - ring; col <= centerCol+ring; col++ {
+		visitCell(centerRow-ring, col)
+		visitCell(centerRow+ring, col)
+	}
+	for row := centerRow - ring + 1; row <= centerRow+ring-1; row++ {
+		visitCell(row, centerCol-ring)
+		visitCell(row, centerCol+ring)
+	}
+}
+
+func (gi *GridIndex) Stats() map[string]interface{} {
 	gi.mu.RLock()
 	defer gi.mu.RUnlock()
 
 	totalDrivers := 0
 	for _, cell := range gi.cells {
 		cell.mu.RLock()
-		totalDrivers += len(cell.Drivers)
+		totalDrivers += len(cell.Positions)
 		cell.mu.RUnlock()
 	}
 
@@ -126,4 +263,3 @@ func (gi *GridIndex) GetStats() map[string]interface{} {
 		"cell_size_km":  gi.cellSizeKm,
 	}
 }
-
@@ -0,0 +1,75 @@
+package geospatial
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+var (
+	ErrOutOfBounds      = errors.New("location outside index boundary")
+	ErrDriverNotIndexed = errors.New("driver not in index")
+)
+
+type SpatialIndex interface {
+	Insert(position Position) error
+	Remove(driverID string) error
+	Update(position Position) error
+	SearchRadius(lat, lng, radiusKm float64) []Position
+	Nearest(lat, lng float64, k int, maxDistanceKm float64, filter Filter) []Neighbor
+	Stats() map[string]interface{}
+	Len() int
+}
+
+type IndexFactory func(bounds BoundingBox) SpatialIndex
+
+type indexRegistry struct {
+	factories map[string]IndexFactory
+	mu        sync.RWMutex
+}
+
+var registry = &indexRegistry{
+	factories: make(map[string]IndexFactory),
+}
+
+func init() {
+	RegisterIndex("quadtree", func(bounds BoundingBox) SpatialIndex {
+		return NewQuadTree(bounds.MinLat, bounds.MaxLat, bounds.MinLng, bounds.MaxLng)
+	})
+	RegisterIndex("grid", func(bounds BoundingBox) SpatialIndex {
+		return NewGridIndex(bounds.MinLat, bounds.MaxLat, bounds.MinLng, bounds.MaxLng, DefaultGridCellSizeKm)
+	})
+	RegisterIndex("s2", func(bounds BoundingBox) SpatialIndex {
+		return NewS2Index(DefaultS2Level)
+	})
+}
+
+func RegisterIndex(name string, factory IndexFactory) {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+	registry.factories[name] = factory
+}
+
+func NewIndex(name string, bounds BoundingBox) (SpatialIndex, error) {
+	registry.mu.RLock()
+	factory, exists := registry.factories[name]
+	registry.mu.RUnlock()
+
+	if !exists {
+		return nil, fmt.Errorf("unknown index type: %s", name)
+	}
+	return factory(bounds), nil
+}
+
+func RegisteredIndexes() []string {
+	registry.mu.RLock()
+	defer registry.mu.RUnlock()
+
+	names := make([]string, 0, len(registry.factories))
+	for name := range registry.factories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
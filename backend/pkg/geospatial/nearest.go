@@ -0,0 +1,57 @@
+package geospatial
+
+import (
+	"container/heap"
+	"sort"
+)
+
+type Neighbor struct {
+	Position Position
+	Distance float64
+}
+
+type Filter func(position Position) bool
+
+func (f Filter) accepts(position Position) bool {
+	return f == nil || f(position)
+}
+
+func withinMaxDistance(distance, maxDistanceKm float64) bool {
+	return maxDistanceKm <= 0 || distance <= maxDistanceKm
+}
+
+func sortNeighbors(neighbors []Neighbor) {
+	sort.Slice(neighbors, func(i, j int) bool {
+		if neighbors[i].Distance == neighbors[j].Distance {
+			return neighbors[i].Position.ID < neighbors[j].Position.ID
+		}
+		return neighbors[i].Distance < neighbors[j].Distance
+	})
+}
+
+type queueItem struct {
+	distance float64
+	value    interface{}
+}
+
+type nearestQueue []queueItem
+
+func (q nearestQueue) Len() int            { return len(q) }
+func (q nearestQueue) Less(i, j int) bool  { return q[i].distance < q[j].distance }
+func (q nearestQueue) Swap(i, j int)       { q[i], q[j] = q[j], q[i] }
+func (q *nearestQueue) Push(x interface{}) { *q = append(*q, x.(queueItem)) }
+
+func (q *nearestQueue) Pop() interface{} {
+	old := *q
+	item := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return item
+}
+
+func (q *nearestQueue) push(distance float64, value interface{}) {
+	heap.Push(q, queueItem{distance: distance, value: value})
+}
+
+func (q *nearestQueue) pop() queueItem {
+	return heap.Pop(q).(queueItem)
+}
@@ -3,85 +3,159 @@ package geospatial
 import (
 	"math"
 	"sync"
-	"uber-system/pkg/models"
 )
 
 const (
-	MaxCapacity = 50
-	MaxDepth    = 8
+	DefaultQuadTreeMaxCapacity = 50
+	DefaultQuadTreeMaxDepth    = 8
+
+	// maxQuadTreeDepth keeps BuildQuadTree's Morton codes, two bits per
+	// level, within a uint64.
+	maxQuadTreeDepth = 31
 )
 
+// QuadTreeOptions tune one tree. A leaf splits once it holds MaxCapacity
+// positions, unless it is already MaxDepth levels deep: such a leaf keeps
+// accepting positions past capacity, so a dense spot like an airport pickup
+// zone degrades to a longer scan instead of rejecting drivers.
+//
+// CollapseThreshold is the subtree size at or below which a divided node
+// folds its children back into a single leaf. It defaults to half of
+// MaxCapacity so a node near the limit does not split and merge on every
+// other update. A zero MaxCapacity or MaxDepth takes the default.
+type QuadTreeOptions struct {
+	MaxCapacity       int
+	MaxDepth          int
+	CollapseThreshold int
+}
+
+func DefaultQuadTreeOptions() QuadTreeOptions {
+	return QuadTreeOptions{
+		MaxCapacity: DefaultQuadTreeMaxCapacity,
+		MaxDepth:    DefaultQuadTreeMaxDepth,
+	}
+}
+
+func (opts QuadTreeOptions) normalized() QuadTreeOptions {
+	if opts.MaxCapacity <= 0 {
+		opts.MaxCapacity = DefaultQuadTreeMaxCapacity
+	}
+	if opts.MaxDepth <= 0 {
+		opts.MaxDepth = DefaultQuadTreeMaxDepth
+	}
+	if opts.MaxDepth > maxQuadTreeDepth {
+		opts.MaxDepth = maxQuadTreeDepth
+	}
+	if opts.CollapseThreshold <= 0 || opts.CollapseThreshold >= opts.MaxCapacity {
+		opts.CollapseThreshold = opts.MaxCapacity / 2
+	}
+	return opts
+}
+
 type QuadTreeNode struct {
 	Boundary  BoundingBox
-	Drivers   []*models.Driver
+	Positions []Position
 	Depth     int
 	NorthWest *QuadTreeNode
 	NorthEast *QuadTreeNode
 	SouthWest *QuadTreeNode
 	SouthEast *QuadTreeNode
 	Divided   bool
+
+	parent *QuadTreeNode
+	count  int
 }
 
+// QuadTree keeps a back-reference from every driver ID to the leaf holding
+// it, so removals and moves go straight to the leaf instead of searching the
+// tree, and a move that stays inside its leaf is an in-place replacement.
 type QuadTree struct {
-	root *QuadTreeNode
-	mu   sync.RWMutex
+	root      *QuadTreeNode
+	opts      QuadTreeOptions
+	leaves    map[string]*QuadTreeNode
+	size      int
+	moves     int
+	collapses int
+	mu        sync.RWMutex
 }
 
 func NewQuadTree(minLat, maxLat, minLng, maxLng float64) *QuadTree {
+	return NewQuadTreeWithOptions(BoundingBox{
+		MinLat: minLat,
+		MaxLat: maxLat,
+		MinLng: minLng,
+		MaxLng: maxLng,
+	}, DefaultQuadTreeOptions())
+}
+
+func NewQuadTreeWithOptions(bounds BoundingBox, opts QuadTreeOptions) *QuadTree {
 	return &QuadTree{
 		root: &QuadTreeNode{
-			Boundary: BoundingBox{
-				MinLat: minLat,
-				MaxLat: maxLat,
-				MinLng: minLng,
-				MaxLng: maxLng,
-			},
-			Drivers: make([]*models.Driver, 0),
-			Depth:   0,
-			Divided: false,
+			Boundary:  bounds,
+			Positions: make([]Position, 0),
+			Depth:     0,
+			Divided:   false,
 		},
+		opts:   opts.normalized(),
+		leaves: make(map[string]*QuadTreeNode),
 	}
 }
 
-func (qt *QuadTree) Insert(driver *models.Driver) bool {
+func (qt *QuadTree) Options() QuadTreeOptions {
+	return qt.opts
+}
+
+// Insert adds position, replacing any entry already indexed for its ID.
+func (qt *QuadTree) Insert(position Position) error {
 	qt.mu.Lock()
 	defer qt.mu.Unlock()
-	return qt.root.insert(driver)
+	return qt.relocate(position)
 }
 
-func (node *QuadTreeNode) insert(driver *models.Driver) bool {
-	if !node.Boundary.Contains(driver.Location.Lat, driver.Location.Lng) {
-		return false
+func (qt *QuadTree) insert(node *QuadTreeNode, position Position) error {
+	if !node.Boundary.Contains(position.Lat, position.Lng) {
+		return ErrOutOfBounds
 	}
 
-	if len(node.Drivers) < MaxCapacity && !node.Divided {
-		node.Drivers = append(node.Drivers, driver)
-		return true
+	leaf := node.leafFor(position.Lat, position.Lng)
+	for len(leaf.Positions) >= qt.opts.MaxCapacity && leaf.Depth < qt.opts.MaxDepth {
+		qt.subdivide(leaf)
+		leaf = leaf.childFor(position.Lat, position.Lng)
 	}
 
-	if !node.Divided && node.Depth < MaxDepth {
-		node.subdivide()
+	leaf.Positions = append(leaf.Positions, position)
+	qt.leaves[position.ID] = leaf
+	for n := leaf; n != nil; n = n.parent {
+		n.count++
 	}
+	qt.size++
+	return nil
+}
 
-	if node.Divided {
-		if node.NorthWest.insert(driver) {
-			return true
-		}
-		if node.NorthEast.insert(driver) {
-			return true
-		}
-		if node.SouthWest.insert(driver) {
-			return true
-		}
-		if node.SouthEast.insert(driver) {
-			return true
-		}
+func (node *QuadTreeNode) childFor(lat, lng float64) *QuadTreeNode {
+	midLat := (node.Boundary.MinLat + node.Boundary.MaxLat) / 2
+	midLng := (node.Boundary.MinLng + node.Boundary.MaxLng) / 2
+
+	switch {
+	case lat >= midLat && lng < midLng:
+		return node.NorthWest
+	case lat >= midLat:
+		return node.NorthEast
+	case lng < midLng:
+		return node.SouthWest
+	default:
+		return node.SouthEast
 	}
+}
 
-	return false
+func (node *QuadTreeNode) leafFor(lat, lng float64) *QuadTreeNode {
+	for node.Divided {
+		node = node.childFor(lat, lng)
+	}
+	return node
 }
 
-func (node *QuadTreeNode) subdivide() {
+func (qt *QuadTree) subdivide(node *QuadTreeNode) {
 	midLat := (node.Boundary.MinLat + node.Boundary.MaxLat) / 2
 	midLng := (node.Boundary.MinLng + node.Boundary.MaxLng) / 2
 
@@ -92,8 +166,9 @@ func (node *QuadTreeNode) subdivide() {
 			MinLng: node.Boundary.MinLng,
 			MaxLng: midLng,
 		},
-		Drivers: make([]*models.Driver, 0),
-		Depth:   node.Depth + 1,
+		Positions: make([]Position, 0),
+		Depth:     node.Depth + 1,
+		parent:    node,
 	}
 
 	node.NorthEast = &QuadTreeNode{
@@ -103,8 +178,9 @@ func (node *QuadTreeNode) subdivide() {
 			MinLng: midLng,
 			MaxLng: node.Boundary.MaxLng,
 		},
-		Drivers: make([]*models.Driver, 0),
-		Depth:   node.Depth + 1,
+		Positions: make([]Position, 0),
+		Depth:     node.Depth + 1,
+		parent:    node,
 	}
 
 	node.SouthWest = &QuadTreeNode{
@@ -114,8 +190,9 @@ func (node *QuadTreeNode) subdivide() {
 			MinLng: node.Boundary.MinLng,
 			MaxLng: midLng,
 		},
-		Drivers: make([]*models.Driver, 0),
-		Depth:   node.Depth + 1,
+		Positions: make([]Position, 0),
+		Depth:     node.Depth + 1,
+		parent:    node,
 	}
 
 	node.SouthEast = &QuadTreeNode{
@@ -125,22 +202,26 @@ func (node *QuadTreeNode) subdivide() {
 			MinLng: midLng,
 			MaxLng: node.Boundary.MaxLng,
 		},
-		Drivers: make([]*models.Driver, 0),
-		Depth:   node.Depth + 1,
-	}
-
-	for _, driver := range node.Drivers {
-		node.NorthWest.insert(driver)
-		node.NorthEast.insert(driver)
-		node.SouthWest.insert(driver)
-		node.SouthEast.insert(driver)
+		Positions: make([]Position, 0),
+		Depth:     node.Depth + 1,
+		parent:    node,
 	}
 
-	node.Drivers = nil
 	node.Divided = true
+
+	// Each position moves to exactly one child. Children share their edges,
+	// so offering a position to every child that contains it would index a
+	// driver on a midline twice.
+	for _, position := range node.Positions {
+		child := node.childFor(position.Lat, position.Lng)
+		child.Positions = append(child.Positions, position)
+		child.count++
+		qt.leaves[position.ID] = child
+	}
+	node.Positions = nil
 }
 
-func (qt *QuadTree) SearchRadius(lat, lng, radiusKm float64) []*models.Driver {
+func (qt *QuadTree) SearchRadius(lat, lng, radiusKm float64) []Position {
 	qt.mu.RLock()
 	defer qt.mu.RUnlock()
 
@@ -154,29 +235,70 @@ func (qt *QuadTree) SearchRadius(lat, lng, radiusKm float64) []*models.Driver {
 		MaxLng: lng + lngDelta,
 	}
 
-	results := make([]*models.Driver, 0)
+	results := make([]Position, 0)
 	qt.root.searchInBoundary(&searchBox, &results)
 
-	filtered := make([]*models.Driver, 0)
-	for _, driver := range results {
-		dist := Haversine(lat, lng, driver.Location.Lat, driver.Location.Lng)
+	filtered := make([]Position, 0)
+	for _, position := range results {
+		dist := Haversine(lat, lng, position.Lat, position.Lng)
 		if dist <= radiusKm {
-			filtered = append(filtered, driver)
+			filtered = append(filtered, position)
 		}
 	}
 
 	return filtered
 }
 
-func (node *QuadTreeNode) searchInBoundary(searchBox *BoundingBox, results *[]*models.Driver) {
-	if !node.Boundary.Intersects(searchBox) {
+func (qt *QuadTree) Nearest(lat, lng float64, k int, maxDistanceKm float64, filter Filter) []Neighbor {
+	qt.mu.RLock()
+	defer qt.mu.RUnlock()
+
+	results := make([]Neighbor, 0)
+	if k <= 0 {
+		return results
+	}
+
+	queue := &nearestQueue{}
+	queue.push(qt.root.Boundary.MinDistanceKm(lat, lng), qt.root)
+
+	for queue.Len() > 0 && len(results) < k {
+		item := queue.pop()
+		if !withinMaxDistance(item.distance, maxDistanceKm) {
+			break
+		}
+
+		switch value := item.value.(type) {
+		case Position:
+			results = append(results, Neighbor{Position: value, Distance: item.distance})
+		case *QuadTreeNode:
+			if !value.Divided {
+				for _, position := range value.Positions {
+					if filter.accepts(position) {
+						queue.push(Haversine(lat, lng, position.Lat, position.Lng), position)
+					}
+				}
+				continue
+			}
+			for _, child := range []*QuadTreeNode{value.NorthWest, value.NorthEast, value.SouthWest, value.SouthEast} {
+				if child != nil && child.count > 0 {
+					queue.push(child.Boundary.MinDistanceKm(lat, lng), child)
+				}
+			}
+		}
+	}
+
+	return results
+}
+
+func (node *QuadTreeNode) searchInBoundary(searchBox *BoundingBox, results *[]Position) {
+	if node.count == 0 || !node.Boundary.Intersects(searchBox) {
 		return
 	}
 
 	if !node.Divided {
-		for _, driver := range node.Drivers {
-			if searchBox.Contains(driver.Location.Lat, driver.Location.Lng) {
-				*results = append(*results, driver)
+		for _, position := range node.Positions {
+			if searchBox.Contains(position.Lat, position.Lng) {
+				*results = append(*results, position)
 			}
 		}
 		return
@@ -196,26 +318,185 @@ func (node *QuadTreeNode) searchInBoundary(searchBox *BoundingBox, results *[]*m
 	}
 }
 
-func (qt *QuadTree) Remove(driverID string) bool {
+func (qt *QuadTree) Remove(driverID string) error {
 	qt.mu.Lock()
 	defer qt.mu.Unlock()
-	return qt.root.remove(driverID)
+
+	leaf, err := qt.detach(driverID)
+	if err != nil {
+		return err
+	}
+	qt.collapse(leaf.parent)
+	return nil
+}
+
+// detach takes driverID out of its leaf without collapsing any nodes.
+func (qt *QuadTree) detach(driverID string) (*QuadTreeNode, error) {
+	leaf, indexed := qt.leaves[driverID]
+	if !indexed {
+		return nil, ErrDriverNotIndexed
+	}
+
+	for i, position := range leaf.Positions {
+		if position.ID == driverID {
+			leaf.Positions = append(leaf.Positions[:i], leaf.Positions[i+1:]...)
+			break
+		}
+	}
+	delete(qt.leaves, driverID)
+	for n := leaf; n != nil; n = n.parent {
+		n.count--
+	}
+	qt.size--
+	return leaf, nil
 }
 
-func (node *QuadTreeNode) remove(driverID string) bool {
+// collapse folds the highest ancestor of node, node included, whose subtree
+// has shrunk to the collapse threshold back into a single leaf.
+func (qt *QuadTree) collapse(node *QuadTreeNode) {
+	var target *QuadTreeNode
+	for n := node; n != nil && n.count <= qt.opts.CollapseThreshold; n = n.parent {
+		target = n
+	}
+	if target == nil || !target.Divided {
+		return
+	}
+
+	positions := make([]Position, 0, target.count)
+	target.collect(&positions)
+	for _, position := range positions {
+		qt.leaves[position.ID] = target
+	}
+	target.Positions = positions
+	target.NorthWest, target.NorthEast, target.SouthWest, target.SouthEast = nil, nil, nil, nil
+	target.Divided = false
+	qt.collapses++
+}
+
+func (node *QuadTreeNode) collect(positions *[]Position) {
 	if !node.Divided {
-		for i, driver := range node.Drivers {
-			if driver.ID == driverID {
-				node.Drivers = append(node.Drivers[:i], node.Drivers[i+1:]...)
-				return true
+		*positions = append(*positions, node.Positions...)
+		return
+	}
+	for _, child := range []*QuadTreeNode{node.NorthWest, node.NorthEast, node.SouthWest, node.SouthEast} {
+		child.collect(positions)
+	}
+}
+
+// Update moves position's driver to its new coordinates, inserting it if it
+// is not indexed yet.
+func (qt *QuadTree) Update(position Position) error {
+	qt.mu.Lock()
+	defer qt.mu.Unlock()
+	return qt.relocate(position)
+}
+
+// Move relocates an indexed driver, keeping the rest of its entry.
+func (qt *QuadTree) Move(driverID string, lat, lng float64) error {
+	qt.mu.Lock()
+	defer qt.mu.Unlock()
+
+	leaf, indexed := qt.leaves[driverID]
+	if !indexed {
+		return ErrDriverNotIndexed
+	}
+	for _, position := range leaf.Positions {
+		if position.ID == driverID {
+			position.Lat, position.Lng = lat, lng
+			return qt.relocate(position)
+		}
+	}
+	return ErrDriverNotIndexed
+}
+
+// relocate replaces the entry in place when the new coordinates are still
+// inside its leaf. Otherwise the entry is re-inserted from the nearest
+// ancestor that contains them and the old branch is collapsed if it has
+// become sparse. Coordinates outside the tree leave the entry where it was.
+func (qt *QuadTree) relocate(position Position) error {
+	leaf, indexed := qt.leaves[position.ID]
+	if !indexed {
+		return qt.insert(qt.root, position)
+	}
+	if !qt.root.Boundary.Contains(position.Lat, position.Lng) {
+		return ErrOutOfBounds
+	}
+
+	if leaf.Boundary.Contains(position.Lat, position.Lng) {
+		for i := range leaf.Positions {
+			if leaf.Positions[i].ID == position.ID {
+				leaf.Positions[i] = position
+				qt.moves++
+				return nil
 			}
 		}
-		return false
 	}
 
-	return node.NorthWest.remove(driverID) ||
-		node.NorthEast.remove(driverID) ||
-		node.SouthWest.remove(driverID) ||
-		node.SouthEast.remove(driverID)
+	if _, err := qt.detach(position.ID); err != nil {
+		return err
+	}
+	start := leaf.parent
+	for start != nil && !start.Boundary.Contains(position.Lat, position.Lng) {
+		start = start.parent
+	}
+	if start == nil {
+		start = qt.root
+	}
+	err := qt.insert(start, position)
+	qt.collapse(leaf.parent)
+	return err
+}
+
+func (qt *QuadTree) Len() int {
+	qt.mu.RLock()
+	defer qt.mu.RUnlock()
+	return qt.size
 }
 
+func (qt *QuadTree) Stats() map[string]interface{} {
+	qt.mu.RLock()
+	defer qt.mu.RUnlock()
+
+	shape := qt.root.shape(qt.opts.MaxCapacity)
+	return map[string]interface{}{
+		"total_drivers":      qt.size,
+		"max_capacity":       qt.opts.MaxCapacity,
+		"max_depth":          qt.opts.MaxDepth,
+		"collapse_threshold": qt.opts.CollapseThreshold,
+		"nodes":              shape.nodes,
+		"leaves":             shape.leaves,
+		"depth":              shape.depth,
+		"overflow_leaves":    shape.overflowLeaves,
+		"largest_leaf":       shape.largestLeaf,
+		"in_place_moves":     qt.moves,
+		"collapses":          qt.collapses,
+	}
+}
+
+type treeShape struct {
+	nodes          int
+	leaves         int
+	depth          int
+	overflowLeaves int
+	largestLeaf    int
+}
+
+func (node *QuadTreeNode) shape(capacity int) treeShape {
+	if !node.Divided {
+		shape := treeShape{nodes: 1, leaves: 1, depth: node.Depth, largestLeaf: len(node.Positions)}
+		if len(node.Positions) > capacity {
+			shape.overflowLeaves = 1
+		}
+		return shape
+	}
+	shape := treeShape{nodes: 1, depth: node.Depth}
+	for _, child := range []*QuadTreeNode{node.NorthWest, node.NorthEast, node.SouthWest, node.SouthEast} {
+		childShape := child.shape(capacity)
+		shape.nodes += childShape.nodes
+		shape.leaves += childShape.leaves
+		shape.overflowLeaves += childShape.overflowLeaves
+		shape.depth = max(shape.depth, childShape.depth)
+		shape.largestLeaf = max(shape.largestLeaf, childShape.largestLeaf)
+	}
+	return shape
+}
@@ -0,0 +1,150 @@
+package geospatial
+
+import (
+	"fmt"
+	"math/rand"
+	"sync"
+	"testing"
+)
+
+// Bangalore's bounding box, with a pickup zone at its northern edge, on the
+// way to the airport, where hotspot drivers are packed into about 200 m.
+var (
+	benchBounds  = BoundingBox{MinLat: 12.8342, MaxLat: 13.1476, MinLng: 77.4577, MaxLng: 77.7878}
+	benchAirport = Position{Lat: 13.1389, Lng: 77.7068}
+)
+
+const (
+	benchDrivers          = 20000
+	benchHotspot          = 0.1
+	benchHotspotSpreadDeg = 0.002
+	benchRadiusKm         = 1
+	benchNearestK         = 10
+)
+
+var (
+	benchCapacities = []int{8, 16, 32, 50, 128}
+	benchDepths     = []int{6, 8, 10, 12}
+)
+
+type quadTreeFixture struct {
+	positions []Position
+	queries   []Position
+	moves     []Position
+}
+
+var (
+	benchFixtureOnce sync.Once
+	benchFixture     quadTreeFixture
+)
+
+func loadQuadTreeFixture() quadTreeFixture {
+	benchFixtureOnce.Do(func() {
+		r := rand.New(rand.NewSource(1))
+		benchFixture.positions = make([]Position, benchDrivers)
+		for i := range benchFixture.positions {
+			benchFixture.positions[i] = benchPosition(r, fmt.Sprintf("driver-%d", i), benchHotspot)
+		}
+		benchFixture.queries = make([]Position, 1024)
+		for i := range benchFixture.queries {
+			benchFixture.queries[i] = benchPosition(r, "", 0.5)
+		}
+		benchFixture.moves = make([]Position, 4096)
+		for i := range benchFixture.moves {
+			benchFixture.moves[i] = benchJitter(r, benchFixture.positions[r.Intn(benchDrivers)])
+		}
+	})
+	return benchFixture
+}
+
+func benchPosition(r *rand.Rand, id string, hotspot float64) Position {
+	if r.Float64() < hotspot {
+		return Position{
+			ID:  id,
+			Lat: benchAirport.Lat + (r.Float64()-0.5)*benchHotspotSpreadDeg,
+			Lng: benchAirport.Lng + (r.Float64()-0.5)*benchHotspotSpreadDeg,
+		}
+	}
+	return Position{
+		ID:  id,
+		Lat: benchBounds.MinLat + r.Float64()*(benchBounds.MaxLat-benchBounds.MinLat),
+		Lng: benchBounds.MinLng + r.Float64()*(benchBounds.MaxLng-benchBounds.MinLng),
+	}
+}
+
+// benchJitter moves a driver by up to about 50 m, the distance covered
+// between two pings in city traffic.
+func benchJitter(r *rand.Rand, position Position) Position {
+	position.Lat = min(max(position.Lat+(r.Float64()-0.5)*0.0009, benchBounds.MinLat), benchBounds.MaxLat)
+	position.Lng = min(max(position.Lng+(r.Float64()-0.5)*0.0009, benchBounds.MinLng), benchBounds.MaxLng)
+	return position
+}
+
+// benchQuadTrees runs fn as a sub-benchmark for every MaxCapacity and
+// MaxDepth pair, against a tree holding the fixture's drivers.
+func benchQuadTrees(b *testing.B, fn func(b *testing.B, qt *QuadTree, fixture quadTreeFixture)) {
+	fixture := loadQuadTreeFixture()
+	for _, capacity := range benchCapacities {
+		for _, depth := range benchDepths {
+			b.Run(fmt.Sprintf("capacity=%d/depth=%d", capacity, depth), func(b *testing.B) {
+				qt, err := BuildQuadTree(benchBounds, fixture.positions, QuadTreeOptions{MaxCapacity: capacity, MaxDepth: depth})
+				if err != nil {
+					b.Fatalf("BuildQuadTree: %v", err)
+				}
+				b.ResetTimer()
+				fn(b, qt, fixture)
+
+				shape := qt.root.shape(qt.opts.MaxCapacity)
+				b.ReportMetric(float64(shape.nodes), "nodes")
+				b.ReportMetric(float64(shape.largestLeaf), "largest-leaf")
+			})
+		}
+	}
+}
+
+func BenchmarkQuadTreeSearchRadius(b *testing.B) {
+	benchQuadTrees(b, func(b *testing.B, qt *QuadTree, fixture quadTreeFixture) {
+		for i := 0; i < b.N; i++ {
+			query := fixture.queries[i%len(fixture.queries)]
+			qt.SearchRadius(query.Lat, query.Lng, benchRadiusKm)
+		}
+	})
+}
+
+func BenchmarkQuadTreeNearest(b *testing.B) {
+	benchQuadTrees(b, func(b *testing.B, qt *QuadTree, fixture quadTreeFixture) {
+		for i := 0; i < b.N; i++ {
+			query := fixture.queries[i%len(fixture.queries)]
+			qt.Nearest(query.Lat, query.Lng, benchNearestK, 0, nil)
+		}
+	})
+}
+
+func BenchmarkQuadTreeUpdate(b *testing.B) {
+	benchQuadTrees(b, func(b *testing.B, qt *QuadTree, fixture quadTreeFixture) {
+		for i := 0; i < b.N; i++ {
+			if err := qt.Update(fixture.moves[i%len(fixture.moves)]); err != nil {
+				b.Fatalf("Update: %v", err)
+			}
+		}
+	})
+}
+
+func BenchmarkQuadTreeInsert(b *testing.B) {
+	fixture := loadQuadTreeFixture()
+	for _, capacity := range benchCapacities {
+		for _, depth := range benchDepths {
+			opts := QuadTreeOptions{MaxCapacity: capacity, MaxDepth: depth}
+			b.Run(fmt.Sprintf("capacity=%d/depth=%d", capacity, depth), func(b *testing.B) {
+				for i := 0; i < b.N; i++ {
+					qt := NewQuadTreeWithOptions(benchBounds, opts)
+					for _, position := range fixture.positions {
+						if err := qt.Insert(position); err != nil {
+							b.Fatalf("Insert %s: %v", position.ID, err)
+						}
+					}
+				}
+			})
+		}
+	}
+}
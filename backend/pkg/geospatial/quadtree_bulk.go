@@ -0,0 +1,111 @@
+package geospatial
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"sort"
+)
+
+// Rebuilder is implemented by indexes that can build a fresh copy of
+// themselves, with the same bounds and tuning, from a full set of positions
+// faster than inserting them one at a time.
+type Rebuilder interface {
+	Rebuild(positions []Position) (SpatialIndex, error)
+}
+
+// Rebuild bulk-loads a new tree with qt's bounds and options; qt is left
+// untouched.
+func (qt *QuadTree) Rebuild(positions []Position) (SpatialIndex, error) {
+	return BuildQuadTree(qt.root.Boundary, positions, qt.opts)
+}
+
+type mortonEntry struct {
+	code  uint64
+	index int
+}
+
+// BuildQuadTree bulk-loads a tree in one pass. Every position gets a Morton
+// code from the quadrant it falls in at each level down to MaxDepth, using
+// the same midpoint test as Insert; after sorting by code the positions of
+// any node form one contiguous run, so each node is built by splitting its
+// run into four and only subdividing runs larger than MaxCapacity. The
+// result has the same shape as inserting the positions one by one, without
+// re-distributing points on every split. Driver IDs must be unique.
+func BuildQuadTree(bounds BoundingBox, positions []Position, opts QuadTreeOptions) (*QuadTree, error) {
+	qt := NewQuadTreeWithOptions(bounds, opts)
+	qt.leaves = make(map[string]*QuadTreeNode, len(positions))
+
+	entries := make([]mortonEntry, len(positions))
+	for i, position := range positions {
+		if !bounds.Contains(position.Lat, position.Lng) {
+			return nil, fmt.Errorf("%w: %s at %f, %f", ErrOutOfBounds, position.ID, position.Lat, position.Lng)
+		}
+		entries[i] = mortonEntry{code: qt.mortonCode(position), index: i}
+	}
+	slices.SortFunc(entries, func(a, b mortonEntry) int { return cmp.Compare(a.code, b.code) })
+
+	if err := qt.build(qt.root, positions, entries); err != nil {
+		return nil, err
+	}
+	qt.size = len(entries)
+	return qt, nil
+}
+
+// mortonCode interleaves the north and east bits of position's quadrant at
+// each level, most significant level first.
+func (qt *QuadTree) mortonCode(position Position) uint64 {
+	var code uint64
+	box := qt.root.Boundary
+	for level := 0; level < qt.opts.MaxDepth; level++ {
+		midLat := (box.MinLat + box.MaxLat) / 2
+		midLng := (box.MinLng + box.MaxLng) / 2
+
+		var quadrant uint64
+		if position.Lat >= midLat {
+			quadrant |= 2
+			box.MinLat = midLat
+		} else {
+			box.MaxLat = midLat
+		}
+		if position.Lng >= midLng {
+			quadrant |= 1
+			box.MinLng = midLng
+		} else {
+			box.MaxLng = midLng
+		}
+		code = code<<2 | quadrant
+	}
+	return code << uint(2*(maxQuadTreeDepth-qt.opts.MaxDepth))
+}
+
+func (qt *QuadTree) build(node *QuadTreeNode, positions []Position, entries []mortonEntry) error {
+	node.count = len(entries)
+	if len(entries) <= qt.opts.MaxCapacity || node.Depth >= qt.opts.MaxDepth {
+		node.Positions = make([]Position, len(entries))
+		for i, entry := range entries {
+			position := positions[entry.index]
+			if _, duplicate := qt.leaves[position.ID]; duplicate {
+				return fmt.Errorf("duplicate position for driver %s", position.ID)
+			}
+			node.Positions[i] = position
+			qt.leaves[position.ID] = node
+		}
+		return nil
+	}
+
+	qt.subdivide(node)
+	shift := uint(2 * (maxQuadTreeDepth - node.Depth - 1))
+	children := [4]*QuadTreeNode{node.SouthWest, node.SouthEast, node.NorthWest, node.NorthEast}
+	start := 0
+	for quadrant, child := range children {
+		end := start + sort.Search(len(entries)-start, func(i int) bool {
+			return int(entries[start+i].code>>shift&3) > quadrant
+		})
+		if err := qt.build(child, positions, entries[start:end]); err != nil {
+			return err
+		}
+		start = end
+	}
+	return nil
+}
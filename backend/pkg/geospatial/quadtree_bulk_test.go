@@ -0,0 +1,92 @@
+package geospatial
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"slices"
+	"testing"
+)
+
+func TestBuildQuadTreeMatchesIncrementalInserts(t *testing.T) {
+	r := rand.New(rand.NewSource(7))
+	positions := make([]Position, 3000)
+	for i := range positions {
+		// A third of the drivers crowd the airport so some leaves reach
+		// MaxDepth and overflow.
+		positions[i] = benchPosition(r, fmt.Sprintf("driver-%d", i), 0.3)
+	}
+	queries := make([]Position, 50)
+	for i := range queries {
+		queries[i] = benchPosition(r, "", 0.3)
+	}
+
+	shapeKeys := []string{"total_drivers", "nodes", "leaves", "depth", "overflow_leaves", "largest_leaf"}
+	for _, opts := range []QuadTreeOptions{
+		{MaxCapacity: 4, MaxDepth: 6},
+		{MaxCapacity: 16, MaxDepth: 10},
+		{MaxCapacity: 50, MaxDepth: 8},
+	} {
+		t.Run(fmt.Sprintf("capacity=%d/depth=%d", opts.MaxCapacity, opts.MaxDepth), func(t *testing.T) {
+			built, err := BuildQuadTree(benchBounds, positions, opts)
+			if err != nil {
+				t.Fatalf("BuildQuadTree: %v", err)
+			}
+			inserted := NewQuadTreeWithOptions(benchBounds, opts)
+			insertAll(t, inserted, positions...)
+			checkQuadTree(t, built)
+
+			builtStats, insertedStats := built.Stats(), inserted.Stats()
+			for _, key := range shapeKeys {
+				if builtStats[key] != insertedStats[key] {
+					t.Errorf("%s = %v built, %v inserted", key, builtStats[key], insertedStats[key])
+				}
+			}
+
+			for _, query := range queries {
+				builtIDs := sortedIDs(built.SearchRadius(query.Lat, query.Lng, 2))
+				insertedIDs := sortedIDs(inserted.SearchRadius(query.Lat, query.Lng, 2))
+				if !slices.Equal(builtIDs, insertedIDs) {
+					t.Fatalf("SearchRadius at %v,%v: built found %d, inserted %d", query.Lat, query.Lng, len(builtIDs), len(insertedIDs))
+				}
+
+				builtNearest := built.Nearest(query.Lat, query.Lng, 10, 0, nil)
+				insertedNearest := inserted.Nearest(query.Lat, query.Lng, 10, 0, nil)
+				if len(builtNearest) != len(insertedNearest) {
+					t.Fatalf("Nearest at %v,%v: built found %d, inserted %d", query.Lat, query.Lng, len(builtNearest), len(insertedNearest))
+				}
+				for i := range builtNearest {
+					if builtNearest[i].Position.ID != insertedNearest[i].Position.ID {
+						t.Fatalf("Nearest at %v,%v differs at %d: %s built, %s inserted", query.Lat, query.Lng, i, builtNearest[i].Position.ID, insertedNearest[i].Position.ID)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestBuildQuadTreeRejectsBadInput(t *testing.T) {
+	inside := Position{ID: "driver-1", Lat: 0.5, Lng: 0.5}
+	if _, err := BuildQuadTree(unitBounds, []Position{inside, {ID: "driver-2", Lat: 1.5, Lng: 0.5}}, QuadTreeOptions{}); !errors.Is(err, ErrOutOfBounds) {
+		t.Fatalf("out of bounds = %v, want ErrOutOfBounds", err)
+	}
+	if _, err := BuildQuadTree(unitBounds, []Position{inside, inside}, QuadTreeOptions{}); err == nil {
+		t.Fatal("duplicate IDs were accepted")
+	}
+
+	qt, err := BuildQuadTree(unitBounds, nil, QuadTreeOptions{})
+	if err != nil || qt.Len() != 0 {
+		t.Fatalf("empty build = %d drivers, %v", qt.Len(), err)
+	}
+	insertAll(t, qt, inside)
+	checkQuadTree(t, qt)
+}
+
+func sortedIDs(positions []Position) []string {
+	ids := make([]string, len(positions))
+	for i, position := range positions {
+		ids[i] = position.ID
+	}
+	slices.Sort(ids)
+	return ids
+}
@@ -0,0 +1,223 @@
+package geospatial
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+var unitBounds = BoundingBox{MinLat: 0, MaxLat: 1, MinLng: 0, MaxLng: 1}
+
+func newSmallQuadTree() *QuadTree {
+	return NewQuadTreeWithOptions(unitBounds, QuadTreeOptions{MaxCapacity: 4, MaxDepth: 4})
+}
+
+func insertAll(t *testing.T, qt *QuadTree, positions ...Position) {
+	t.Helper()
+	for _, position := range positions {
+		if err := qt.Insert(position); err != nil {
+			t.Fatalf("Insert %s: %v", position.ID, err)
+		}
+	}
+}
+
+// checkQuadTree walks the tree and fails t unless every count, parent link
+// and leaf back-reference agrees with where positions actually are.
+func checkQuadTree(t *testing.T, qt *QuadTree) {
+	t.Helper()
+	qt.mu.RLock()
+	defer qt.mu.RUnlock()
+
+	found := 0
+	var walk func(node *QuadTreeNode) int
+	walk = func(node *QuadTreeNode) int {
+		if !node.Divided {
+			for _, position := range node.Positions {
+				if !node.Boundary.Contains(position.Lat, position.Lng) {
+					t.Errorf("%s at %v,%v is outside its leaf %+v", position.ID, position.Lat, position.Lng, node.Boundary)
+				}
+				if qt.leaves[position.ID] != node {
+					t.Errorf("back-reference for %s does not point at its leaf", position.ID)
+				}
+			}
+			found += len(node.Positions)
+			if node.count != len(node.Positions) {
+				t.Errorf("leaf at depth %d counts %d, holds %d", node.Depth, node.count, len(node.Positions))
+			}
+			return node.count
+		}
+		if len(node.Positions) != 0 {
+			t.Errorf("divided node at depth %d holds %d positions", node.Depth, len(node.Positions))
+		}
+		total := 0
+		for _, child := range []*QuadTreeNode{node.NorthWest, node.NorthEast, node.SouthWest, node.SouthEast} {
+			if child.parent != node || child.Depth != node.Depth+1 {
+				t.Errorf("child of node at depth %d has a wrong parent or depth", node.Depth)
+			}
+			total += walk(child)
+		}
+		if node.count != total {
+			t.Errorf("node at depth %d counts %d, subtree holds %d", node.Depth, node.count, total)
+		}
+		return node.count
+	}
+	walk(qt.root)
+
+	if found != qt.size || len(qt.leaves) != qt.size {
+		t.Errorf("tree holds %d positions with %d back-references, size is %d", found, len(qt.leaves), qt.size)
+	}
+}
+
+func checkShape(t *testing.T, qt *QuadTree, nodes, depth int) {
+	t.Helper()
+	stats := qt.Stats()
+	if stats["nodes"] != nodes || stats["depth"] != depth {
+		t.Fatalf("shape = %v nodes, depth %v, want %d nodes, depth %d", stats["nodes"], stats["depth"], nodes, depth)
+	}
+}
+
+func ids(positions []Position) map[string]Position {
+	byID := make(map[string]Position, len(positions))
+	for _, position := range positions {
+		byID[position.ID] = position
+	}
+	return byID
+}
+
+// fivePositions holds one more position than a leaf, four of them in the
+// north-east quadrant, so the root splits exactly once.
+func fivePositions() []Position {
+	positions := make([]Position, 0, 5)
+	for i := 0; i < 4; i++ {
+		positions = append(positions, Position{ID: fmt.Sprintf("ne-%d", i), Lat: 0.6 + float64(i)*0.05, Lng: 0.6 + float64(i)*0.05})
+	}
+	return append(positions, Position{ID: "nw-0", Lat: 0.8, Lng: 0.2})
+}
+
+func TestQuadTreeInsertSplitsFullLeaf(t *testing.T) {
+	qt := newSmallQuadTree()
+	insertAll(t, qt, fivePositions()[:4]...)
+	checkShape(t, qt, 1, 0)
+
+	insertAll(t, qt, fivePositions()[4])
+	checkShape(t, qt, 5, 1)
+	checkQuadTree(t, qt)
+	if qt.Len() != 5 {
+		t.Fatalf("Len = %d, want 5", qt.Len())
+	}
+
+	// Re-inserting an indexed ID replaces its entry.
+	insertAll(t, qt, Position{ID: "ne-0", Lat: 0.61, Lng: 0.61})
+	if qt.Len() != 5 {
+		t.Fatalf("Len after re-insert = %d, want 5", qt.Len())
+	}
+	checkQuadTree(t, qt)
+}
+
+func TestQuadTreeMoveWithinLeafIsInPlace(t *testing.T) {
+	qt := newSmallQuadTree()
+	insertAll(t, qt, fivePositions()...)
+	insertAll(t, qt, Position{ID: "sw-0", Lat: 0.2, Lng: 0.2})
+
+	if err := qt.Move("sw-0", 0.3, 0.1); err != nil {
+		t.Fatalf("Move: %v", err)
+	}
+	if moves := qt.Stats()["in_place_moves"]; moves != 1 {
+		t.Fatalf("in_place_moves = %v, want 1", moves)
+	}
+	checkShape(t, qt, 5, 1)
+	checkQuadTree(t, qt)
+	if got := ids(qt.SearchRadius(0.3, 0.1, 1)); got["sw-0"].Lat != 0.3 {
+		t.Fatalf("sw-0 not found at its new position: %v", got["sw-0"])
+	}
+}
+
+func TestQuadTreeMoveAcrossQuadrants(t *testing.T) {
+	qt := newSmallQuadTree()
+	insertAll(t, qt, fivePositions()...)
+
+	if err := qt.Update(Position{ID: "ne-2", Lat: 0.1, Lng: 0.1}); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	checkQuadTree(t, qt)
+	if qt.Len() != 5 {
+		t.Fatalf("Len = %d, want 5", qt.Len())
+	}
+	if leaf := qt.leaves["ne-2"]; leaf != qt.root.SouthWest {
+		t.Fatalf("ne-2 is in the leaf at %+v, want the south-west quadrant", leaf.Boundary)
+	}
+	if _, found := ids(qt.SearchRadius(0.7, 0.7, 1))["ne-2"]; found {
+		t.Fatal("ne-2 still found at its old position")
+	}
+	neighbors := qt.Nearest(0.1, 0.1, 1, 0, nil)
+	if len(neighbors) != 1 || neighbors[0].Position.ID != "ne-2" {
+		t.Fatalf("Nearest = %+v, want ne-2", neighbors)
+	}
+}
+
+func TestQuadTreeRemoveCollapsesSparseBranch(t *testing.T) {
+	qt := newSmallQuadTree()
+	positions := fivePositions()
+	insertAll(t, qt, positions...)
+
+	// The collapse threshold defaults to half of MaxCapacity.
+	for _, position := range positions[:2] {
+		if err := qt.Remove(position.ID); err != nil {
+			t.Fatalf("Remove %s: %v", position.ID, err)
+		}
+	}
+	checkShape(t, qt, 5, 1)
+	if err := qt.Remove(positions[2].ID); err != nil {
+		t.Fatalf("Remove: %v", err)
+	}
+	checkShape(t, qt, 1, 0)
+	if collapses := qt.Stats()["collapses"]; collapses != 1 {
+		t.Fatalf("collapses = %v, want 1", collapses)
+	}
+	checkQuadTree(t, qt)
+	if qt.Len() != 2 {
+		t.Fatalf("Len = %d, want 2", qt.Len())
+	}
+
+	if err := qt.Remove(positions[0].ID); !errors.Is(err, ErrDriverNotIndexed) {
+		t.Fatalf("second Remove = %v, want ErrDriverNotIndexed", err)
+	}
+	if err := qt.Move("missing", 0.5, 0.5); !errors.Is(err, ErrDriverNotIndexed) {
+		t.Fatalf("Move of an unknown driver = %v, want ErrDriverNotIndexed", err)
+	}
+}
+
+func TestQuadTreeMoveOutOfBoundsKeepsDriver(t *testing.T) {
+	qt := newSmallQuadTree()
+	insertAll(t, qt, fivePositions()...)
+
+	if err := qt.Update(Position{ID: "ne-1", Lat: 1.5, Lng: 0.5}); !errors.Is(err, ErrOutOfBounds) {
+		t.Fatalf("Update out of bounds = %v, want ErrOutOfBounds", err)
+	}
+	if err := qt.Move("ne-1", -0.5, 0.5); !errors.Is(err, ErrOutOfBounds) {
+		t.Fatalf("Move out of bounds = %v, want ErrOutOfBounds", err)
+	}
+	if err := qt.Insert(Position{ID: "outside", Lat: 2, Lng: 2}); !errors.Is(err, ErrOutOfBounds) {
+		t.Fatalf("Insert out of bounds = %v, want ErrOutOfBounds", err)
+	}
+	checkQuadTree(t, qt)
+	if qt.Len() != 5 {
+		t.Fatalf("Len = %d, want 5", qt.Len())
+	}
+	if got := ids(qt.SearchRadius(0.65, 0.65, 1)); got["ne-1"].Lat != 0.65 {
+		t.Fatalf("ne-1 not found at its old position: %v", got["ne-1"])
+	}
+}
+
+func TestQuadTreeOptionsZeroTakesDefaults(t *testing.T) {
+	qt := NewQuadTreeWithOptions(unitBounds, QuadTreeOptions{MaxCapacity: 4})
+	if opts := qt.Options(); opts.MaxDepth != DefaultQuadTreeMaxDepth || opts.CollapseThreshold != 2 {
+		t.Fatalf("Options = %+v, want default depth and half-capacity threshold", opts)
+	}
+	insertAll(t, qt, fivePositions()...)
+	checkShape(t, qt, 5, 1)
+
+	if opts := NewQuadTreeWithOptions(unitBounds, QuadTreeOptions{}).Options(); opts != DefaultQuadTreeOptions().normalized() {
+		t.Fatalf("Options = %+v, want the defaults", opts)
+	}
+}
@@ -0,0 +1,209 @@
+package geospatial
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+const (
+	DefaultS2Level         = 13
+	DefaultS2MaxCoverCells = 16
+)
+
+type S2Index struct {
+	level       int
+	cells       map[CellID]map[string]Position
+	sortedCells []CellID
+	driverCells map[string]CellID
+	coverer     RegionCoverer
+	mu          sync.RWMutex
+}
+
+func NewS2Index(level int) *S2Index {
+	if level < 0 {
+		level = 0
+	}
+	if level > S2MaxLevel {
+		level = S2MaxLevel
+	}
+	return &S2Index{
+		level:       level,
+		cells:       make(map[CellID]map[string]Position),
+		sortedCells: make([]CellID, 0),
+		driverCells: make(map[string]CellID),
+		coverer: RegionCoverer{
+			MinLevel: 0,
+			MaxLevel: level,
+			MaxCells: DefaultS2MaxCoverCells,
+		},
+	}
+}
+
+func (si *S2Index) Level() int {
+	return si.level
+}
+
+func (si *S2Index) Insert(position Position) error {
+	cell := CellIDFromLatLng(position.Lat, position.Lng).Parent(si.level)
+	if !cell.IsValid() {
+		return fmt.Errorf("invalid S2 cell for location: %f, %f", position.Lat, position.Lng)
+	}
+
+	si.mu.Lock()
+	defer si.mu.Unlock()
+
+	if oldCell, exists := si.driverCells[position.ID]; exists {
+		si.removeFromCell(position.ID, oldCell)
+	}
+
+	positions, exists := si.cells[cell]
+	if !exists {
+		positions = make(map[string]Position)
+		si.cells[cell] = positions
+		si.insertSorted(cell)
+	}
+	positions[position.ID] = position
+	si.driverCells[position.ID] = cell
+	return nil
+}
+
+func (si *S2Index) Remove(driverID string) error {
+	si.mu.Lock()
+	defer si.mu.Unlock()
+
+	cell, exists := si.driverCells[driverID]
+	if !exists {
+		return ErrDriverNotIndexed
+	}
+	si.removeFromCell(driverID, cell)
+	delete(si.driverCells, driverID)
+	return nil
+}
+
+func (si *S2Index) Update(position Position) error {
+	return si.Insert(position)
+}
+
+func (si *S2Index) Len() int {
+	si.mu.RLock()
+	defer si.mu.RUnlock()
+	return len(si.driverCells)
+}
+
+func (si *S2Index) removeFromCell(driverID string, cell CellID) {
+	positions, exists := si.cells[cell]
+	if !exists {
+		return
+	}
+	delete(positions, driverID)
+	if len(positions) == 0 {
+		delete(si.cells, cell)
+		si.removeSorted(cell)
+	}
+}
+
+func (si *S2Index) insertSorted(cell CellID) {
+	i := sort.Search(len(si.sortedCells), func(k int) bool { return si.sortedCells[k] >= cell })
+	si.sortedCells = append(si.sortedCells, 0)
+	copy(si.sortedCells[i+1:], si.sortedCells[i:])
+	si.sortedCells[i] = cell
+}
+
+func (si *S2Index) removeSorted(cell CellID) {
+	i := sort.Search(len(si.sortedCells), func(k int) bool { return si.sortedCells[k] >= cell })
+	if i < len(si.sortedCells) && si.sortedCells[i] == cell {
+		si.sortedCells = append(si.sortedCells[:i], si.sortedCells[i+1:]...)
+	}
+}
+
+func (si *S2Index) Covering(lat, lng, radiusKm float64) []CellID {
+	return si.coverer.CoverCap(CapFromRadiusKm(lat, lng, radiusKm))
+}
+
+func (si *S2Index) SearchRadius(lat, lng, radiusKm float64) []Position {
+	covering := si.Covering(lat, lng, radiusKm)
+
+	si.mu.RLock()
+	defer si.mu.RUnlock()
+
+	results := make([]Position, 0)
+	for _, coverCell := range covering {
+		min, max := coverCell.RangeMin(), coverCell.RangeMax()
+		start := sort.Search(len(si.sortedCells), func(k int) bool { return si.sortedCells[k] >= min })
+		for k := start; k < len(si.sortedCells) && si.sortedCells[k] <= max; k++ {
+			for _, position := range si.cells[si.sortedCells[k]] {
+				if Haversine(lat, lng, position.Lat, position.Lng) <= radiusKm {
+					results = append(results, position)
+				}
+			}
+		}
+	}
+
+	return results
+}
+
+func (si *S2Index) Stats() map[string]interface{} {
+	si.mu.RLock()
+	defer si.mu.RUnlock()
+
+	return map[string]interface{}{
+		"level":         si.level,
+		"total_cells":   len(si.cells),
+		"total_drivers": len(si.driverCells),
+	}
+}
+
+func (si *S2Index) Nearest(lat, lng float64, k int, maxDistanceKm float64, filter Filter) []Neighbor {
+	results := make([]Neighbor, 0)
+	if k <= 0 {
+		return results
+	}
+
+	target := PointFromLatLng(lat, lng)
+
+	si.mu.RLock()
+	defer si.mu.RUnlock()
+
+	queue := &nearestQueue{}
+	for face := 0; face < s2NumFaces; face++ {
+		cell := CellIDFromFace(face)
+		if si.occupied(cell) {
+			queue.push(cell.Distance(target)*EarthRadiusKm, cell)
+		}
+	}
+
+	for queue.Len() > 0 && len(results) < k {
+		item := queue.pop()
+		if !withinMaxDistance(item.distance, maxDistanceKm) {
+			break
+		}
+
+		switch value := item.value.(type) {
+		case Position:
+			results = append(results, Neighbor{Position: value, Distance: item.distance})
+		case CellID:
+			if value.Level() >= si.level {
+				for _, position := range si.cells[value] {
+					if filter.accepts(position) {
+						queue.push(Haversine(lat, lng, position.Lat, position.Lng), position)
+					}
+				}
+				continue
+			}
+			for _, child := range value.Children() {
+				if si.occupied(child) {
+					queue.push(child.Distance(target)*EarthRadiusKm, child)
+				}
+			}
+		}
+	}
+
+	return results
+}
+
+func (si *S2Index) occupied(cell CellID) bool {
+	min := cell.RangeMin()
+	i := sort.Search(len(si.sortedCells), func(k int) bool { return si.sortedCells[k] >= min })
+	return i < len(si.sortedCells) && si.sortedCells[i] <= cell.RangeMax()
+}
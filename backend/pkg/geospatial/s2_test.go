@@ -0,0 +1,248 @@
+package geospatial
+
+import (
+	"cmp"
+	"fmt"
+	"math"
+	"math/rand"
+	"slices"
+	"sort"
+	"testing"
+)
+
+// cellCenter approximates a cell's center by its normalized vertex sum.
+func cellCenter(cell CellID) Point {
+	var sum Point
+	for _, v := range cell.Vertices() {
+		sum.X, sum.Y, sum.Z = sum.X+v.X, sum.Y+v.Y, sum.Z+v.Z
+	}
+	return sum.Normalize()
+}
+
+func randomLatLng(r *rand.Rand) (float64, float64) {
+	// Uniform over the sphere rather than over the lat/lng rectangle, so the
+	// poles are not oversampled.
+	return math.Asin(2*r.Float64()-1) * 180 / math.Pi, r.Float64()*360 - 180
+}
+
+func TestCellIDFaces(t *testing.T) {
+	tests := []struct {
+		lat, lng float64
+		face     int
+		id       CellID
+	}{
+		{0, 0, 0, 0x1000000000000000},
+		{0, 90, 1, 0x3000000000000000},
+		{90, 0, 2, 0x5000000000000000},
+		{0, 180, 3, 0x7000000000000000},
+		{0, -90, 4, 0x9000000000000000},
+		{-90, 0, 5, 0xb000000000000000},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("face %d", tt.face), func(t *testing.T) {
+			leaf := CellIDFromLatLng(tt.lat, tt.lng)
+			if leaf.Face() != tt.face {
+				t.Fatalf("face of %v,%v = %d, want %d", tt.lat, tt.lng, leaf.Face(), tt.face)
+			}
+			face := CellIDFromFace(tt.face)
+			if face != tt.id || face.Level() != 0 || !face.IsValid() {
+				t.Fatalf("face cell = %#x level %d, want %#x level 0", uint64(face), face.Level(), uint64(tt.id))
+			}
+			if leaf.Parent(0) != face || !face.Contains(leaf) {
+				t.Fatalf("face cell does not contain %v,%v", tt.lat, tt.lng)
+			}
+		})
+	}
+}
+
+func TestCellIDRoundTrip(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for n := 0; n < 1000; n++ {
+		lat, lng := randomLatLng(r)
+		point := PointFromLatLng(lat, lng)
+		leaf := CellIDFromLatLng(lat, lng)
+		if !leaf.IsValid() || !leaf.IsLeaf() || leaf.Level() != S2MaxLevel {
+			t.Fatalf("%v,%v: leaf %#x valid %v, level %d", lat, lng, uint64(leaf), leaf.IsValid(), leaf.Level())
+		}
+		// A leaf cell is about a centimetre across.
+		if km := cellCenter(leaf).Angle(point) * EarthRadiusKm; km > 1e-4 {
+			t.Fatalf("%v,%v: leaf center is %.2g km away", lat, lng, km)
+		}
+
+		face, u, v := xyzToFaceUV(point)
+		if back := faceUVToXYZ(face, u, v).Normalize(); back.Angle(point) > 1e-12 {
+			t.Fatalf("%v,%v: face %d uv round trip is off by %g rad", lat, lng, face, back.Angle(point))
+		}
+		if s := uvToST(u); math.Abs(stToUV(s)-u) > 1e-12 {
+			t.Fatalf("st round trip of u=%v gives %v", u, stToUV(s))
+		}
+
+		face, i, j := r.Intn(s2NumFaces), r.Intn(s2MaxSize), r.Intn(s2MaxSize)
+		if f, gotI, gotJ := cellIDFromFaceIJ(face, i, j).faceIJ(); f != face || gotI != i || gotJ != j {
+			t.Fatalf("face/ij round trip of %d,%d,%d gives %d,%d,%d", face, i, j, f, gotI, gotJ)
+		}
+	}
+}
+
+func TestCellIDParentsAndChildren(t *testing.T) {
+	r := rand.New(rand.NewSource(2))
+	for n := 0; n < 200; n++ {
+		lat, lng := randomLatLng(r)
+		leaf := CellIDFromLatLng(lat, lng)
+		point := PointFromLatLng(lat, lng)
+
+		for level := 0; level < S2MaxLevel; level++ {
+			parent := leaf.Parent(level)
+			if parent.Level() != level || !parent.IsValid() || parent.IsLeaf() {
+				t.Fatalf("Parent(%d) = %#x at level %d", level, uint64(parent), parent.Level())
+			}
+			if !parent.Contains(leaf) || !parent.ContainsPoint(point) || parent.Distance(point) != 0 {
+				t.Fatalf("level %d parent does not contain its leaf", level)
+			}
+
+			children := parent.Children()
+			if children[0].RangeMin() != parent.RangeMin() || children[3].RangeMax() != parent.RangeMax() {
+				t.Fatalf("level %d children do not span their parent", level)
+			}
+			holding := 0
+			for k, child := range children {
+				if child.Level() != level+1 || child.Parent(level) != parent || !parent.Contains(child) {
+					t.Fatalf("child %d of a level %d cell is at level %d", k, level, child.Level())
+				}
+				if k > 0 && children[k-1].RangeMax() >= child.RangeMin() {
+					t.Fatalf("children of a level %d cell overlap", level)
+				}
+				if child.Contains(leaf) {
+					holding++
+				}
+			}
+			if holding != 1 {
+				t.Fatalf("%d children of a level %d cell contain the leaf, want 1", holding, level)
+			}
+		}
+	}
+}
+
+func TestCellIDFaceEdges(t *testing.T) {
+	// Points on the edges and corners shared by two or three faces.
+	edges := [][2]float64{
+		{0, 45}, {0, 135}, {0, -45}, {0, -135},
+		{35.264389682754654, 45}, {-35.264389682754654, -135},
+		{45, 0}, {-45, 180}, {89.999999, 10}, {-89.999999, -10},
+	}
+	for _, edge := range edges {
+		lat, lng := edge[0], edge[1]
+		point := PointFromLatLng(lat, lng)
+		leaf := CellIDFromLatLng(lat, lng)
+		if !leaf.IsValid() {
+			t.Fatalf("%v,%v: invalid cell %#x", lat, lng, uint64(leaf))
+		}
+		for level := 0; level <= S2MaxLevel; level += 5 {
+			cell := leaf.Parent(level)
+			if km := cell.Distance(point) * EarthRadiusKm; km > 1e-6 {
+				t.Fatalf("%v,%v: level %d cell is %.2g km from the point", lat, lng, level, km)
+			}
+		}
+	}
+
+	// The antimeridian runs down the middle of face 3, so both sides of it
+	// land on the same face in touching cells.
+	east, west := CellIDFromLatLng(12, 180), CellIDFromLatLng(12, -180)
+	if east.Face() != 3 || west.Face() != 3 {
+		t.Fatalf("antimeridian faces = %d and %d, want 3", east.Face(), west.Face())
+	}
+	if km := east.Parent(20).Distance(PointFromLatLng(12, -180)) * EarthRadiusKm; km > 1e-6 {
+		t.Fatalf("antimeridian cells are %.2g km apart", km)
+	}
+}
+
+func TestCellIDDistance(t *testing.T) {
+	cell := CellIDFromLatLng(12.97, 77.59).Parent(13)
+	if d := cell.Distance(PointFromLatLng(12.97, 77.59)); d != 0 {
+		t.Fatalf("distance to a contained point = %v, want 0", d)
+	}
+	// A level 13 cell is about a kilometre across.
+	for _, far := range []float64{0.05, 0.5, 5} {
+		point := PointFromLatLng(12.97+far, 77.59)
+		km := cell.Distance(point) * EarthRadiusKm
+		toCenter := cellCenter(cell).Angle(point) * EarthRadiusKm
+		if km <= 0 || km > toCenter || toCenter-km > 1.5 {
+			t.Fatalf("point %v° north: %.3f km from the cell, %.3f km from its center", far, km, toCenter)
+		}
+	}
+}
+
+func TestCoverCapContainsEveryPointInCap(t *testing.T) {
+	r := rand.New(rand.NewSource(3))
+	coverer := RegionCoverer{MaxLevel: DefaultS2Level, MaxCells: DefaultS2MaxCoverCells}
+	for _, radiusKm := range []float64{0.2, 1, 5, 50, 500} {
+		lat, lng := randomLatLng(r)
+		cap := CapFromRadiusKm(lat, lng, radiusKm)
+		covering := coverer.CoverCap(cap)
+		if len(covering) == 0 || len(covering) > coverer.MaxCells {
+			t.Fatalf("%v km: covering has %d cells", radiusKm, len(covering))
+		}
+		for n := 0; n < 500; n++ {
+			// A random point inside the cap, by bearing and distance.
+			bearing, distance := r.Float64()*2*math.Pi, radiusKm*math.Sqrt(r.Float64())*0.999
+			pLat := lat + distance/111.2*math.Cos(bearing)
+			pLng := lng + distance/(111.2*math.Cos(lat*math.Pi/180))*math.Sin(bearing)
+			point := PointFromLatLng(pLat, pLng)
+			if !cap.ContainsPoint(point) {
+				continue
+			}
+			if !slices.ContainsFunc(covering, func(cell CellID) bool { return cell.ContainsPoint(point) }) {
+				t.Fatalf("%v km cap at %v,%v: covering misses %v,%v", radiusKm, lat, lng, pLat, pLng)
+			}
+		}
+	}
+}
+
+func TestS2IndexMatchesBruteForce(t *testing.T) {
+	r := rand.New(rand.NewSource(4))
+	positions := make([]Position, 2000)
+	for i := range positions {
+		positions[i] = benchPosition(r, fmt.Sprintf("driver-%d", i), 0.2)
+	}
+	for _, level := range []int{10, DefaultS2Level, 16} {
+		t.Run(fmt.Sprintf("level=%d", level), func(t *testing.T) {
+			si := NewS2Index(level)
+			for _, position := range positions {
+				if err := si.Insert(position); err != nil {
+					t.Fatalf("Insert: %v", err)
+				}
+			}
+
+			for n := 0; n < 30; n++ {
+				query := benchPosition(r, "", 0.3)
+				for _, radiusKm := range []float64{0.3, 2, 10} {
+					var want []string
+					for _, position := range positions {
+						if Haversine(query.Lat, query.Lng, position.Lat, position.Lng) <= radiusKm {
+							want = append(want, position.ID)
+						}
+					}
+					sort.Strings(want)
+					if got := sortedIDs(si.SearchRadius(query.Lat, query.Lng, radiusKm)); !slices.Equal(got, want) {
+						t.Fatalf("SearchRadius %v km at %v,%v found %d, brute force %d", radiusKm, query.Lat, query.Lng, len(got), len(want))
+					}
+				}
+
+				byDistance := slices.Clone(positions)
+				slices.SortFunc(byDistance, func(a, b Position) int {
+					da, db := Haversine(query.Lat, query.Lng, a.Lat, a.Lng), Haversine(query.Lat, query.Lng, b.Lat, b.Lng)
+					return cmp.Compare(da, db)
+				})
+				nearest := si.Nearest(query.Lat, query.Lng, 10, 0, nil)
+				if len(nearest) != 10 {
+					t.Fatalf("Nearest found %d, want 10", len(nearest))
+				}
+				for i, neighbor := range nearest {
+					if neighbor.Position.ID != byDistance[i].ID {
+						t.Fatalf("Nearest at %v,%v differs at %d: %s, brute force %s", query.Lat, query.Lng, i, neighbor.Position.ID, byDistance[i].ID)
+					}
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,383 @@
+package geospatial
+
+import (
+	"math"
+	"math/bits"
+)
+
+const (
+	S2MaxLevel = 30
+
+	s2FaceBits   = 3
+	s2NumFaces   = 6
+	s2PosBits    = 2*S2MaxLevel + 1
+	s2MaxSize    = 1 << S2MaxLevel
+	s2SwapMask   = 0x01
+	s2InvertMask = 0x02
+)
+
+var (
+	s2IJToPos = [4][4]uint64{
+		{0, 1, 3, 2},
+		{0, 3, 1, 2},
+		{2, 3, 1, 0},
+		{2, 1, 3, 0},
+	}
+	s2PosToIJ = [4][4]int{
+		{0, 1, 3, 2},
+		{0, 2, 3, 1},
+		{3, 2, 0, 1},
+		{3, 1, 0, 2},
+	}
+	s2PosToOrientation = [4]int{s2SwapMask, 0, 0, s2InvertMask | s2SwapMask}
+)
+
+type Point struct {
+	X, Y, Z float64
+}
+
+func PointFromLatLng(lat, lng float64) Point {
+	latRad := lat * math.Pi / 180
+	lngRad := lng * math.Pi / 180
+	cosLat := math.Cos(latRad)
+	return Point{
+		X: cosLat * math.Cos(lngRad),
+		Y: cosLat * math.Sin(lngRad),
+		Z: math.Sin(latRad),
+	}
+}
+
+func (p Point) Dot(o Point) float64 {
+	return p.X*o.X + p.Y*o.Y + p.Z*o.Z
+}
+
+func (p Point) Cross(o Point) Point {
+	return Point{
+		X: p.Y*o.Z - p.Z*o.Y,
+		Y: p.Z*o.X - p.X*o.Z,
+		Z: p.X*o.Y - p.Y*o.X,
+	}
+}
+
+func (p Point) Norm() float64 {
+	return math.Sqrt(p.Dot(p))
+}
+
+func (p Point) Normalize() Point {
+	n := p.Norm()
+	if n == 0 {
+		return p
+	}
+	return Point{X: p.X / n, Y: p.Y / n, Z: p.Z / n}
+}
+
+func (p Point) Angle(o Point) float64 {
+	return math.Atan2(p.Cross(o).Norm(), p.Dot(o))
+}
+
+// CellID identifies a cell in the S2 hierarchy: 3 face bits followed by the
+// cell's position along the face's Hilbert curve and a trailing marker bit.
+type CellID uint64
+
+func CellIDFromFace(face int) CellID {
+	return CellID(uint64(face)<<s2PosBits + 1<<(s2PosBits-1))
+}
+
+func CellIDFromLatLng(lat, lng float64) CellID {
+	return CellIDFromPoint(PointFromLatLng(lat, lng))
+}
+
+func CellIDFromPoint(p Point) CellID {
+	face, u, v := xyzToFaceUV(p)
+	i := stToIJ(uvToST(u))
+	j := stToIJ(uvToST(v))
+	return cellIDFromFaceIJ(face, i, j)
+}
+
+func cellIDFromFaceIJ(face, i, j int) CellID {
+	orientation := face & s2SwapMask
+	var pos uint64
+	for k := S2MaxLevel - 1; k >= 0; k-- {
+		ij := ((i>>uint(k))&1)<<1 | (j>>uint(k))&1
+		p := s2IJToPos[orientation][ij]
+		pos = pos<<2 | p
+		orientation ^= s2PosToOrientation[p]
+	}
+	return CellID(uint64(face)<<s2PosBits | pos<<1 | 1)
+}
+
+func (c CellID) Face() int {
+	return int(uint64(c) >> s2PosBits)
+}
+
+func (c CellID) lsb() uint64 {
+	return uint64(c) & -uint64(c)
+}
+
+func lsbForLevel(level int) uint64 {
+	return 1 << uint(2*(S2MaxLevel-level))
+}
+
+func (c CellID) IsValid() bool {
+	return c.Face() < s2NumFaces && c.lsb()&0x1555555555555555 != 0
+}
+
+func (c CellID) Level() int {
+	return S2MaxLevel - bits.TrailingZeros64(uint64(c))>>1
+}
+
+func (c CellID) IsLeaf() bool {
+	return uint64(c)&1 != 0
+}
+
+func (c CellID) Parent(level int) CellID {
+	lsb := lsbForLevel(level)
+	return CellID(uint64(c)&-lsb | lsb)
+}
+
+func (c CellID) Children() [4]CellID {
+	var children [4]CellID
+	lsb := c.lsb()
+	child := uint64(c) - lsb + lsb>>2
+	for k := 0; k < 4; k++ {
+		children[k] = CellID(child)
+		child += lsb >> 1
+	}
+	return children
+}
+
+func (c CellID) RangeMin() CellID {
+	return CellID(uint64(c) - (c.lsb() - 1))
+}
+
+func (c CellID) RangeMax() CellID {
+	return CellID(uint64(c) + (c.lsb() - 1))
+}
+
+func (c CellID) Contains(other CellID) bool {
+	return other >= c.RangeMin() && other <= c.RangeMax()
+}
+
+func (c CellID) faceIJ() (face, i, j int) {
+	face = c.Face()
+	orientation := face & s2SwapMask
+	for k := S2MaxLevel - 1; k >= 0; k-- {
+		p := int(uint64(c)>>uint(2*k+1)) & 3
+		ij := s2PosToIJ[orientation][p]
+		i |= (ij >> 1) << uint(k)
+		j |= (ij & 1) << uint(k)
+		orientation ^= s2PosToOrientation[p]
+	}
+	return face, i, j
+}
+
+func (c CellID) Vertices() [4]Point {
+	face, i, j := c.faceIJ()
+	size := 1 << uint(S2MaxLevel-c.Level())
+	i &^= size - 1
+	j &^= size - 1
+
+	u0 := stToUV(float64(i) / s2MaxSize)
+	u1 := stToUV(float64(i+size) / s2MaxSize)
+	v0 := stToUV(float64(j) / s2MaxSize)
+	v1 := stToUV(float64(j+size) / s2MaxSize)
+
+	return [4]Point{
+		faceUVToXYZ(face, u0, v0).Normalize(),
+		faceUVToXYZ(face, u1, v0).Normalize(),
+		faceUVToXYZ(face, u1, v1).Normalize(),
+		faceUVToXYZ(face, u0, v1).Normalize(),
+	}
+}
+
+func (c CellID) ContainsPoint(p Point) bool {
+	return c.Contains(CellIDFromPoint(p))
+}
+
+// Distance returns the angular distance in radians from p to the closest
+// point of the cell, or 0 when the cell contains p.
+func (c CellID) Distance(p Point) float64 {
+	if c.ContainsPoint(p) {
+		return 0
+	}
+	vertices := c.Vertices()
+	best := math.Pi
+	for k := 0; k < 4; k++ {
+		if d := edgeDistance(p, vertices[k], vertices[(k+1)%4]); d < best {
+			best = d
+		}
+	}
+	return best
+}
+
+func edgeDistance(p, a, b Point) float64 {
+	n := a.Cross(b)
+	if n.Norm() == 0 {
+		return p.Angle(a)
+	}
+	n = n.Normalize()
+	q := Point{
+		X: p.X - p.Dot(n)*n.X,
+		Y: p.Y - p.Dot(n)*n.Y,
+		Z: p.Z - p.Dot(n)*n.Z,
+	}
+	if q.Norm() > 0 && a.Cross(q).Dot(n) >= 0 && q.Cross(b).Dot(n) >= 0 {
+		return math.Asin(math.Min(1, math.Abs(p.Dot(n))))
+	}
+	return math.Min(p.Angle(a), p.Angle(b))
+}
+
+func xyzToFaceUV(p Point) (face int, u, v float64) {
+	ax, ay, az := math.Abs(p.X), math.Abs(p.Y), math.Abs(p.Z)
+	switch {
+	case ax >= ay && ax >= az:
+		face = 0
+		if p.X < 0 {
+			face = 3
+		}
+	case ay >= az:
+		face = 1
+		if p.Y < 0 {
+			face = 4
+		}
+	default:
+		face = 2
+		if p.Z < 0 {
+			face = 5
+		}
+	}
+
+	switch face {
+	case 0:
+		u, v = p.Y/p.X, p.Z/p.X
+	case 1:
+		u, v = -p.X/p.Y, p.Z/p.Y
+	case 2:
+		u, v = -p.X/p.Z, -p.Y/p.Z
+	case 3:
+		u, v = p.Z/p.X, p.Y/p.X
+	case 4:
+		u, v = p.Z/p.Y, -p.X/p.Y
+	default:
+		u, v = -p.Y/p.Z, -p.X/p.Z
+	}
+	return face, u, v
+}
+
+func faceUVToXYZ(face int, u, v float64) Point {
+	switch face {
+	case 0:
+		return Point{1, u, v}
+	case 1:
+		return Point{-u, 1, v}
+	case 2:
+		return Point{-u, -v, 1}
+	case 3:
+		return Point{-1, -v, -u}
+	case 4:
+		return Point{v, -1, -u}
+	default:
+		return Point{v, u, -1}
+	}
+}
+
+func stToUV(s float64) float64 {
+	if s >= 0.5 {
+		return (1 / 3.0) * (4*s*s - 1)
+	}
+	return (1 / 3.0) * (1 - 4*(1-s)*(1-s))
+}
+
+func uvToST(u float64) float64 {
+	if u >= 0 {
+		return 0.5 * math.Sqrt(1+3*u)
+	}
+	return 1 - 0.5*math.Sqrt(1-3*u)
+}
+
+func stToIJ(s float64) int {
+	ij := int(math.Floor(s2MaxSize * s))
+	if ij < 0 {
+		return 0
+	}
+	if ij > s2MaxSize-1 {
+		return s2MaxSize - 1
+	}
+	return ij
+}
+
+// Cap is a spherical disc around Center with an angular radius in radians.
+type Cap struct {
+	Center Point
+	Radius float64
+}
+
+func CapFromRadiusKm(lat, lng, radiusKm float64) Cap {
+	return Cap{
+		Center: PointFromLatLng(lat, lng),
+		Radius: math.Min(radiusKm/EarthRadiusKm, math.Pi),
+	}
+}
+
+func (c Cap) ContainsPoint(p Point) bool {
+	return c.Center.Angle(p) <= c.Radius
+}
+
+func (c Cap) ContainsCell(cell CellID) bool {
+	if c.Radius >= math.Pi/2 {
+		return false
+	}
+	for _, v := range cell.Vertices() {
+		if !c.ContainsPoint(v) {
+			return false
+		}
+	}
+	return true
+}
+
+func (c Cap) IntersectsCell(cell CellID) bool {
+	return cell.Distance(c.Center) <= c.Radius
+}
+
+type RegionCoverer struct {
+	MinLevel int
+	MaxLevel int
+	MaxCells int
+}
+
+func (rc RegionCoverer) CoverCap(c Cap) []CellID {
+	queue := make([]CellID, 0, s2NumFaces)
+	for face := 0; face < s2NumFaces; face++ {
+		cell := CellIDFromFace(face)
+		if c.IntersectsCell(cell) {
+			queue = append(queue, cell)
+		}
+	}
+
+	covering := make([]CellID, 0, rc.MaxCells)
+	for len(queue) > 0 {
+		cell := queue[0]
+		queue = queue[1:]
+		level := cell.Level()
+
+		if level >= rc.MinLevel && (level >= rc.MaxLevel || c.ContainsCell(cell)) {
+			covering = append(covering, cell)
+			continue
+		}
+
+		var children []CellID
+		for _, child := range cell.Children() {
+			if c.IntersectsCell(child) {
+				children = append(children, child)
+			}
+		}
+
+		if level < rc.MinLevel || len(covering)+len(queue)+len(children) <= rc.MaxCells {
+			queue = append(queue, children...)
+		} else {
+			covering = append(covering, cell)
+		}
+	}
+
+	return covering
+}
@@ -1,5 +1,7 @@
 package geospatial
 
+import "math"
+
 type BoundingBox struct {
 	MinLat float64
 	MaxLat float64
@@ -19,3 +21,19 @@ func (bb *BoundingBox) Intersects(other *BoundingBox) bool {
 		other.MaxLng < bb.MinLng)
 }
 
+func (bb *BoundingBox) MinDistanceKm(lat, lng float64) float64 {
+	closestLat := math.Max(bb.MinLat, math.Min(lat, bb.MaxLat))
+	closestLng := math.Max(bb.MinLng, math.Min(lng, bb.MaxLng))
+	return Haversine(lat, lng, closestLat, closestLng)
+}
+
+// Position is what the indexes store for a driver: an immutable copy of its
+// coordinates at the time it was indexed. Version identifies the manager's
+// driver record the position was taken from, so a reader can tell an entry
+// that predates the driver's current record.
+type Position struct {
+	ID      string
+	Lat     float64
+	Lng     float64
+	Version uint64
+}
@@ -0,0 +1,422 @@
+package history
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"uber-system/pkg/models"
+)
+
+const partitionLayout = "20060102T150405"
+
+type Record struct {
+	DriverID  string    `json:"driver_id"`
+	Lat       float64   `json:"lat"`
+	Lng       float64   `json:"lng"`
+	Timestamp time.Time `json:"ts"`
+}
+
+type Config struct {
+	Dir           string
+	Partition     time.Duration
+	Retention     time.Duration
+	FlushInterval time.Duration
+	// Buffer is how many appended records may wait for the writer before
+	// Append blocks.
+	Buffer int
+}
+
+const DefaultBuffer = 4096
+
+var ErrClosed = errors.New("history store is closed")
+
+// Store writes records from a single goroutine, so Append, which runs on the
+// location update path, only queues a record and never waits on the disk.
+// The writer goroutine alone touches the open partition; other goroutines
+// reach it through do.
+type Store struct {
+	config   Config
+	records  chan Record
+	requests chan request
+	stop     chan struct{}
+	closeErr error
+	wg       sync.WaitGroup
+
+	file          *os.File
+	writer        *bufio.Writer
+	openPartition time.Time
+}
+
+type request struct {
+	run    func() error
+	result chan error
+}
+
+func Open(config Config) (*Store, error) {
+	if config.Partition <= 0 {
+		config.Partition = time.Hour
+	}
+	if config.FlushInterval <= 0 {
+		config.FlushInterval = time.Second
+	}
+	if config.Buffer <= 0 {
+		config.Buffer = DefaultBuffer
+	}
+	if err := os.MkdirAll(config.Dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create history dir: %w", err)
+	}
+
+	store := &Store{
+		config:   config,
+		records:  make(chan Record, config.Buffer),
+		requests: make(chan request),
+		stop:     make(chan struct{}),
+	}
+
+	store.wg.Add(1)
+	go store.maintain()
+	return store, nil
+}
+
+func (s *Store) maintain() {
+	defer s.wg.Done()
+	ticker := time.NewTicker(s.config.FlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stop:
+			s.drain()
+			s.closeErr = s.closePartition()
+			return
+		case record := <-s.records:
+			s.write(record)
+		case req := <-s.requests:
+			// Records queued before the request was made are written
+			// first, so a flush covers every Append that returned.
+			s.drain()
+			req.result <- req.run()
+		case now := <-ticker.C:
+			if s.writer != nil {
+				s.writer.Flush()
+			}
+			if s.config.Retention > 0 {
+				if _, err := s.prune(now); err != nil {
+					fmt.Printf("History retention error: %v\n", err)
+				}
+			}
+		}
+	}
+}
+
+// do runs fn on the writer goroutine and returns its error.
+func (s *Store) do(fn func() error) error {
+	req := request{run: fn, result: make(chan error, 1)}
+	select {
+	case s.requests <- req:
+		return <-req.result
+	case <-s.stop:
+		return ErrClosed
+	}
+}
+
+func (s *Store) drain() {
+	for {
+		select {
+		case record := <-s.records:
+			s.write(record)
+		default:
+			return
+		}
+	}
+}
+
+// Append queues record for the writer. It blocks only while Buffer records
+// are already waiting; write errors are logged by the writer.
+func (s *Store) Append(record Record) error {
+	select {
+	case <-s.stop:
+		return ErrClosed
+	default:
+	}
+	select {
+	case s.records <- record:
+		return nil
+	case <-s.stop:
+		return ErrClosed
+	}
+}
+
+func (s *Store) write(record Record) {
+	if err := s.writeRecord(record); err != nil {
+		fmt.Printf("History append error (non-fatal): %v\n", err)
+	}
+}
+
+func (s *Store) writeRecord(record Record) error {
+	partition := record.Timestamp.UTC().Truncate(s.config.Partition)
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	if s.writer == nil || !partition.Equal(s.openPartition) {
+		if err := s.openPartitionFile(partition); err != nil {
+			return err
+		}
+	}
+
+	if _, err := s.writer.Write(data); err != nil {
+		return err
+	}
+	return s.writer.WriteByte('\n')
+}
+
+func (s *Store) HandleEvent(event models.DriverEvent) {
+	if event.Type != models.EventDriverAdded && event.Type != models.EventLocationUpdated {
+		return
+	}
+	err := s.Append(Record{
+		DriverID:  event.DriverID,
+		Lat:       event.Driver.Location.Lat,
+		Lng:       event.Driver.Location.Lng,
+		Timestamp: event.Timestamp,
+	})
+	if err != nil {
+		fmt.Printf("History append error (non-fatal): %v\n", err)
+	}
+}
+
+func (s *Store) openPartitionFile(partition time.Time) error {
+	if err := s.closePartition(); err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(s.partitionPath(partition), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open history partition: %w", err)
+	}
+	s.file = file
+	s.writer = bufio.NewWriter(file)
+	s.openPartition = partition
+	return nil
+}
+
+func (s *Store) closePartition() error {
+	if s.file == nil {
+		return nil
+	}
+	flushErr := s.writer.Flush()
+	closeErr := s.file.Close()
+	s.file = nil
+	s.writer = nil
+	if flushErr != nil {
+		return flushErr
+	}
+	return closeErr
+}
+
+func (s *Store) partitionPath(partition time.Time) string {
+	return filepath.Join(s.config.Dir, partition.Format(partitionLayout)+".jsonl")
+}
+
+func (s *Store) partitions() ([]time.Time, error) {
+	files, err := filepath.Glob(filepath.Join(s.config.Dir, "*.jsonl"))
+	if err != nil {
+		return nil, err
+	}
+
+	partitions := make([]time.Time, 0, len(files))
+	for _, file := range files {
+		name := strings.TrimSuffix(filepath.Base(file), ".jsonl")
+		start, err := time.ParseInLocation(partitionLayout, name, time.UTC)
+		if err != nil {
+			continue
+		}
+		partitions = append(partitions, start)
+	}
+	sort.Slice(partitions, func(i, j int) bool { return partitions[i].Before(partitions[j]) })
+	return partitions, nil
+}
+
+func (s *Store) readPartition(partition time.Time, visit func(Record)) error {
+	file, err := os.Open(s.partitionPath(partition))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var record Record
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			continue
+		}
+		visit(record)
+	}
+	return scanner.Err()
+}
+
+// flush writes out every record appended so far, so reads see them.
+func (s *Store) flush() error {
+	return s.do(func() error {
+		if s.writer == nil {
+			return nil
+		}
+		return s.writer.Flush()
+	})
+}
+
+func (s *Store) Query(driverID string, from, to time.Time) ([]Record, error) {
+	if err := s.flush(); err != nil {
+		return nil, err
+	}
+
+	partitions, err := s.partitions()
+	if err != nil {
+		return nil, err
+	}
+
+	first := from.UTC().Truncate(s.config.Partition)
+	records := make([]Record, 0)
+	for _, partition := range partitions {
+		if partition.Before(first) || partition.After(to) {
+			continue
+		}
+		err := s.readPartition(partition, func(record Record) {
+			if record.DriverID == driverID && !record.Timestamp.Before(from) && !record.Timestamp.After(to) {
+				records = append(records, record)
+			}
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	sort.SliceStable(records, func(i, j int) bool {
+		return records[i].Timestamp.Before(records[j].Timestamp)
+	})
+	return records, nil
+}
+
+// Scan visits every record between from and to, partition by partition in
+// time order. A zero to scans through the newest partition.
+func (s *Store) Scan(from, to time.Time, visit func(Record) error) error {
+	if err := s.flush(); err != nil {
+		return err
+	}
+
+	partitions, err := s.partitions()
+	if err != nil {
+		return err
+	}
+
+	first := from.UTC().Truncate(s.config.Partition)
+	var visitErr error
+	for _, partition := range partitions {
+		if partition.Before(first) || (!to.IsZero() && partition.After(to)) {
+			continue
+		}
+		err := s.readPartition(partition, func(record Record) {
+			if visitErr != nil || record.Timestamp.Before(from) || (!to.IsZero() && record.Timestamp.After(to)) {
+				return
+			}
+			visitErr = visit(record)
+		})
+		if err != nil {
+			return err
+		}
+		if visitErr != nil {
+			return visitErr
+		}
+	}
+	return nil
+}
+
+func (s *Store) At(driverID string, ts time.Time) (Record, bool, error) {
+	if err := s.flush(); err != nil {
+		return Record{}, false, err
+	}
+
+	partitions, err := s.partitions()
+	if err != nil {
+		return Record{}, false, err
+	}
+
+	for i := len(partitions) - 1; i >= 0; i-- {
+		if partitions[i].After(ts) {
+			continue
+		}
+
+		var best Record
+		found := false
+		err := s.readPartition(partitions[i], func(record Record) {
+			if record.DriverID != driverID || record.Timestamp.After(ts) {
+				return
+			}
+			if !found || !record.Timestamp.Before(best.Timestamp) {
+				best = record
+				found = true
+			}
+		})
+		if err != nil {
+			return Record{}, false, err
+		}
+		if found {
+			return best, true, nil
+		}
+	}
+	return Record{}, false, nil
+}
+
+func (s *Store) Prune(now time.Time) (int, error) {
+	var removed int
+	err := s.do(func() error {
+		var err error
+		removed, err = s.prune(now)
+		return err
+	})
+	return removed, err
+}
+
+func (s *Store) prune(now time.Time) (int, error) {
+	partitions, err := s.partitions()
+	if err != nil {
+		return 0, err
+	}
+
+	cutoff := now.Add(-s.config.Retention)
+	removed := 0
+	for _, partition := range partitions {
+		if partition.Add(s.config.Partition).After(cutoff) {
+			continue
+		}
+
+		if s.writer != nil && partition.Equal(s.openPartition) {
+			s.closePartition()
+		}
+		if err := os.Remove(s.partitionPath(partition)); err != nil && !os.IsNotExist(err) {
+			return removed, err
+		}
+		removed++
+	}
+	return removed, nil
+}
+
+// Close writes out every queued record and closes the open partition.
+// Appends after Close return ErrClosed.
+func (s *Store) Close() error {
+	close(s.stop)
+	s.wg.Wait()
+	return s.closeErr
+}
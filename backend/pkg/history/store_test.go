@@ -0,0 +1,235 @@
+package history
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+var hour10 = time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+
+func openTestStore(t *testing.T) *Store {
+	t.Helper()
+	store, err := Open(Config{Dir: t.TempDir(), Partition: time.Hour})
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+func appendAll(t *testing.T, store *Store, records ...Record) {
+	t.Helper()
+	for _, record := range records {
+		if err := store.Append(record); err != nil {
+			t.Fatalf("Append: %v", err)
+		}
+	}
+}
+
+func at(offset time.Duration) time.Time {
+	return hour10.Add(offset)
+}
+
+// boundaryRecords straddles the 10:00 and 11:00 partition boundaries and
+// leaves the 12:00 partition empty. They are appended out of order so the
+// writer moves back and forth between partitions.
+func boundaryRecords() []Record {
+	return []Record{
+		{DriverID: "driver-1", Lat: 1, Timestamp: at(-time.Second)},
+		{DriverID: "driver-1", Lat: 3, Timestamp: at(time.Hour - time.Nanosecond)},
+		{DriverID: "driver-1", Lat: 2, Timestamp: at(0)},
+		{DriverID: "driver-2", Lat: 9, Timestamp: at(30 * time.Minute)},
+		{DriverID: "driver-1", Lat: 4, Timestamp: at(time.Hour)},
+		{DriverID: "driver-1", Lat: 5, Timestamp: at(3*time.Hour + time.Minute)},
+	}
+}
+
+func lats(records []Record) []float64 {
+	values := make([]float64, len(records))
+	for i, record := range records {
+		values[i] = record.Lat
+	}
+	return values
+}
+
+func TestQueryAcrossPartitions(t *testing.T) {
+	store := openTestStore(t)
+	appendAll(t, store, boundaryRecords()...)
+
+	tests := []struct {
+		name     string
+		from, to time.Time
+		want     []float64
+	}{
+		{"everything", at(-time.Hour), at(4 * time.Hour), []float64{1, 2, 3, 4, 5}},
+		{"ends on a boundary", at(-time.Hour), at(0), []float64{1, 2}},
+		{"starts on a boundary", at(0), at(time.Hour), []float64{2, 3, 4}},
+		{"inside one partition", at(time.Minute), at(59 * time.Minute), nil},
+		{"spans the empty partition", at(time.Hour + time.Second), at(4 * time.Hour), []float64{5}},
+		{"before any record", at(-3 * time.Hour), at(-2 * time.Hour), nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			records, err := store.Query("driver-1", tt.from, tt.to)
+			if err != nil {
+				t.Fatalf("Query: %v", err)
+			}
+			if got := lats(records); fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Fatalf("Query = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAtAcrossPartitions(t *testing.T) {
+	store := openTestStore(t)
+	appendAll(t, store, boundaryRecords()...)
+
+	tests := []struct {
+		name  string
+		ts    time.Time
+		want  float64
+		found bool
+	}{
+		{"before any record", at(-time.Minute), 0, false},
+		{"last record of the previous partition", at(-time.Nanosecond), 1, true},
+		{"exactly on a boundary", at(0), 2, true},
+		{"just before the next boundary", at(time.Hour - time.Nanosecond), 3, true},
+		{"in the empty partition", at(2*time.Hour + 30*time.Minute), 4, true},
+		{"at the start of the partition after the gap", at(3 * time.Hour), 4, true},
+		{"after the last record", at(24 * time.Hour), 5, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			record, found, err := store.At("driver-1", tt.ts)
+			if err != nil {
+				t.Fatalf("At: %v", err)
+			}
+			if found != tt.found || record.Lat != tt.want {
+				t.Fatalf("At = %v (found %v), want %v (found %v)", record.Lat, found, tt.want, tt.found)
+			}
+		})
+	}
+
+	if _, found, _ := store.At("driver-3", at(24*time.Hour)); found {
+		t.Fatal("At found a driver with no records")
+	}
+}
+
+func TestScanAndPrune(t *testing.T) {
+	store := openTestStore(t)
+	appendAll(t, store, boundaryRecords()...)
+
+	var scanned []float64
+	err := store.Scan(at(0), time.Time{}, func(record Record) error {
+		scanned = append(scanned, record.Lat)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Scan: %v", err)
+	}
+	// Scan goes partition by partition in file order, not sorted within one.
+	if fmt.Sprint(scanned) != "[3 2 9 4 5]" {
+		t.Fatalf("Scan = %v", scanned)
+	}
+
+	store.config.Retention = time.Hour
+	removed, err := store.Prune(at(2*time.Hour + time.Minute))
+	if err != nil || removed != 2 {
+		t.Fatalf("Prune removed %d, %v, want the 09:00 and 10:00 partitions", removed, err)
+	}
+	records, _ := store.Query("driver-1", at(-time.Hour), at(4*time.Hour))
+	if got := lats(records); fmt.Sprint(got) != "[4 5]" {
+		t.Fatalf("Query after Prune = %v, want [4 5]", got)
+	}
+
+	// The writer reopens a pruned partition on the next append to it.
+	appendAll(t, store, Record{DriverID: "driver-1", Lat: 6, Timestamp: at(time.Minute)})
+	if record, found, _ := store.At("driver-1", at(2*time.Minute)); !found || record.Lat != 6 {
+		t.Fatalf("At after appending to a pruned partition = %v, %v", record.Lat, found)
+	}
+}
+
+func TestConcurrentAppends(t *testing.T) {
+	store, err := Open(Config{Dir: t.TempDir(), Partition: time.Minute, Buffer: 16})
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+
+	const writers, perWriter = 8, 500
+	var wg sync.WaitGroup
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < perWriter; i++ {
+				// Each writer walks through ten partitions.
+				record := Record{DriverID: fmt.Sprintf("driver-%d", w), Lat: float64(i), Timestamp: at(time.Duration(i) * 1200 * time.Millisecond)}
+				if err := store.Append(record); err != nil {
+					t.Errorf("Append: %v", err)
+					return
+				}
+			}
+		}(w)
+	}
+
+	// Reads run alongside the appends.
+	for i := 0; i < 20; i++ {
+		if _, err := store.Query("driver-0", at(0), at(time.Hour)); err != nil {
+			t.Fatalf("Query: %v", err)
+		}
+	}
+	wg.Wait()
+
+	for w := 0; w < writers; w++ {
+		records, err := store.Query(fmt.Sprintf("driver-%d", w), at(0), at(time.Hour))
+		if err != nil || len(records) != perWriter {
+			t.Fatalf("driver-%d has %d records, %v, want %d", w, len(records), err, perWriter)
+		}
+		for i, record := range records {
+			if record.Lat != float64(i) {
+				t.Fatalf("driver-%d record %d is %v", w, i, record.Lat)
+			}
+		}
+	}
+
+	if err := store.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if err := store.Append(Record{DriverID: "driver-0", Timestamp: at(0)}); !errors.Is(err, ErrClosed) {
+		t.Fatalf("Append after Close = %v, want ErrClosed", err)
+	}
+	if _, err := store.Query("driver-0", at(0), at(time.Hour)); !errors.Is(err, ErrClosed) {
+		t.Fatalf("Query after Close = %v, want ErrClosed", err)
+	}
+	files, _ := filepath.Glob(filepath.Join(store.config.Dir, "*.jsonl"))
+	if len(files) != 10 {
+		t.Fatalf("wrote %d partitions, want 10", len(files))
+	}
+}
+
+func TestCloseWritesQueuedRecords(t *testing.T) {
+	dir := t.TempDir()
+	store, err := Open(Config{Dir: dir, Partition: time.Hour, FlushInterval: time.Hour})
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	appendAll(t, store, boundaryRecords()...)
+	if err := store.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, at(0).Format(partitionLayout)+".jsonl"))
+	if err != nil {
+		t.Fatalf("read partition: %v", err)
+	}
+	if lines := bytes.Count(data, []byte("\n")); lines != 3 {
+		t.Fatalf("10:00 partition has %d records, want 3", lines)
+	}
+}
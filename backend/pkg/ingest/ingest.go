@@ -0,0 +1,97 @@
+package ingest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"uber-system/pkg/manager"
+	"uber-system/pkg/models"
+)
+
+type Mode string
+
+const (
+	// ModeSync applies updates inside the HTTP request; no Publisher is used.
+	ModeSync  Mode = "sync"
+	ModeLog   Mode = "log"
+	ModeKafka Mode = "kafka"
+)
+
+func ParseMode(value string) (Mode, error) {
+	switch mode := Mode(value); mode {
+	case "":
+		return ModeSync, nil
+	case ModeSync, ModeLog, ModeKafka:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("unknown ingestion mode %q", value)
+	}
+}
+
+type Receipt struct {
+	Partition string `json:"partition"`
+	Offset    int64  `json:"offset"`
+}
+
+// Publisher hands validated location updates, already routed to a city, to an
+// asynchronous pipeline whose consumer applies them to the manager.
+type Publisher interface {
+	Publish(ctx context.Context, city string, req models.UpdateLocationRequest) (Receipt, error)
+	Stats() map[string]interface{}
+	Close() error
+}
+
+// Applier is the consumer-side sink; *manager.DriverManager satisfies it.
+type Applier interface {
+	ApplyLocationUpdates(reqs []models.UpdateLocationRequest) []manager.LocationUpdateResult
+}
+
+type Config struct {
+	Mode    Mode
+	LogDir  string
+	LogSync bool
+	Kafka   KafkaConfig
+}
+
+// Open starts the pipeline for config.Mode. Sync mode returns a nil
+// Publisher.
+func Open(config Config, applier Applier) (Publisher, error) {
+	switch config.Mode {
+	case ModeSync, "":
+		return nil, nil
+	case ModeLog:
+		return OpenLog(config.LogDir, config.LogSync, applier)
+	case ModeKafka:
+		return NewKafkaPipeline(config.Kafka, applier)
+	default:
+		return nil, fmt.Errorf("unknown ingestion mode %q", config.Mode)
+	}
+}
+
+type encodedUpdate struct {
+	source string
+	value  []byte
+}
+
+// applyEncoded decodes and applies a batch of consumed updates. Updates that
+// can never succeed, such as malformed payloads or unknown drivers, are
+// logged and skipped rather than blocking the partition.
+func applyEncoded(applier Applier, updates []encodedUpdate) {
+	reqs := make([]models.UpdateLocationRequest, 0, len(updates))
+	sources := make([]string, 0, len(updates))
+	for _, update := range updates {
+		var req models.UpdateLocationRequest
+		if err := json.Unmarshal(update.value, &req); err != nil {
+			fmt.Printf("Skipping malformed location message %s: %v\n", update.source, err)
+			continue
+		}
+		reqs = append(reqs, req)
+		sources = append(sources, update.source)
+	}
+
+	for i, result := range applier.ApplyLocationUpdates(reqs) {
+		if result.Err != nil {
+			fmt.Printf("Dropped location message %s for %s: %v\n", sources[i], result.DriverID, result.Err)
+		}
+	}
+}
@@ -0,0 +1,206 @@
+package ingest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+	"uber-system/pkg/models"
+
+	"github.com/segmentio/kafka-go"
+)
+
+const (
+	DefaultKafkaTopic = "driver-location-updates"
+	DefaultKafkaGroup = "driver-manager"
+)
+
+// MessageWriter and MessageReader are the parts of kafka-go's Writer and
+// Reader the pipeline uses, so an in-memory broker can stand in for Kafka.
+type MessageWriter interface {
+	WriteMessages(ctx context.Context, msgs ...kafka.Message) error
+	Close() error
+}
+
+type MessageReader interface {
+	FetchMessage(ctx context.Context) (kafka.Message, error)
+	CommitMessages(ctx context.Context, msgs ...kafka.Message) error
+	Close() error
+}
+
+// KafkaConfig's BatchSize and BatchTimeout bound the consumer's batches;
+// WriterBatchTimeout is how long the producer holds a message back hoping to
+// send it with others, which every Publish waits out under light load.
+type KafkaConfig struct {
+	Brokers            []string
+	Topic              string
+	GroupID            string
+	BatchSize          int
+	BatchTimeout       time.Duration
+	WriterBatchTimeout time.Duration
+}
+
+func (c *KafkaConfig) applyDefaults() {
+	if c.Topic == "" {
+		c.Topic = DefaultKafkaTopic
+	}
+	if c.GroupID == "" {
+		c.GroupID = DefaultKafkaGroup
+	}
+	if c.BatchSize <= 0 {
+		c.BatchSize = 500
+	}
+	if c.BatchTimeout <= 0 {
+		c.BatchTimeout = 50 * time.Millisecond
+	}
+	if c.WriterBatchTimeout <= 0 {
+		c.WriterBatchTimeout = 10 * time.Millisecond
+	}
+}
+
+// KafkaPipeline publishes updates keyed by city, so the hash balancer keeps a
+// city's updates on one partition, and runs a consumer-group reader that
+// applies them in batches before committing.
+type KafkaPipeline struct {
+	config    KafkaConfig
+	writer    MessageWriter
+	reader    MessageReader
+	applier   Applier
+	cancel    context.CancelFunc
+	wg        sync.WaitGroup
+	published int64
+	consumed  int64
+	failures  int64
+}
+
+func NewKafkaPipeline(config KafkaConfig, applier Applier) (*KafkaPipeline, error) {
+	config.applyDefaults()
+	if len(config.Brokers) == 0 {
+		return nil, errors.New("kafka ingestion requires at least one broker")
+	}
+
+	reader := kafka.NewReader(kafka.ReaderConfig{
+		Brokers: config.Brokers,
+		Topic:   config.Topic,
+		GroupID: config.GroupID,
+	})
+	return NewKafkaPipelineWith(config, newKafkaWriter(config), reader, applier), nil
+}
+
+func newKafkaWriter(config KafkaConfig) *kafka.Writer {
+	return &kafka.Writer{
+		Addr:         kafka.TCP(config.Brokers...),
+		Topic:        config.Topic,
+		Balancer:     &kafka.Hash{},
+		RequiredAcks: kafka.RequireAll,
+		BatchTimeout: config.WriterBatchTimeout,
+	}
+}
+
+func NewKafkaPipelineWith(config KafkaConfig, writer MessageWriter, reader MessageReader, applier Applier) *KafkaPipeline {
+	config.applyDefaults()
+	ctx, cancel := context.WithCancel(context.Background())
+	kp := &KafkaPipeline{
+		config:  config,
+		writer:  writer,
+		reader:  reader,
+		applier: applier,
+		cancel:  cancel,
+	}
+	kp.wg.Add(1)
+	go kp.consume(ctx)
+	return kp
+}
+
+func (kp *KafkaPipeline) Publish(ctx context.Context, city string, req models.UpdateLocationRequest) (Receipt, error) {
+	value, err := json.Marshal(req)
+	if err != nil {
+		return Receipt{}, err
+	}
+	if err := kp.writer.WriteMessages(ctx, kafka.Message{Key: []byte(city), Value: value}); err != nil {
+		return Receipt{}, fmt.Errorf("failed to publish to %s: %w", kp.config.Topic, err)
+	}
+	atomic.AddInt64(&kp.published, 1)
+	return Receipt{Partition: city, Offset: -1}, nil
+}
+
+func (kp *KafkaPipeline) consume(ctx context.Context) {
+	defer kp.wg.Done()
+
+	for {
+		batch, err := kp.fetchBatch(ctx)
+		if len(batch) > 0 {
+			updates := make([]encodedUpdate, len(batch))
+			for i, message := range batch {
+				updates[i] = encodedUpdate{
+					source: fmt.Sprintf("%s/%d/%d", message.Topic, message.Partition, message.Offset),
+					value:  message.Value,
+				}
+			}
+			applyEncoded(kp.applier, updates)
+			atomic.AddInt64(&kp.consumed, int64(len(batch)))
+
+			if commitErr := kp.reader.CommitMessages(context.Background(), batch...); commitErr != nil {
+				atomic.AddInt64(&kp.failures, 1)
+				fmt.Printf("Kafka commit error: %v\n", commitErr)
+			}
+		}
+
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			atomic.AddInt64(&kp.failures, 1)
+			fmt.Printf("Kafka fetch error: %v\n", err)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(time.Second):
+			}
+		}
+	}
+}
+
+// fetchBatch blocks for the first message, then gathers more until the batch
+// is full or BatchTimeout passes without one.
+func (kp *KafkaPipeline) fetchBatch(ctx context.Context) ([]kafka.Message, error) {
+	first, err := kp.reader.FetchMessage(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	batch := []kafka.Message{first}
+	for len(batch) < kp.config.BatchSize {
+		fetchCtx, cancel := context.WithTimeout(ctx, kp.config.BatchTimeout)
+		message, err := kp.reader.FetchMessage(fetchCtx)
+		cancel()
+		if err != nil {
+			if errors.Is(err, context.DeadlineExceeded) && ctx.Err() == nil {
+				return batch, nil
+			}
+			return batch, err
+		}
+		batch = append(batch, message)
+	}
+	return batch, nil
+}
+
+func (kp *KafkaPipeline) Stats() map[string]interface{} {
+	return map[string]interface{}{
+		"mode":      ModeKafka,
+		"topic":     kp.config.Topic,
+		"group":     kp.config.GroupID,
+		"published": atomic.LoadInt64(&kp.published),
+		"consumed":  atomic.LoadInt64(&kp.consumed),
+		"failures":  atomic.LoadInt64(&kp.failures),
+	}
+}
+
+func (kp *KafkaPipeline) Close() error {
+	kp.cancel()
+	kp.wg.Wait()
+	return errors.Join(kp.writer.Close(), kp.reader.Close())
+}
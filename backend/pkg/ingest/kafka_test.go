@@ -0,0 +1,195 @@
+package ingest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+	"uber-system/pkg/manager"
+	"uber-system/pkg/models"
+
+	"github.com/segmentio/kafka-go"
+)
+
+const testTopic = "locations-test"
+
+type recordingApplier struct {
+	reqs []models.UpdateLocationRequest
+	mu   sync.Mutex
+}
+
+func (a *recordingApplier) ApplyLocationUpdates(reqs []models.UpdateLocationRequest) []manager.LocationUpdateResult {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.reqs = append(a.reqs, reqs...)
+	results := make([]manager.LocationUpdateResult, len(reqs))
+	for i, req := range reqs {
+		results[i] = manager.LocationUpdateResult{DriverID: req.DriverID, Outcome: models.UpdateApplied}
+	}
+	return results
+}
+
+func (a *recordingApplier) applied() []models.UpdateLocationRequest {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return append([]models.UpdateLocationRequest(nil), a.reqs...)
+}
+
+func newTestPipeline(broker *MemoryBroker, group string, applier Applier) *KafkaPipeline {
+	config := KafkaConfig{Topic: testTopic, GroupID: group, BatchTimeout: 5 * time.Millisecond}
+	return NewKafkaPipelineWith(config, broker.Writer(testTopic), broker.Reader(testTopic, group), applier)
+}
+
+func waitFor(t *testing.T, what string, done func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !done() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func publish(t *testing.T, kp *KafkaPipeline, city string, req models.UpdateLocationRequest) {
+	t.Helper()
+	if _, err := kp.Publish(context.Background(), city, req); err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+}
+
+func TestKafkaPipelinePartitionsByCity(t *testing.T) {
+	broker := NewMemoryBroker(8)
+	kp := newTestPipeline(broker, "indexer", &recordingApplier{})
+	defer kp.Close()
+
+	cities := []string{"bangalore", "mumbai", "delhi", "chennai", "hyderabad"}
+	for seq := 1; seq <= 20; seq++ {
+		for _, city := range cities {
+			publish(t, kp, city, models.UpdateLocationRequest{DriverID: city + "-driver", Seq: uint64(seq)})
+		}
+	}
+
+	partitionOf := make(map[string]int)
+	lastSeq := make(map[string]uint64)
+	total := 0
+	for partition := 0; partition < 8; partition++ {
+		for _, message := range broker.Messages(testTopic, partition) {
+			city := string(message.Key)
+			if seen, exists := partitionOf[city]; exists && seen != partition {
+				t.Fatalf("%s published to partitions %d and %d", city, seen, partition)
+			}
+			partitionOf[city] = partition
+
+			var req models.UpdateLocationRequest
+			if err := json.Unmarshal(message.Value, &req); err != nil {
+				t.Fatalf("message %s/%d: %v", city, message.Offset, err)
+			}
+			if req.Seq <= lastSeq[city] {
+				t.Fatalf("%s: seq %d after %d", city, req.Seq, lastSeq[city])
+			}
+			lastSeq[city] = req.Seq
+			total++
+		}
+	}
+	if total != 20*len(cities) || len(partitionOf) != len(cities) {
+		t.Fatalf("found %d messages for %d cities, want %d for %d", total, len(partitionOf), 20*len(cities), len(cities))
+	}
+}
+
+func TestKafkaPipelineAppliesUpdatesToManager(t *testing.T) {
+	mgr, err := manager.NewDriverManager("", false)
+	if err != nil {
+		t.Fatalf("NewDriverManager: %v", err)
+	}
+	defer mgr.Close()
+
+	for i := 0; i < 5; i++ {
+		driver := &models.Driver{
+			ID:       fmt.Sprintf("driver-%d", i),
+			Location: models.Location{Lat: 12.95, Lng: 77.60},
+			Status:   models.StatusAvailable,
+		}
+		if err := mgr.AddDriver(driver); err != nil {
+			t.Fatalf("AddDriver: %v", err)
+		}
+	}
+
+	kp := newTestPipeline(NewMemoryBroker(4), "indexer", mgr)
+	defer kp.Close()
+	for i := 0; i < 5; i++ {
+		publish(t, kp, "bangalore", models.UpdateLocationRequest{
+			DriverID: fmt.Sprintf("driver-%d", i),
+			Lat:      12.95 + float64(i+1)*0.0001,
+			Lng:      77.60,
+			Seq:      1,
+		})
+	}
+
+	waitFor(t, "updates to reach the manager", func() bool {
+		results, _, err := mgr.SearchWithIndex(12.9503, 77.60, 0.005, manager.IndexTypeQuadTree, models.SearchFilter{})
+		return err == nil && len(results) == 1 && results[0].Driver.ID == "driver-2"
+	})
+	for i := 0; i < 5; i++ {
+		results, _, _ := mgr.SearchWithIndex(12.95+float64(i+1)*0.0001, 77.60, 0.005, manager.IndexTypeGrid, models.SearchFilter{})
+		if len(results) != 1 || results[0].Driver.ID != fmt.Sprintf("driver-%d", i) {
+			t.Fatalf("driver-%d not found at its published position: %v", i, results)
+		}
+	}
+}
+
+func TestKafkaPipelineResumesFromCommittedOffset(t *testing.T) {
+	broker := NewMemoryBroker(2)
+	first := &recordingApplier{}
+	kp := newTestPipeline(broker, "indexer", first)
+	for seq := 1; seq <= 10; seq++ {
+		publish(t, kp, "bangalore", models.UpdateLocationRequest{DriverID: "driver-1", Seq: uint64(seq)})
+	}
+	waitFor(t, "the first consumer", func() bool { return len(first.applied()) == 10 })
+	if err := kp.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	writer := broker.Writer(testTopic)
+	for seq := 11; seq <= 15; seq++ {
+		value, _ := json.Marshal(models.UpdateLocationRequest{DriverID: "driver-1", Seq: uint64(seq)})
+		if err := writer.WriteMessages(context.Background(), kafka.Message{Key: []byte("bangalore"), Value: value}); err != nil {
+			t.Fatalf("WriteMessages: %v", err)
+		}
+	}
+
+	second := &recordingApplier{}
+	kp = newTestPipeline(broker, "indexer", second)
+	defer kp.Close()
+	waitFor(t, "the resumed consumer", func() bool { return len(second.applied()) == 5 })
+	time.Sleep(20 * time.Millisecond)
+
+	applied := second.applied()
+	if len(applied) != 5 {
+		t.Fatalf("resumed consumer applied %d updates, want 5", len(applied))
+	}
+	for i, req := range applied {
+		if req.Seq != uint64(11+i) {
+			t.Fatalf("resumed update %d has seq %d, want %d", i, req.Seq, 11+i)
+		}
+	}
+}
+
+func TestKafkaWriterBatchTimeout(t *testing.T) {
+	config := KafkaConfig{Brokers: []string{"localhost:9092"}}
+	config.applyDefaults()
+	if got := newKafkaWriter(config).BatchTimeout; got != 10*time.Millisecond {
+		t.Fatalf("default writer BatchTimeout = %v, want 10ms", got)
+	}
+
+	config.WriterBatchTimeout = time.Millisecond
+	config.applyDefaults()
+	if got := newKafkaWriter(config).BatchTimeout; got != time.Millisecond {
+		t.Fatalf("writer BatchTimeout = %v, want the configured 1ms", got)
+	}
+	if config.BatchTimeout != 50*time.Millisecond {
+		t.Fatalf("consumer BatchTimeout = %v, want its own 50ms default", config.BatchTimeout)
+	}
+}
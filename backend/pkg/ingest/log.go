@@ -0,0 +1,70 @@
+package ingest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"uber-system/pkg/models"
+	"uber-system/pkg/stream"
+)
+
+const LogConsumerGroup = "driver-manager"
+
+// LogPipeline publishes to the local partitioned log, one partition per
+// city, and consumes it with a worker pool.
+type LogPipeline struct {
+	log      *stream.Log
+	consumer *stream.Consumer
+}
+
+func OpenLog(dir string, syncWrites bool, applier Applier) (*LogPipeline, error) {
+	log, err := stream.Open(dir, stream.Options{SyncWrites: syncWrites})
+	if err != nil {
+		return nil, err
+	}
+
+	consumer, err := log.Consume(LogConsumerGroup, stream.DefaultConsumerConfig(), func(partition string, messages []stream.Message) error {
+		updates := make([]encodedUpdate, len(messages))
+		for i, message := range messages {
+			updates[i] = encodedUpdate{
+				source: fmt.Sprintf("%s/%d", partition, message.Offset),
+				value:  message.Value,
+			}
+		}
+		applyEncoded(applier, updates)
+		return nil
+	})
+	if err != nil {
+		log.Close()
+		return nil, err
+	}
+
+	return &LogPipeline{log: log, consumer: consumer}, nil
+}
+
+func (lp *LogPipeline) Log() *stream.Log {
+	return lp.log
+}
+
+func (lp *LogPipeline) Publish(ctx context.Context, city string, req models.UpdateLocationRequest) (Receipt, error) {
+	value, err := json.Marshal(req)
+	if err != nil {
+		return Receipt{}, err
+	}
+	offset, err := lp.log.Append(city, req.DriverID, value)
+	if err != nil {
+		return Receipt{}, err
+	}
+	return Receipt{Partition: city, Offset: offset}, nil
+}
+
+func (lp *LogPipeline) Stats() map[string]interface{} {
+	stats := lp.log.Stats()
+	stats["mode"] = ModeLog
+	return stats
+}
+
+func (lp *LogPipeline) Close() error {
+	lp.consumer.Close()
+	return lp.log.Close()
+}
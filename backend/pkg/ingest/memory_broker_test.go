@@ -0,0 +1,169 @@
+package ingest
+
+import (
+	"context"
+	"hash/fnv"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// MemoryBroker is an in-process stand-in for a Kafka cluster with the same
+// delivery semantics the pipeline relies on: keyed messages land on a fixed
+// partition, order is kept per partition and each consumer group resumes
+// from its last committed offset.
+type MemoryBroker struct {
+	partitions int
+	topics     map[string][][]kafka.Message
+	committed  map[string][]int64
+	changed    chan struct{}
+	mu         sync.Mutex
+}
+
+func NewMemoryBroker(partitions int) *MemoryBroker {
+	if partitions <= 0 {
+		partitions = 1
+	}
+	return &MemoryBroker{
+		partitions: partitions,
+		topics:     make(map[string][][]kafka.Message),
+		committed:  make(map[string][]int64),
+		changed:    make(chan struct{}),
+	}
+}
+
+func (b *MemoryBroker) topicLocked(topic string) [][]kafka.Message {
+	partitions, exists := b.topics[topic]
+	if !exists {
+		partitions = make([][]kafka.Message, b.partitions)
+		b.topics[topic] = partitions
+	}
+	return partitions
+}
+
+func (b *MemoryBroker) partitionFor(key []byte) int {
+	h := fnv.New32a()
+	h.Write(key)
+	return int(h.Sum32() % uint32(b.partitions))
+}
+
+// Messages returns a copy of everything written to one partition of a topic.
+func (b *MemoryBroker) Messages(topic string, partition int) []kafka.Message {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]kafka.Message(nil), b.topicLocked(topic)[partition]...)
+}
+
+func (b *MemoryBroker) Writer(topic string) MessageWriter {
+	return &memoryWriter{broker: b, topic: topic}
+}
+
+func (b *MemoryBroker) Reader(topic, groupID string) MessageReader {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	key := groupID + "/" + topic
+	committed, exists := b.committed[key]
+	if !exists {
+		committed = make([]int64, b.partitions)
+		b.committed[key] = committed
+	}
+	return &memoryReader{
+		broker:   b,
+		topic:    topic,
+		key:      key,
+		position: append([]int64(nil), committed...),
+		closed:   make(chan struct{}),
+	}
+}
+
+type memoryWriter struct {
+	broker *MemoryBroker
+	topic  string
+}
+
+func (w *memoryWriter) WriteMessages(ctx context.Context, msgs ...kafka.Message) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	b := w.broker
+	b.mu.Lock()
+	partitions := b.topicLocked(w.topic)
+	now := time.Now()
+	for _, msg := range msgs {
+		partition := b.partitionFor(msg.Key)
+		msg.Topic = w.topic
+		msg.Partition = partition
+		msg.Offset = int64(len(partitions[partition]))
+		msg.Time = now
+		partitions[partition] = append(partitions[partition], msg)
+	}
+	close(b.changed)
+	b.changed = make(chan struct{})
+	b.mu.Unlock()
+	return nil
+}
+
+func (w *memoryWriter) Close() error {
+	return nil
+}
+
+type memoryReader struct {
+	broker   *MemoryBroker
+	topic    string
+	key      string
+	position []int64
+	next     int
+	closed   chan struct{}
+	once     sync.Once
+}
+
+func (r *memoryReader) FetchMessage(ctx context.Context) (kafka.Message, error) {
+	b := r.broker
+	for {
+		b.mu.Lock()
+		partitions := b.topicLocked(r.topic)
+		for i := 0; i < len(partitions); i++ {
+			partition := (r.next + i) % len(partitions)
+			if r.position[partition] < int64(len(partitions[partition])) {
+				msg := partitions[partition][r.position[partition]]
+				r.position[partition]++
+				r.next = (partition + 1) % len(partitions)
+				b.mu.Unlock()
+				return msg, nil
+			}
+		}
+		changed := b.changed
+		b.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return kafka.Message{}, ctx.Err()
+		case <-r.closed:
+			return kafka.Message{}, io.EOF
+		case <-changed:
+		}
+	}
+}
+
+func (r *memoryReader) CommitMessages(ctx context.Context, msgs ...kafka.Message) error {
+	b := r.broker
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	committed := b.committed[r.key]
+	for _, msg := range msgs {
+		if msg.Offset+1 > committed[msg.Partition] {
+			committed[msg.Partition] = msg.Offset + 1
+		}
+	}
+	return nil
+}
+
+func (r *memoryReader) Close() error {
+	r.once.Do(func() { close(r.closed) })
+	return nil
+}
@@ -0,0 +1,145 @@
+package manager
+
+import (
+	"fmt"
+	"time"
+	"uber-system/pkg/anomaly"
+	"uber-system/pkg/cache"
+	"uber-system/pkg/models"
+	"uber-system/pkg/validation"
+)
+
+type LocationUpdateResult struct {
+	DriverID   string
+	Outcome    models.UpdateOutcome
+	Registered bool
+	Err        error
+}
+
+// ApplyLocationUpdates applies a batch of updates, taking each driver shard's
+// lock once for all of the batch's drivers in that shard. Results are
+// positional; updates for the same driver are applied in batch order, and
+// each spatial index and the Redis pipeline see only the final position of
+// every driver.
+func (dm *DriverManager) ApplyLocationUpdates(reqs []models.UpdateLocationRequest) []LocationUpdateResult {
+	now := time.Now()
+	results := make([]LocationUpdateResult, len(reqs))
+	valid := make([]int, 0, len(reqs))
+	for i, req := range reqs {
+		results[i].DriverID = validation.NormalizeID(req.DriverID)
+		if err := validation.LocationUpdate(req, now); err != nil {
+			results[i].Err = err
+			continue
+		}
+		valid = append(valid, i)
+	}
+
+	events := make([]models.DriverEvent, len(reqs))
+	var writes []cache.LocationWrite
+	for _, group := range dm.groupByShard(valid, func(i int) string { return results[i].DriverID }) {
+		changes := make(map[string]*locationChange)
+		items := make(map[string][]int)
+		order := make([]string, 0, len(group.items))
+
+		group.shard.mu.Lock()
+		for _, i := range group.items {
+			driverID := results[i].DriverID
+			var pending []anomaly.Fix
+			if staged, exists := changes[driverID]; exists {
+				pending = staged.pendingFixes()
+			}
+			change, outcome, err := dm.stageLocationLocked(group.shard, reqs[i], now, pending)
+			results[i].Outcome, results[i].Err = outcome, err
+			if err != nil || outcome != models.UpdateApplied {
+				continue
+			}
+
+			events[i] = change.event
+			items[driverID] = append(items[driverID], i)
+			if staged, exists := changes[driverID]; exists {
+				staged.driver, staged.city = change.driver, change.city
+				staged.verdicts = append(staged.verdicts, change.verdicts...)
+				continue
+			}
+			changes[driverID] = &change
+			order = append(order, driverID)
+		}
+
+		failed := dm.indexLocationsLocked(changes, order)
+		for _, driverID := range order {
+			if _, rollback := failed[driverID]; rollback {
+				dm.rollbackLocked(group.shard, changes[driverID])
+			} else {
+				dm.commitAnomaliesLocked(changes[driverID])
+			}
+		}
+		group.shard.mu.Unlock()
+
+		for driverID, err := range failed {
+			for _, i := range items[driverID] {
+				results[i].Outcome, results[i].Err = "", err
+			}
+		}
+		if dm.useRedis && dm.redisCache != nil {
+			for _, driverID := range order {
+				if _, skip := failed[driverID]; skip {
+					continue
+				}
+				change := changes[driverID]
+				writes = append(writes, cache.LocationWrite{
+					Driver:  *change.driver,
+					City:    change.city,
+					OldCity: change.oldCity,
+				})
+			}
+		}
+	}
+
+	if len(writes) > 0 {
+		if err := dm.redisCache.UpdateLocations(writes); err != nil {
+			fmt.Printf("Redis cache error (non-fatal): %v\n", err)
+		}
+	}
+
+	for i, event := range events {
+		if results[i].Outcome == models.UpdateApplied && results[i].Err == nil {
+			dm.events.emit(event)
+		}
+	}
+	return results
+}
+
+// indexLocationsLocked writes coalesced changes city by city and index by
+// index, so each index lock is taken for one contiguous run of the batch.
+func (dm *DriverManager) indexLocationsLocked(changes map[string]*locationChange, order []string) map[string]error {
+	failed := make(map[string]error)
+	byCity := make(map[string][]*locationChange)
+	for _, driverID := range order {
+		change := changes[driverID]
+		if change.moved() {
+			if oldIndexes, ok := dm.cityIndexes(change.oldCity); ok {
+				oldIndexes.remove(driverID, dm.indexOrder)
+			}
+		}
+		byCity[change.city] = append(byCity[change.city], change)
+	}
+
+	for city, group := range byCity {
+		ci, _ := dm.cityIndexes(city)
+		for _, indexType := range dm.indexOrder {
+			index := ci.index(indexType)
+			for _, change := range group {
+				var err error
+				if change.moved() {
+					err = index.Insert(positionOf(change.driver))
+				} else {
+					err = index.Update(positionOf(change.driver))
+				}
+				if err != nil {
+					failed[change.driver.ID] = fmt.Errorf("failed to index %s in %s index for %s: %w", change.driver.ID, indexType, city, err)
+				}
+			}
+		}
+	}
+	return failed
+}
@@ -0,0 +1,80 @@
+package manager
+
+import (
+	"errors"
+	"testing"
+	"uber-system/pkg/models"
+	"uber-system/pkg/validation"
+)
+
+func TestApplyLocationUpdatesMixedBatch(t *testing.T) {
+	dm := newTestManager(t)
+	addTestDriver(t, dm, "driver-a", 12.97, 77.59)
+	addTestDriver(t, dm, "driver-b", 12.98, 77.60)
+	var emitted []string
+	dm.Subscribe(func(event models.DriverEvent) {
+		if event.Type == models.EventLocationUpdated {
+			emitted = append(emitted, event.DriverID)
+		}
+	})
+
+	var validationErr validation.Errors
+	isValidation := func(err error) bool { return errors.As(err, &validationErr) }
+	tests := []struct {
+		req     models.UpdateLocationRequest
+		outcome models.UpdateOutcome
+		err     func(error) bool
+	}{
+		{models.UpdateLocationRequest{DriverID: "driver-a", Lat: 12.9702, Lng: 77.59, Seq: 1}, models.UpdateApplied, nil},
+		{models.UpdateLocationRequest{DriverID: " ", Lat: 12.97, Lng: 77.59}, "", isValidation},
+		{models.UpdateLocationRequest{DriverID: "ghost", Lat: 12.97, Lng: 77.59}, "", func(err error) bool { return errors.Is(err, ErrDriverNotFound) }},
+		{models.UpdateLocationRequest{DriverID: "driver-a", Lat: 12.9702, Lng: 77.59, Seq: 1}, models.UpdateDuplicate, nil},
+		{models.UpdateLocationRequest{DriverID: "driver-b", Lat: 200, Lng: 77.60, Seq: 9}, "", isValidation},
+		{models.UpdateLocationRequest{DriverID: " driver-b ", Lat: 12.9802, Lng: 77.60, Seq: 3}, models.UpdateApplied, nil},
+		{models.UpdateLocationRequest{DriverID: "driver-b", Lat: 12.98, Lng: 77.60, Seq: 2}, models.UpdateStale, nil},
+		// About 110 km in a second, which the default detector rejects.
+		{models.UpdateLocationRequest{DriverID: "driver-a", Lat: 13.97, Lng: 77.59, Seq: 2}, "", func(err error) bool { return errors.Is(err, ErrLocationRejected) }},
+		{models.UpdateLocationRequest{DriverID: "driver-a", Lat: 12.9704, Lng: 77.59, Seq: 3}, models.UpdateApplied, nil},
+		{models.UpdateLocationRequest{DriverID: "driver-b", Lat: 0.1, Lng: 0.1, Seq: 4}, "", func(err error) bool { return err != nil }},
+	}
+	reqs := make([]models.UpdateLocationRequest, len(tests))
+	for i, tt := range tests {
+		reqs[i] = tt.req
+	}
+
+	results := dm.ApplyLocationUpdates(reqs)
+	if len(results) != len(reqs) {
+		t.Fatalf("got %d results for %d updates", len(results), len(reqs))
+	}
+	for i, tt := range tests {
+		result := results[i]
+		if result.DriverID != validation.NormalizeID(tt.req.DriverID) {
+			t.Errorf("update %d: DriverID = %q", i, result.DriverID)
+		}
+		if result.Outcome != tt.outcome {
+			t.Errorf("update %d: Outcome = %q, want %q", i, result.Outcome, tt.outcome)
+		}
+		if tt.err == nil && result.Err != nil || tt.err != nil && !tt.err(result.Err) {
+			t.Errorf("update %d: Err = %v", i, result.Err)
+		}
+	}
+
+	// Each driver ends at its last applied position, and only applied
+	// updates reach subscribers.
+	for id, lat := range map[string]float64{"driver-a": 12.9704, "driver-b": 12.9802} {
+		driver, _ := dm.lookup(id)
+		if driver.Location.Lat != lat {
+			t.Errorf("%s is at %v, want %v", id, driver.Location.Lat, lat)
+		}
+		for _, indexType := range dm.IndexTypes() {
+			found, _, err := dm.SearchWithIndex(lat, driver.Location.Lng, 0.01, indexType, models.SearchFilter{})
+			if err != nil || len(found) != 1 || found[0].Driver.ID != id {
+				t.Errorf("%s search at %s's position = %v, %v", indexType, id, found, err)
+			}
+		}
+	}
+	if len(emitted) != 3 {
+		t.Errorf("emitted %v, want 3 location events", emitted)
+	}
+	checkIndexesMatchDrivers(t, dm)
+}
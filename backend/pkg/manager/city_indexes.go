@@ -0,0 +1,126 @@
+package manager
+
+import (
+	"fmt"
+	"sync/atomic"
+	"uber-system/pkg/geospatial"
+	"uber-system/pkg/models"
+)
+
+// indexSlot holds the live index of one type for a city. Searches load it
+// without locking, so a rebuilt index can be swapped in while they run.
+type indexSlot struct {
+	current atomic.Pointer[indexHolder]
+}
+
+type indexHolder struct {
+	geospatial.SpatialIndex
+}
+
+func (slot *indexSlot) load() geospatial.SpatialIndex {
+	return slot.current.Load().SpatialIndex
+}
+
+func (slot *indexSlot) store(index geospatial.SpatialIndex) {
+	slot.current.Store(&indexHolder{index})
+}
+
+type cityIndexes struct {
+	city    string
+	bounds  geospatial.BoundingBox
+	indexes map[IndexType]*indexSlot
+}
+
+func newCityIndexes(city string, bounds geospatial.BoundingBox, indexTypes []IndexType) (*cityIndexes, error) {
+	ci := &cityIndexes{
+		city:    city,
+		bounds:  bounds,
+		indexes: make(map[IndexType]*indexSlot, len(indexTypes)),
+	}
+	for _, indexType := range indexTypes {
+		index, err := geospatial.NewIndex(string(indexType), bounds)
+		if err != nil {
+			return nil, err
+		}
+		slot := &indexSlot{}
+		slot.store(index)
+		ci.indexes[indexType] = slot
+	}
+	return ci, nil
+}
+
+// index returns the live index of indexType, or nil if the city has none.
+func (ci *cityIndexes) index(indexType IndexType) geospatial.SpatialIndex {
+	slot, exists := ci.indexes[indexType]
+	if !exists {
+		return nil
+	}
+	return slot.load()
+}
+
+// build constructs a new index of indexType holding positions without
+// touching the live one. Indexes that implement geospatial.Rebuilder are
+// bulk-loaded; the rest are filled one insert at a time.
+func (ci *cityIndexes) build(indexType IndexType, positions []geospatial.Position) (geospatial.SpatialIndex, error) {
+	if rebuilder, ok := ci.index(indexType).(geospatial.Rebuilder); ok {
+		index, err := rebuilder.Rebuild(positions)
+		if err != nil {
+			return nil, fmt.Errorf("failed to build %s index for %s: %w", indexType, ci.city, err)
+		}
+		return index, nil
+	}
+
+	index, err := geospatial.NewIndex(string(indexType), ci.bounds)
+	if err != nil {
+		return nil, err
+	}
+	for _, position := range positions {
+		if err := index.Insert(position); err != nil {
+			return nil, fmt.Errorf("failed to build %s index for %s: %w", indexType, ci.city, err)
+		}
+	}
+	return index, nil
+}
+
+func positionOf(driver *models.Driver) geospatial.Position {
+	return geospatial.Position{
+		ID:      driver.ID,
+		Lat:     driver.Location.Lat,
+		Lng:     driver.Location.Lng,
+		Version: driver.Version,
+	}
+}
+
+func (ci *cityIndexes) insert(driver *models.Driver, indexTypes []IndexType) error {
+	position := positionOf(driver)
+	for _, indexType := range indexTypes {
+		if err := ci.index(indexType).Insert(position); err != nil {
+			return fmt.Errorf("failed to insert into %s index for %s: %w", indexType, ci.city, err)
+		}
+	}
+	return nil
+}
+
+func (ci *cityIndexes) update(driver *models.Driver, indexTypes []IndexType) error {
+	position := positionOf(driver)
+	for _, indexType := range indexTypes {
+		if err := ci.index(indexType).Update(position); err != nil {
+			return fmt.Errorf("failed to update %s index for %s: %w", indexType, ci.city, err)
+		}
+	}
+	return nil
+}
+
+func (ci *cityIndexes) remove(driverID string, indexTypes []IndexType) {
+	for _, indexType := range indexTypes {
+		ci.index(indexType).Remove(driverID)
+	}
+}
+
+func (ci *cityIndexes) stats(indexTypes []IndexType) map[string]interface{} {
+	stats := make(map[string]interface{}, len(indexTypes))
+	for _, indexType := range indexTypes {
+		stats[string(indexType)+"_stats"] = ci.index(indexType).Stats()
+	}
+	return stats
+}
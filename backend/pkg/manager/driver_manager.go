@@ -2,12 +2,16 @@ package manager
 
 import (
 	"fmt"
+	"sort"
 	"sync"
+	"sync/atomic"
 	"time"
+	"uber-system/pkg/anomaly"
 	"uber-system/pkg/cache"
 	"uber-system/pkg/geospatial"
 	"uber-system/pkg/models"
 	"uber-system/pkg/router"
+	"uber-system/pkg/validation"
 )
 
 type IndexType string
@@ -16,26 +20,47 @@ const (
 	IndexTypeQuadTree IndexType = "quadtree"
 	IndexTypeGrid     IndexType = "grid"
 	IndexTypeRedis    IndexType = "redis"
+	IndexTypeS2       IndexType = "s2"
 )
 
+// maxRedisNearestCount caps the COUNT of a Redis nearest query while it
+// widens to find k drivers that pass the filter.
+const maxRedisNearestCount = 10000
+
 type DriverManager struct {
-	quadTree   *geospatial.QuadTree
-	gridIndex  *geospatial.GridIndex
+	indexOrder []IndexType
+	cities     map[string]*cityIndexes
+	citiesMu   sync.RWMutex
 	redisCache *cache.RedisCache
 	geoRouter  *router.GeoRouter
-	drivers    map[string]*models.Driver
-	mu         sync.RWMutex
+	shards     [driverShardCount]*driverShard
+	anomalies  atomic.Pointer[anomaly.Detector]
 	useRedis   bool
+	events     eventBus
+	janitor    *janitor
+	janitorMu  sync.Mutex
+	rebuildMu  sync.Mutex
+	staleCount atomic.Int64
+	evictCount atomic.Int64
+
+	staleUpdates     atomic.Int64
+	duplicateUpdates atomic.Int64
 }
 
-func NewDriverManager(minLat, maxLat, minLng, maxLng float64, redisAddr string, useRedis bool) (*DriverManager, error) {
+func NewDriverManager(redisAddr string, useRedis bool) (*DriverManager, error) {
 	manager := &DriverManager{
-		quadTree:  geospatial.NewQuadTree(minLat, maxLat, minLng, maxLng),
-		gridIndex: geospatial.NewGridIndex(minLat, maxLat, minLng, maxLng, 0.5),
+		cities:    make(map[string]*cityIndexes),
 		geoRouter: router.NewGeoRouter(),
-		drivers:   make(map[string]*models.Driver),
 		useRedis:  useRedis,
 	}
+	for i := range manager.shards {
+		manager.shards[i] = newDriverShard()
+	}
+	manager.anomalies.Store(anomaly.NewDetector(anomaly.DefaultConfig()))
+
+	for _, name := range geospatial.RegisteredIndexes() {
+		manager.indexOrder = append(manager.indexOrder, IndexType(name))
+	}
 
 	if useRedis {
 		redisCache, err := cache.NewRedisCache(redisAddr, "", 0, 30*time.Minute)
@@ -45,121 +70,489 @@ func NewDriverManager(minLat, maxLat, minLng, maxLng float64, redisAddr string,
 		manager.redisCache = redisCache
 	}
 
-	manager.geoRouter.RegisterCity("mumbai", minLat, maxLat, minLng, maxLng)
-	manager.geoRouter.RegisterCity("delhi", 28.3949, 28.8836, 76.8389, 77.3456)
-	manager.geoRouter.RegisterCity("bangalore", 12.8342, 13.1476, 77.4577, 77.7878)
-	manager.geoRouter.RegisterCity("hyderabad", 17.2403, 17.6868, 78.1636, 78.6569)
-	manager.geoRouter.RegisterCity("chennai", 12.7948, 13.2402, 80.0889, 80.3044)
+	manager.geoRouter.RegisterCities(router.DefaultCities)
 	return manager, nil
 }
 
-func (dm *DriverManager) AddDriver(driver *models.Driver) error {
-	dm.mu.Lock()
-	defer dm.mu.Unlock()
+func (dm *DriverManager) SetAnomalyDetector(detector *anomaly.Detector) {
+	dm.anomalies.Store(detector)
+}
 
-	driver.UpdatedAt = time.Now()
-	dm.drivers[driver.ID] = driver
+func (dm *DriverManager) Anomalies() *anomaly.Detector {
+	return dm.anomalies.Load()
+}
+
+func (dm *DriverManager) GeoRouter() *router.GeoRouter {
+	return dm.geoRouter
+}
+
+func (dm *DriverManager) cityIndexes(city string) (*cityIndexes, bool) {
+	dm.citiesMu.RLock()
+	defer dm.citiesMu.RUnlock()
+	ci, exists := dm.cities[city]
+	return ci, exists
+}
 
-	if !dm.quadTree.Insert(driver) {
-		return fmt.Errorf("failed to insert into QuadTree")
+// citiesNear returns the indexed cities whose bounds come within radiusKm of
+// (lat, lng), nearest first. A non-positive radius matches every city.
+func (dm *DriverManager) citiesNear(lat, lng, radiusKm float64) []*cityIndexes {
+	type candidate struct {
+		ci       *cityIndexes
+		distance float64
 	}
 
-	if err := dm.gridIndex.Insert(driver); err != nil {
-		return fmt.Errorf("failed to insert into Grid: %w", err)
+	dm.citiesMu.RLock()
+	candidates := make([]candidate, 0, len(dm.cities))
+	for _, ci := range dm.cities {
+		distance := ci.bounds.MinDistanceKm(lat, lng)
+		if radiusKm <= 0 || distance <= radiusKm {
+			candidates = append(candidates, candidate{ci: ci, distance: distance})
+		}
 	}
+	dm.citiesMu.RUnlock()
 
-	if dm.useRedis && dm.redisCache != nil {
-		city, _ := dm.geoRouter.GetCity(driver.Location.Lat, driver.Location.Lng)
-		if city == "" {
-			city = "mumbai"
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].distance != candidates[j].distance {
+			return candidates[i].distance < candidates[j].distance
 		}
-		if err := dm.redisCache.AddDriver(driver, city); err != nil {
-			fmt.Printf("Redis cache error (non-fatal): %v\n", err)
+		return candidates[i].ci.city < candidates[j].ci.city
+	})
+	cities := make([]*cityIndexes, len(candidates))
+	for i, candidate := range candidates {
+		cities[i] = candidate.ci
+	}
+	return cities
+}
+
+func (dm *DriverManager) getOrCreateCityIndexes(city string) (*cityIndexes, error) {
+	if ci, exists := dm.cityIndexes(city); exists {
+		return ci, nil
+	}
+
+	dm.citiesMu.Lock()
+	defer dm.citiesMu.Unlock()
+
+	if ci, exists := dm.cities[city]; exists {
+		return ci, nil
+	}
+
+	ci, err := dm.emptyCityIndexes(city)
+	if err != nil {
+		return nil, err
+	}
+	dm.cities[city] = ci
+	return ci, nil
+}
+
+// emptyCityIndexes creates a registered city's indexes without adding them
+// to dm.cities.
+func (dm *DriverManager) emptyCityIndexes(city string) (*cityIndexes, error) {
+	info, registered := dm.geoRouter.GetCityInfo(city)
+	if !registered {
+		return nil, fmt.Errorf("city not registered: %s", city)
+	}
+
+	bounds := geospatial.BoundingBox{
+		MinLat: info.MinLat,
+		MaxLat: info.MaxLat,
+		MinLng: info.MinLng,
+		MaxLng: info.MaxLng,
+	}
+	return newCityIndexes(city, bounds, dm.indexOrder)
+}
+
+func (dm *DriverManager) isIndexType(indexType IndexType) bool {
+	for _, registered := range dm.indexOrder {
+		if registered == indexType {
+			return true
 		}
 	}
+	return false
+}
 
+func (dm *DriverManager) AddDriver(driver *models.Driver) error {
+	event, err := dm.addDriver(driver)
+	if err != nil {
+		return err
+	}
+	dm.events.emit(event)
 	return nil
 }
 
-func (dm *DriverManager) UpdateLocation(driverID string, lat, lng float64) error {
-	dm.mu.Lock()
-	defer dm.mu.Unlock()
+func (dm *DriverManager) addDriver(driver *models.Driver) (models.DriverEvent, error) {
+	if err := validation.Driver(driver); err != nil {
+		return models.DriverEvent{}, err
+	}
+	if driver.Status == "" {
+		driver.Status = models.StatusAvailable
+	}
 
-	driver, exists := dm.drivers[driverID]
-	if !exists {
-		return fmt.Errorf("driver not found: %s", driverID)
+	shard := dm.shardFor(driver.ID)
+	shard.mu.Lock()
+	record, city, err := dm.insertDriverLocked(shard, *driver)
+	shard.mu.Unlock()
+	if err != nil {
+		return models.DriverEvent{}, err
 	}
+	driver.UpdatedAt, driver.LocationUpdatedAt, driver.Version = record.UpdatedAt, record.LocationUpdatedAt, record.Version
 
-	oldLat, oldLng := driver.Location.Lat, driver.Location.Lng
-	dm.quadTree.Remove(driverID)
-	dm.gridIndex.Remove(driverID, oldLat, oldLng)
+	if dm.useRedis && dm.redisCache != nil {
+		if err := dm.redisCache.AddDriver(record, city); err != nil {
+			fmt.Printf("Redis cache error (non-fatal): %v\n", err)
+		}
+	}
+
+	return models.DriverEvent{
+		Type:      models.EventDriverAdded,
+		DriverID:  record.ID,
+		City:      city,
+		Driver:    *record,
+		Timestamp: record.UpdatedAt,
+	}, nil
+}
+
+// insertDriverLocked indexes and publishes a copy of driver, so the caller's
+// value is never shared with the indexes.
+func (dm *DriverManager) insertDriverLocked(shard *driverShard, driver models.Driver) (*models.Driver, string, error) {
+	if _, exists := shard.drivers[driver.ID]; exists {
+		return nil, "", fmt.Errorf("%w: %s", ErrDriverExists, driver.ID)
+	}
+
+	city, err := dm.geoRouter.GetCity(driver.Location.Lat, driver.Location.Lng)
+	if err != nil {
+		return nil, "", err
+	}
+
+	ci, err := dm.getOrCreateCityIndexes(city)
+	if err != nil {
+		return nil, "", err
+	}
 
-	driver.Location.Lat = lat
-	driver.Location.Lng = lng
 	driver.UpdatedAt = time.Now()
+	driver.LocationUpdatedAt = driver.UpdatedAt
+	driver.Version = 1
+	record := &driver
+	if err := ci.insert(record, dm.indexOrder); err != nil {
+		ci.remove(record.ID, dm.indexOrder)
+		return nil, "", err
+	}
+	shard.put(record)
+	shard.cities[record.ID] = city
+	dm.Anomalies().Forget(record.ID)
+	shard.recordTransition(record.ID, "", record.Status, "registered", record.UpdatedAt)
+	return record, city, nil
+}
 
-	dm.quadTree.Insert(driver)
-	dm.gridIndex.Insert(driver)
+func (dm *DriverManager) UpdateLocation(driverID string, lat, lng float64) error {
+	_, err := dm.ApplyLocationUpdate(models.UpdateLocationRequest{DriverID: driverID, Lat: lat, Lng: lng})
+	return err
+}
+
+// ApplyLocationUpdate applies an update unless the driver has already
+// reported a newer or identical device clock; such updates are counted and
+// acknowledged without changing any state.
+func (dm *DriverManager) ApplyLocationUpdate(req models.UpdateLocationRequest) (models.UpdateOutcome, error) {
+	event, outcome, err := dm.updateLocation(req)
+	if err != nil {
+		return "", err
+	}
+	if outcome == models.UpdateApplied {
+		dm.events.emit(event)
+	}
+	return outcome, nil
+}
 
+func (dm *DriverManager) updateLocation(req models.UpdateLocationRequest) (models.DriverEvent, models.UpdateOutcome, error) {
+	now := time.Now()
+	if err := validation.LocationUpdate(req, now); err != nil {
+		return models.DriverEvent{}, "", err
+	}
+
+	shard := dm.shardFor(validation.NormalizeID(req.DriverID))
+	shard.mu.Lock()
+	change, outcome, err := dm.stageLocationLocked(shard, req, now, nil)
+	if err == nil && outcome == models.UpdateApplied {
+		if err = dm.indexLocationLocked(change); err != nil {
+			dm.rollbackLocked(shard, &change)
+		} else {
+			dm.commitAnomaliesLocked(&change)
+		}
+	}
+	shard.mu.Unlock()
+	if err != nil || outcome != models.UpdateApplied {
+		return models.DriverEvent{}, outcome, err
+	}
+
+	// Redis is written after the shard lock is released, so two racing
+	// updates for one driver may land out of order there; the next update
+	// repairs it and CheckRedisConsistency reports any lasting drift.
 	if dm.useRedis && dm.redisCache != nil {
-		city, _ := dm.geoRouter.GetCity(lat, lng)
-		if city == "" {
-			city = "mumbai"
+		driver := change.driver
+		if change.moved() {
+			dm.redisCache.RemoveDriver(driver.ID, change.oldCity)
+			dm.redisCache.AddDriver(driver, change.city)
+		} else {
+			dm.redisCache.UpdateLocation(driver.ID, change.city, driver.Location.Lat, driver.Location.Lng)
 		}
-		dm.redisCache.UpdateLocation(driverID, city, lat, lng)
 	}
 
-	return nil
+	return change.event, models.UpdateApplied, nil
 }
 
-func (dm *DriverManager) UpdateStatus(driverID, status string) error {
-	dm.mu.Lock()
-	defer dm.mu.Unlock()
+func (dm *DriverManager) indexLocationLocked(change locationChange) error {
+	ci, _ := dm.cityIndexes(change.city)
+	if change.moved() {
+		if oldIndexes, ok := dm.cityIndexes(change.oldCity); ok {
+			oldIndexes.remove(change.driver.ID, dm.indexOrder)
+		}
+		return ci.insert(change.driver, dm.indexOrder)
+	}
+	return ci.update(change.driver, dm.indexOrder)
+}
 
-	driver, exists := dm.drivers[driverID]
+// locationChange is an update that has been published as the driver's new
+// record but not yet applied to the spatial indexes or Redis. previous and
+// previousClock are what it replaced, so a change that fails to index can be
+// rolled back; previous is nil for a driver the change registered. verdicts
+// are the anomaly checks of every update coalesced into the change, in order.
+type locationChange struct {
+	driver        *models.Driver
+	oldCity       string
+	city          string
+	event         models.DriverEvent
+	previous      *models.Driver
+	previousClock updateClock
+	verdicts      []anomaly.Verdict
+}
+
+func (c *locationChange) moved() bool {
+	return c.oldCity != c.city
+}
+
+// pendingFixes returns the latest positions of the change's updates, for
+// checking a later update to the same driver in the batch. Only the last
+// anomaly.MaxHistory are collected, so a driver repeated throughout a large
+// batch costs the same per update as one sent alone.
+func (c *locationChange) pendingFixes() []anomaly.Fix {
+	var fixes []anomaly.Fix
+	for i := len(c.verdicts) - 1; i >= 0 && len(fixes) < anomaly.MaxHistory; i-- {
+		fixes = append(append([]anomaly.Fix(nil), c.verdicts[i].Fixes...), fixes...)
+	}
+	if len(fixes) > anomaly.MaxHistory {
+		fixes = fixes[len(fixes)-anomaly.MaxHistory:]
+	}
+	return fixes
+}
+
+// commitAnomaliesLocked tells the detector about an indexed change, recording
+// any flags it raised and remembering its positions.
+func (dm *DriverManager) commitAnomaliesLocked(change *locationChange) {
+	detector := dm.Anomalies()
+	for _, verdict := range change.verdicts {
+		if len(verdict.Events) > 0 {
+			detector.Record(verdict.Events)
+		}
+		detector.Commit(change.driver.ID, verdict.Fixes...)
+	}
+}
+
+// rollbackLocked undoes a change whose indexing failed: the previous record,
+// city and device clock are restored and the previous position is put back in
+// the indexes, so a retry of the same update is applied rather than treated
+// as a duplicate.
+func (dm *DriverManager) rollbackLocked(shard *driverShard, change *locationChange) {
+	driverID := change.driver.ID
+	if ci, ok := dm.cityIndexes(change.city); ok && (change.moved() || change.previous == nil) {
+		ci.remove(driverID, dm.indexOrder)
+	}
+	if change.previous == nil {
+		shard.delete(driverID)
+		return
+	}
+
+	shard.put(change.previous)
+	shard.cities[driverID] = change.oldCity
+	if change.previousClock == (updateClock{}) {
+		delete(shard.clocks, driverID)
+	} else {
+		shard.clocks[driverID] = change.previousClock
+	}
+	if ci, ok := dm.cityIndexes(change.oldCity); ok {
+		if change.moved() {
+			ci.insert(change.previous, dm.indexOrder)
+		} else {
+			ci.update(change.previous, dm.indexOrder)
+		}
+	}
+}
+
+// stageLocationLocked runs ordering and anomaly checks for a validated update
+// and, when it is accepted, publishes a copy of the driver record at the new
+// position. pending holds the driver's fixes staged earlier in the same batch.
+// The detector only learns the new position from commitAnomaliesLocked, once
+// the change has been indexed.
+func (dm *DriverManager) stageLocationLocked(shard *driverShard, req models.UpdateLocationRequest, now time.Time, pending []anomaly.Fix) (locationChange, models.UpdateOutcome, error) {
+	driverID := validation.NormalizeID(req.DriverID)
+	lat, lng := req.Lat, req.Lng
+
+	driver, exists := shard.drivers[driverID]
 	if !exists {
-		return fmt.Errorf("driver not found: %s", driverID)
+		return locationChange{}, "", fmt.Errorf("%w: %s", ErrDriverNotFound, driverID)
 	}
 
-	driver.Status = status
-	driver.UpdatedAt = time.Now()
+	clock := updateClock{deviceTime: req.Timestamp, seq: req.Seq}
+	if outcome := shard.clocks[driverID].order(clock); outcome != models.UpdateApplied {
+		if outcome == models.UpdateStale {
+			dm.staleUpdates.Add(1)
+		} else {
+			dm.duplicateUpdates.Add(1)
+		}
+		return locationChange{}, outcome, nil
+	}
+
+	// Implied speed is more accurate between two device clocks, since
+	// network delay and retries skew the server receive times. The history
+	// the detector keeps stays on the server clock either way.
+	sample := anomaly.Sample{Location: models.Location{Lat: lat, Lng: lng}, At: now, Pending: pending}
+	if last := shard.clocks[driverID]; !last.deviceTime.IsZero() && !req.Timestamp.IsZero() {
+		sample.Elapsed = req.Timestamp.Sub(last.deviceTime)
+	}
+	verdict := dm.Anomalies().Evaluate(*driver, sample)
+	if verdict.Action == anomaly.ActionReject {
+		dm.Anomalies().Record(verdict.Events)
+		event := verdict.Events[0]
+		return locationChange{}, "", fmt.Errorf("%w: implied speed %.0f km/h over %.2f km", ErrLocationRejected, event.SpeedKmh, event.DistanceKm)
+	}
+
+	city, err := dm.geoRouter.GetCity(lat, lng)
+	if err != nil {
+		return locationChange{}, "", err
+	}
+	if _, err := dm.getOrCreateCityIndexes(city); err != nil {
+		return locationChange{}, "", err
+	}
+
+	oldCity, previous, previousClock := shard.cities[driverID], driver, shard.clocks[driverID]
+	updated := *driver
+	updated.Location = models.Location{Lat: lat, Lng: lng}
+	updated.UpdatedAt = now
+	updated.LocationUpdatedAt = now
+	updated.Version++
+	driver = &updated
+	shard.put(driver)
+	shard.cities[driverID] = city
+	shard.clocks[driverID] = previousClock.advance(clock)
+
+	timestamp := driver.UpdatedAt
+	if !req.Timestamp.IsZero() {
+		timestamp = req.Timestamp
+	}
+	return locationChange{
+		driver:        driver,
+		oldCity:       oldCity,
+		city:          city,
+		previous:      previous,
+		previousClock: previousClock,
+		verdicts:      []anomaly.Verdict{verdict},
+		event: models.DriverEvent{
+			Type:      models.EventLocationUpdated,
+			DriverID:  driverID,
+			City:      city,
+			Driver:    *driver,
+			Timestamp: timestamp,
+		},
+	}, models.UpdateApplied, nil
+}
+
+func (dm *DriverManager) RemoveDriver(driverID string) error {
+	shard := dm.shardFor(driverID)
+	shard.mu.Lock()
+	removed, city, exists := dm.removeLocked(shard, driverID)
+	shard.mu.Unlock()
+
+	if !exists {
+		return fmt.Errorf("%w: %s", ErrDriverNotFound, driverID)
+	}
+
+	dm.finishRemoval(removed, city, models.EventDriverRemoved)
 	return nil
 }
 
-func (dm *DriverManager) SearchWithIndex(lat, lng, radiusKm float64, indexType IndexType) ([]models.DriverWithDistance, time.Duration, error) {
+func (dm *DriverManager) removeLocked(shard *driverShard, driverID string) (models.Driver, string, bool) {
+	driver, exists := shard.drivers[driverID]
+	if !exists {
+		return models.Driver{}, "", false
+	}
+
+	city := shard.cities[driverID]
+	if ci, ok := dm.cityIndexes(city); ok {
+		ci.remove(driverID, dm.indexOrder)
+	}
+	shard.delete(driverID)
+	dm.Anomalies().Forget(driverID)
+	return *driver, city, true
+}
+
+func (dm *DriverManager) finishRemoval(driver models.Driver, city string, eventType models.DriverEventType) {
+	if dm.useRedis && dm.redisCache != nil {
+		if err := dm.redisCache.RemoveDriver(driver.ID, city); err != nil {
+			fmt.Printf("Redis cache error (non-fatal): %v\n", err)
+		}
+	}
+
+	dm.events.emit(models.DriverEvent{
+		Type:      eventType,
+		DriverID:  driver.ID,
+		City:      city,
+		Driver:    driver,
+		Timestamp: time.Now(),
+	})
+}
+
+func (dm *DriverManager) SearchWithIndex(lat, lng, radiusKm float64, indexType IndexType, filter models.SearchFilter) ([]models.DriverWithDistance, time.Duration, error) {
 	startTime := time.Now()
-	var drivers []*models.Driver
-
-	switch indexType {
-	case IndexTypeQuadTree:
-		drivers = dm.quadTree.SearchRadius(lat, lng, radiusKm)
-	case IndexTypeGrid:
-		drivers = dm.gridIndex.SearchRadius(lat, lng, radiusKm)
-	case IndexTypeRedis:
+	matches := filterPredicate(filter, startTime)
+	view := dm.newSearchView()
+	var candidates []geospatial.Position
+
+	// A search circle near a city's edge can reach drivers indexed under
+	// the neighbouring city, so every city it touches is searched.
+	cities := dm.citiesNear(lat, lng, radiusKm)
+
+	switch {
+	case dm.isIndexType(indexType):
+		for _, ci := range cities {
+			candidates = append(candidates, ci.index(indexType).SearchRadius(lat, lng, radiusKm)...)
+		}
+	case indexType == IndexTypeRedis:
 		if !dm.useRedis || dm.redisCache == nil {
 			return nil, 0, fmt.Errorf("Redis not enabled")
 		}
-		city, _ := dm.geoRouter.GetCity(lat, lng)
-		if city == "" {
-			city = "mumbai"
-		}
-		driverIDs, err := dm.redisCache.SearchRadius(city, lat, lng, radiusKm)
-		if err != nil {
-			return nil, 0, err
-		}
-		drivers = make([]*models.Driver, 0, len(driverIDs))
-		for _, id := range driverIDs {
-			if driver, exists := dm.drivers[id]; exists {
-				drivers = append(drivers, driver)
+		for _, ci := range cities {
+			driverIDs, err := dm.redisCache.SearchRadius(ci.city, lat, lng, radiusKm)
+			if err != nil {
+				return nil, 0, err
+			}
+			for _, id := range driverIDs {
+				candidates = append(candidates, geospatial.Position{ID: id})
 			}
 		}
 	default:
-		return nil, 0, fmt.Errorf("unknown index type: %s", indexType)
+		return nil, 0, fmt.Errorf("%w: %s", ErrUnknownIndex, indexType)
 	}
 
+	// Distances are measured from the resolved record rather than the
+	// indexed position, which may belong to an older version of the driver.
+	// A driver moving between cities can briefly be indexed in both.
 	results := make([]models.DriverWithDistance, 0)
-	for _, driver := range drivers {
-		if driver.Status != "available" {
+	seen := make(map[string]bool, len(candidates))
+	for _, candidate := range candidates {
+		if seen[candidate.ID] {
+			continue
+		}
+		seen[candidate.ID] = true
+		driver, exists := view.record(candidate.ID)
+		if !exists || !matches(driver) {
 			continue
 		}
 
@@ -172,85 +565,201 @@ func (dm *DriverManager) SearchWithIndex(lat, lng, radiusKm float64, indexType I
 		}
 	}
 
-	for i := 0; i < len(results)-1; i++ {
-		for j := 0; j < len(results)-i-1; j++ {
-			if results[j].Distance > results[j+1].Distance {
-				results[j], results[j+1] = results[j+1], results[j]
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].Distance < results[j].Distance
+	})
+
+	duration := time.Since(startTime)
+	return results, duration, nil
+}
+
+func (dm *DriverManager) FindNearest(lat, lng float64, k int, maxDistanceKm float64, indexType IndexType, filter models.SearchFilter) ([]models.DriverWithDistance, time.Duration, error) {
+	startTime := time.Now()
+	if k <= 0 {
+		return nil, 0, fmt.Errorf("k must be positive")
+	}
+
+	view := dm.newSearchView()
+	matches := view.filter(filterPredicate(filter, startTime))
+
+	if !dm.isIndexType(indexType) && indexType != IndexTypeRedis {
+		return nil, 0, fmt.Errorf("%w: %s", ErrUnknownIndex, indexType)
+	}
+	if indexType == IndexTypeRedis && (!dm.useRedis || dm.redisCache == nil) {
+		return nil, 0, fmt.Errorf("Redis not enabled")
+	}
+
+	// Cities come nearest first, so once k neighbours are closer than the
+	// next city's bounds no later city can improve on them.
+	var neighbors []geospatial.Neighbor
+	for _, ci := range dm.citiesNear(lat, lng, maxDistanceKm) {
+		if len(neighbors) == k && neighbors[k-1].Distance < ci.bounds.MinDistanceKm(lat, lng) {
+			break
+		}
+
+		var found []geospatial.Neighbor
+		if indexType == IndexTypeRedis {
+			var err error
+			found, err = dm.nearestFromRedis(view, ci.city, lat, lng, k, maxDistanceKm, matches)
+			if err != nil {
+				return nil, 0, err
 			}
+		} else {
+			found = ci.index(indexType).Nearest(lat, lng, k, maxDistanceKm, matches)
+		}
+
+		neighbors = mergeNeighbors(neighbors, found, k)
+	}
+
+	results := make([]models.DriverWithDistance, 0, len(neighbors))
+	for _, neighbor := range neighbors {
+		result, exists := view.resolve(lat, lng, neighbor)
+		if !exists || (maxDistanceKm > 0 && result.Distance > maxDistanceKm) {
+			continue
 		}
+		results = append(results, result)
 	}
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].Distance < results[j].Distance
+	})
 
 	duration := time.Since(startTime)
 	return results, duration, nil
 }
 
-func (dm *DriverManager) CompareIndexes(lat, lng, radiusKm float64) models.ComparisonResult {
-	comparison := models.ComparisonResult{}
-
-	qtResults, qtDuration, _ := dm.SearchWithIndex(lat, lng, radiusKm, IndexTypeQuadTree)
-	comparison.QuadTree = map[string]interface{}{
-		"count":    len(qtResults),
-		"duration": qtDuration.String(),
+// mergeNeighbors returns the k nearest of a and b, keeping only the nearer
+// entry of a driver found in two cities.
+func mergeNeighbors(a, b []geospatial.Neighbor, k int) []geospatial.Neighbor {
+	merged := append(a, b...)
+	sort.SliceStable(merged, func(i, j int) bool {
+		return merged[i].Distance < merged[j].Distance
+	})
+
+	seen := make(map[string]bool, len(merged))
+	neighbors := merged[:0]
+	for _, neighbor := range merged {
+		if seen[neighbor.Position.ID] || len(neighbors) == k {
+			continue
+		}
+		seen[neighbor.Position.ID] = true
+		neighbors = append(neighbors, neighbor)
 	}
+	return neighbors
+}
 
-	gridResults, gridDuration, _ := dm.SearchWithIndex(lat, lng, radiusKm, IndexTypeGrid)
-	comparison.Grid = map[string]interface{}{
-		"count":    len(gridResults),
-		"duration": gridDuration.String(),
-	}
+func (dm *DriverManager) nearestFromRedis(view *searchView, city string, lat, lng float64, k int, maxDistanceKm float64, filter geospatial.Filter) ([]geospatial.Neighbor, error) {
+	count := min(k, maxRedisNearestCount)
+	for {
+		driverIDs, err := dm.redisCache.SearchNearest(city, lat, lng, count, maxDistanceKm)
+		if err != nil {
+			return nil, err
+		}
 
-	if dm.useRedis && dm.redisCache != nil {
-		redisResults, redisDuration, err := dm.SearchWithIndex(lat, lng, radiusKm, IndexTypeRedis)
-		if err == nil {
-			comparison.Redis = map[string]interface{}{
-				"count":    len(redisResults),
-				"duration": redisDuration.String(),
+		neighbors := make([]geospatial.Neighbor, 0)
+		for _, id := range driverIDs {
+			driver, exists := view.record(id)
+			if !exists {
+				continue
+			}
+			position := positionOf(driver)
+			if !filter(position) {
+				continue
+			}
+			neighbors = append(neighbors, geospatial.Neighbor{
+				Position: position,
+				Distance: geospatial.Haversine(lat, lng, position.Lat, position.Lng),
+			})
+			if len(neighbors) == k {
+				break
 			}
 		}
+
+		if len(neighbors) == k || len(driverIDs) < count || count == maxRedisNearestCount {
+			return neighbors, nil
+		}
+		count = min(count*2, maxRedisNearestCount)
+	}
+}
+
+func (dm *DriverManager) CompareIndexes(lat, lng, radiusKm float64, filter models.SearchFilter) models.ComparisonResult {
+	comparison := models.ComparisonResult{}
+
+	for _, indexType := range dm.IndexTypes() {
+		results, duration, err := dm.SearchWithIndex(lat, lng, radiusKm, indexType, filter)
+		if err != nil {
+			continue
+		}
+		comparison[string(indexType)] = map[string]interface{}{
+			"count":    len(results),
+			"duration": duration.String(),
+		}
 	}
 
 	return comparison
 }
 
+func (dm *DriverManager) IndexTypes() []IndexType {
+	types := make([]IndexType, 0, len(dm.indexOrder)+1)
+	types = append(types, dm.indexOrder...)
+	if dm.useRedis && dm.redisCache != nil {
+		types = append(types, IndexTypeRedis)
+	}
+	sort.Slice(types, func(i, j int) bool { return types[i] < types[j] })
+	return types
+}
+
 func (dm *DriverManager) GetStats() map[string]interface{} {
-	dm.mu.RLock()
-	defer dm.mu.RUnlock()
-
-	available := 0
-	busy := 0
-	offline := 0
-
-	for _, driver := range dm.drivers {
-		switch driver.Status {
-		case "available":
-			available++
-		case "busy":
-			busy++
-		case "offline":
-			offline++
+	totalDrivers := 0
+	statusCounts := make(map[models.DriverStatus]int)
+	cityDrivers := make(map[string]int)
+	for _, shard := range dm.shards {
+		shard.mu.RLock()
+		totalDrivers += len(shard.drivers)
+		for driverID, driver := range shard.drivers {
+			statusCounts[driver.Status]++
+			cityDrivers[shard.cities[driverID]]++
 		}
+		shard.mu.RUnlock()
 	}
 
 	stats := map[string]interface{}{
-		"total_drivers":     len(dm.drivers),
-		"available_drivers": available,
-		"busy_drivers":      busy,
-		"offline_drivers":   offline,
-		"grid_stats":        dm.gridIndex.GetStats(),
+		"total_drivers":   totalDrivers,
+		"stale_drivers":   dm.staleCount.Load(),
+		"evicted_drivers": dm.evictCount.Load(),
+
+		"dropped_stale_updates": dm.staleUpdates.Load(),
+		"duplicate_updates":     dm.duplicateUpdates.Load(),
+	}
+	for _, status := range models.DriverStatuses() {
+		stats[string(status)+"_drivers"] = statusCounts[status]
 	}
 
-	if dm.useRedis && dm.redisCache != nil {
-		redisStats, _ := dm.redisCache.GetStats("mumbai")
-		stats["redis_stats"] = redisStats
+	cityStats := make(map[string]interface{})
+	for _, city := range dm.geoRouter.ListCities() {
+		entry := map[string]interface{}{
+			"total_drivers": cityDrivers[city],
+		}
+		if ci, exists := dm.cityIndexes(city); exists {
+			for key, value := range ci.stats(dm.indexOrder) {
+				entry[key] = value
+			}
+		}
+		if dm.useRedis && dm.redisCache != nil {
+			redisStats, _ := dm.redisCache.GetStats(city)
+			entry["redis_stats"] = redisStats
+		}
+		cityStats[city] = entry
 	}
+	stats["city_stats"] = cityStats
+	stats["anomalies"] = dm.Anomalies().Stats()
 
 	return stats
 }
 
 func (dm *DriverManager) Close() error {
+	dm.StopJanitor()
 	if dm.redisCache != nil {
 		return dm.redisCache.Close()
 	}
 	return nil
 }
-
@@ -0,0 +1,53 @@
+package manager
+
+import (
+	"testing"
+	"time"
+	"uber-system/pkg/anomaly"
+	"uber-system/pkg/models"
+)
+
+func newTestManager(t *testing.T) *DriverManager {
+	t.Helper()
+	dm, err := NewDriverManager("", false)
+	if err != nil {
+		t.Fatalf("NewDriverManager: %v", err)
+	}
+	t.Cleanup(func() { dm.Close() })
+	return dm
+}
+
+func addTestDriver(t *testing.T, dm *DriverManager, id string, lat, lng float64) {
+	t.Helper()
+	driver := &models.Driver{ID: id, Location: models.Location{Lat: lat, Lng: lng}, Status: models.StatusAvailable}
+	if err := dm.AddDriver(driver); err != nil {
+		t.Fatalf("AddDriver %s: %v", id, err)
+	}
+}
+
+func TestRejectedUpdateIsNotRememberedByAnomalyDetector(t *testing.T) {
+	dm := newTestManager(t)
+	// Speed checks are off so only the history the detector keeps matters.
+	dm.SetAnomalyDetector(anomaly.NewDetector(anomaly.Config{
+		OscillationJumpKm:   1,
+		OscillationReturnKm: 0.1,
+		OscillationWindow:   time.Minute,
+	}))
+	addTestDriver(t, dm, "driver-1", 13.1300, 77.6000)
+
+	// Just north of Bangalore, where no city is registered.
+	if err := dm.UpdateLocation("driver-1", 13.1480, 77.6000); err == nil {
+		t.Fatal("update outside every city succeeded")
+	}
+	if err := dm.UpdateLocation("driver-1", 13.1301, 77.6000); err != nil {
+		t.Fatalf("UpdateLocation: %v", err)
+	}
+	// A real trip to the city's edge, close to the rejected position.
+	if err := dm.UpdateLocation("driver-1", 13.1475, 77.6000); err != nil {
+		t.Fatalf("UpdateLocation: %v", err)
+	}
+
+	if events := dm.Anomalies().Events("", time.Time{}, 0); len(events) != 0 {
+		t.Fatalf("anomalies reported: %+v", events)
+	}
+}
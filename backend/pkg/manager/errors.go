@@ -0,0 +1,13 @@
+package manager
+
+import "errors"
+
+var (
+	ErrDriverNotFound    = errors.New("driver not found")
+	ErrDriverExists      = errors.New("driver already exists")
+	ErrStatusConflict    = errors.New("driver status changed")
+	ErrInvalidStatus     = errors.New("invalid driver status")
+	ErrInvalidTransition = errors.New("invalid status transition")
+	ErrLocationRejected  = errors.New("location update rejected")
+	ErrUnknownIndex      = errors.New("unknown index type")
+)
@@ -0,0 +1,31 @@
+package manager
+
+import (
+	"sync"
+	"uber-system/pkg/models"
+)
+
+type eventBus struct {
+	listeners []func(models.DriverEvent)
+	mu        sync.RWMutex
+}
+
+func (eb *eventBus) subscribe(listener func(models.DriverEvent)) {
+	eb.mu.Lock()
+	defer eb.mu.Unlock()
+	eb.listeners = append(eb.listeners, listener)
+}
+
+func (eb *eventBus) emit(event models.DriverEvent) {
+	eb.mu.RLock()
+	listeners := eb.listeners
+	eb.mu.RUnlock()
+
+	for _, listener := range listeners {
+		listener(event)
+	}
+}
+
+func (dm *DriverManager) Subscribe(listener func(models.DriverEvent)) {
+	dm.events.subscribe(listener)
+}
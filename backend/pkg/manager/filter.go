@@ -0,0 +1,100 @@
+package manager
+
+import (
+	"strings"
+	"time"
+	"uber-system/pkg/geospatial"
+	"uber-system/pkg/models"
+)
+
+var defaultSearchStatuses = []models.DriverStatus{models.StatusAvailable}
+
+type driverPredicate func(driver *models.Driver) bool
+
+func filterPredicate(filter models.SearchFilter, now time.Time) driverPredicate {
+	statuses := filter.Statuses
+	if len(statuses) == 0 {
+		statuses = defaultSearchStatuses
+	}
+	maxAge := time.Duration(filter.MaxLocationAge * float64(time.Second))
+
+	return func(driver *models.Driver) bool {
+		if !containsStatus(statuses, driver.Status) {
+			return false
+		}
+		if len(filter.CarTypes) > 0 && !containsFold(filter.CarTypes, driver.CarType) {
+			return false
+		}
+		if filter.MinRating > 0 && driver.Rating < filter.MinRating {
+			return false
+		}
+		if maxAge > 0 && now.Sub(driver.LocationUpdatedAt) > maxAge {
+			return false
+		}
+		return true
+	}
+}
+
+// searchView resolves index positions to driver records for one query. Each
+// driver is looked up once, so the filter and the result always see the same
+// record, even if the driver is updated while the query runs.
+type searchView struct {
+	dm      *DriverManager
+	records map[string]*models.Driver
+}
+
+func (dm *DriverManager) newSearchView() *searchView {
+	return &searchView{dm: dm, records: make(map[string]*models.Driver)}
+}
+
+func (v *searchView) record(driverID string) (*models.Driver, bool) {
+	if driver, seen := v.records[driverID]; seen {
+		return driver, driver != nil
+	}
+	driver, exists := v.dm.lookup(driverID)
+	if !exists {
+		driver = nil
+	}
+	v.records[driverID] = driver
+	return driver, exists
+}
+
+func (v *searchView) filter(matches driverPredicate) geospatial.Filter {
+	return func(position geospatial.Position) bool {
+		driver, exists := v.record(position.ID)
+		return exists && matches(driver)
+	}
+}
+
+// resolve pairs a neighbor with the record the view holds for it. When the
+// record is newer than the indexed position, the distance is measured again
+// from the record so the result never mixes two versions of a driver.
+func (v *searchView) resolve(lat, lng float64, neighbor geospatial.Neighbor) (models.DriverWithDistance, bool) {
+	driver, exists := v.record(neighbor.Position.ID)
+	if !exists {
+		return models.DriverWithDistance{}, false
+	}
+	distance := neighbor.Distance
+	if driver.Version != neighbor.Position.Version {
+		distance = geospatial.Haversine(lat, lng, driver.Location.Lat, driver.Location.Lng)
+	}
+	return models.DriverWithDistance{Driver: *driver, Distance: distance}, true
+}
+
+func containsFold(values []string, value string) bool {
+	for _, candidate := range values {
+		if strings.EqualFold(candidate, value) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsStatus(statuses []models.DriverStatus, status models.DriverStatus) bool {
+	for _, candidate := range statuses {
+		if candidate == status {
+			return true
+		}
+	}
+	return false
+}
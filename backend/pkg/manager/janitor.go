@@ -0,0 +1,122 @@
+package manager
+
+import (
+	"sync"
+	"time"
+	"uber-system/pkg/models"
+)
+
+// JanitorConfig sets when SweepStale acts on a driver whose location has
+// stopped arriving. A stale driver is marked offline and stays offline when
+// its updates resume: like a driver who went offline on purpose, it needs a
+// status update to become available and searchable again.
+type JanitorConfig struct {
+	StaleAfter time.Duration
+	EvictAfter time.Duration
+	Interval   time.Duration
+}
+
+type janitor struct {
+	config JanitorConfig
+	stop   chan struct{}
+	wg     sync.WaitGroup
+}
+
+func (dm *DriverManager) StartJanitor(config JanitorConfig) {
+	dm.StopJanitor()
+
+	if config.Interval <= 0 {
+		config.Interval = time.Minute
+	}
+
+	j := &janitor{
+		config: config,
+		stop:   make(chan struct{}),
+	}
+	j.wg.Add(1)
+	go func() {
+		defer j.wg.Done()
+		ticker := time.NewTicker(config.Interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-j.stop:
+				return
+			case now := <-ticker.C:
+				dm.SweepStale(config, now)
+			}
+		}
+	}()
+
+	dm.janitorMu.Lock()
+	dm.janitor = j
+	dm.janitorMu.Unlock()
+}
+
+func (dm *DriverManager) StopJanitor() {
+	dm.janitorMu.Lock()
+	j := dm.janitor
+	dm.janitor = nil
+	dm.janitorMu.Unlock()
+
+	if j != nil {
+		close(j.stop)
+		j.wg.Wait()
+	}
+}
+
+func (dm *DriverManager) SweepStale(config JanitorConfig, now time.Time) (int, int) {
+	type removal struct {
+		driver models.Driver
+		city   string
+	}
+
+	stale := make([]models.DriverEvent, 0)
+	evicted := make([]removal, 0)
+
+	for _, shard := range dm.shards {
+		shard.mu.Lock()
+		for id, driver := range shard.drivers {
+			// Status changes do not count: a driver is stale once its
+			// location stops arriving.
+			age := now.Sub(driver.LocationUpdatedAt)
+
+			if config.EvictAfter > 0 && age > config.EvictAfter {
+				if removed, city, ok := dm.removeLocked(shard, id); ok {
+					evicted = append(evicted, removal{driver: removed, city: city})
+				}
+				continue
+			}
+
+			if config.StaleAfter > 0 && age > config.StaleAfter && driver.Status != models.StatusOffline {
+				updated, err := dm.transitionLocked(shard, driver, models.StatusOffline, "stale", now)
+				if err != nil {
+					continue
+				}
+				if err := dm.publishLocked(shard, updated); err != nil {
+					continue
+				}
+				stale = append(stale, models.DriverEvent{
+					Type:      models.EventDriverStale,
+					DriverID:  id,
+					City:      shard.cities[id],
+					Driver:    *updated,
+					Timestamp: now,
+				})
+			}
+		}
+		shard.mu.Unlock()
+	}
+	dm.staleCount.Add(int64(len(stale)))
+	dm.evictCount.Add(int64(len(evicted)))
+
+	for _, event := range stale {
+		dm.events.emit(event)
+	}
+	for _, r := range evicted {
+		dm.finishRemoval(r.driver, r.city, models.EventDriverEvicted)
+	}
+
+	return len(stale), len(evicted)
+}
@@ -0,0 +1,50 @@
+package manager
+
+import (
+	"testing"
+	"time"
+	"uber-system/pkg/models"
+)
+
+func TestSweepStaleUsesLocationAge(t *testing.T) {
+	dm := newTestManager(t)
+	now := time.Now()
+	located := now.Add(-10 * time.Minute)
+	dm.ReplayLocations([]ReplayedLocation{
+		{DriverID: "driver-1", Lat: 12.97, Lng: 77.59, At: located},
+		{DriverID: "driver-2", Lat: 12.98, Lng: 77.60, At: located},
+	})
+	// Toggling status refreshes UpdatedAt but says nothing about where
+	// driver-2 is.
+	for _, status := range []models.DriverStatus{models.StatusOffline, models.StatusAvailable} {
+		if err := dm.UpdateStatus("driver-2", status); err != nil {
+			t.Fatalf("UpdateStatus %s: %v", status, err)
+		}
+	}
+
+	config := JanitorConfig{StaleAfter: 5 * time.Minute, EvictAfter: 30 * time.Minute}
+	if stale, evicted := dm.SweepStale(config, now.Add(-6*time.Minute)); stale != 0 || evicted != 0 {
+		t.Fatalf("sweep before StaleAfter = %d stale, %d evicted", stale, evicted)
+	}
+	if stale, evicted := dm.SweepStale(config, now); stale != 2 || evicted != 0 {
+		t.Fatalf("sweep = %d stale, %d evicted, want 2 stale", stale, evicted)
+	}
+	for _, id := range []string{"driver-1", "driver-2"} {
+		if driver, _ := dm.lookup(id); driver.Status != models.StatusOffline {
+			t.Fatalf("%s is %s, want offline", id, driver.Status)
+		}
+	}
+
+	if err := dm.UpdateLocation("driver-1", 12.9701, 77.59); err != nil {
+		t.Fatalf("UpdateLocation: %v", err)
+	}
+	if stale, evicted := dm.SweepStale(config, now.Add(25*time.Minute)); stale != 0 || evicted != 1 {
+		t.Fatalf("sweep = %d stale, %d evicted, want driver-2 evicted", stale, evicted)
+	}
+	if _, exists := dm.lookup("driver-2"); exists {
+		t.Fatal("driver-2 was not evicted")
+	}
+	if _, exists := dm.lookup("driver-1"); !exists {
+		t.Fatal("driver-1 was evicted")
+	}
+}
@@ -0,0 +1,52 @@
+package manager
+
+import (
+	"time"
+	"uber-system/pkg/models"
+)
+
+// updateClock is the newest device clock applied for a driver. Updates are
+// ordered by device timestamp, then by sequence number; when neither side
+// carries a comparable field the update is applied as it arrives.
+type updateClock struct {
+	deviceTime time.Time
+	seq        uint64
+}
+
+func (last updateClock) order(next updateClock) models.UpdateOutcome {
+	ordered := false
+	cmp := 0
+
+	if !last.deviceTime.IsZero() && !next.deviceTime.IsZero() {
+		ordered = true
+		cmp = next.deviceTime.Compare(last.deviceTime)
+	}
+	if cmp == 0 && last.seq > 0 && next.seq > 0 {
+		ordered = true
+		switch {
+		case next.seq < last.seq:
+			cmp = -1
+		case next.seq > last.seq:
+			cmp = 1
+		}
+	}
+
+	switch {
+	case !ordered || cmp > 0:
+		return models.UpdateApplied
+	case cmp == 0:
+		return models.UpdateDuplicate
+	default:
+		return models.UpdateStale
+	}
+}
+
+func (last updateClock) advance(next updateClock) updateClock {
+	if !next.deviceTime.IsZero() {
+		last.deviceTime = next.deviceTime
+	}
+	if next.seq > 0 {
+		last.seq = next.seq
+	}
+	return last
+}
@@ -0,0 +1,91 @@
+package manager
+
+import (
+	"testing"
+	"time"
+	"uber-system/pkg/models"
+)
+
+func TestUpdateClockOrder(t *testing.T) {
+	t0 := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	t1 := t0.Add(time.Second)
+	t2 := t0.Add(2 * time.Second)
+
+	tests := []struct {
+		name       string
+		last, next updateClock
+		want       models.UpdateOutcome
+	}{
+		{"no clocks", updateClock{}, updateClock{}, models.UpdateApplied},
+		{"first timestamp", updateClock{}, updateClock{deviceTime: t1}, models.UpdateApplied},
+		{"first seq", updateClock{}, updateClock{seq: 1}, models.UpdateApplied},
+		{"next has no clock", updateClock{deviceTime: t1, seq: 5}, updateClock{}, models.UpdateApplied},
+
+		{"later timestamp", updateClock{deviceTime: t1}, updateClock{deviceTime: t2}, models.UpdateApplied},
+		{"earlier timestamp", updateClock{deviceTime: t1}, updateClock{deviceTime: t0}, models.UpdateStale},
+		{"same timestamp", updateClock{deviceTime: t1}, updateClock{deviceTime: t1}, models.UpdateDuplicate},
+
+		{"higher seq", updateClock{seq: 5}, updateClock{seq: 6}, models.UpdateApplied},
+		{"lower seq", updateClock{seq: 5}, updateClock{seq: 4}, models.UpdateStale},
+		{"same seq", updateClock{seq: 5}, updateClock{seq: 5}, models.UpdateDuplicate},
+
+		{"timestamp wins over lower seq", updateClock{deviceTime: t1, seq: 5}, updateClock{deviceTime: t2, seq: 1}, models.UpdateApplied},
+		{"timestamp wins over higher seq", updateClock{deviceTime: t1, seq: 5}, updateClock{deviceTime: t0, seq: 9}, models.UpdateStale},
+		{"same timestamp, higher seq", updateClock{deviceTime: t1, seq: 5}, updateClock{deviceTime: t1, seq: 6}, models.UpdateApplied},
+		{"same timestamp, lower seq", updateClock{deviceTime: t1, seq: 5}, updateClock{deviceTime: t1, seq: 4}, models.UpdateStale},
+		{"same timestamp and seq", updateClock{deviceTime: t1, seq: 5}, updateClock{deviceTime: t1, seq: 5}, models.UpdateDuplicate},
+		{"same timestamp, only last has seq", updateClock{deviceTime: t1, seq: 5}, updateClock{deviceTime: t1}, models.UpdateDuplicate},
+		{"same timestamp, only next has seq", updateClock{deviceTime: t1}, updateClock{deviceTime: t1, seq: 5}, models.UpdateDuplicate},
+
+		{"seq only after both", updateClock{deviceTime: t1, seq: 5}, updateClock{seq: 6}, models.UpdateApplied},
+		{"lower seq only after both", updateClock{deviceTime: t1, seq: 5}, updateClock{seq: 4}, models.UpdateStale},
+		{"same seq only after both", updateClock{deviceTime: t1, seq: 5}, updateClock{seq: 5}, models.UpdateDuplicate},
+		{"earlier timestamp only after both", updateClock{deviceTime: t1, seq: 5}, updateClock{deviceTime: t0}, models.UpdateStale},
+		{"same timestamp only after both", updateClock{deviceTime: t1, seq: 5}, updateClock{deviceTime: t1}, models.UpdateDuplicate},
+
+		{"seq after timestamp only", updateClock{deviceTime: t1}, updateClock{seq: 1}, models.UpdateApplied},
+		{"timestamp after seq only", updateClock{seq: 5}, updateClock{deviceTime: t0}, models.UpdateApplied},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.last.order(tt.next); got != tt.want {
+				t.Fatalf("order = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUpdateClockAdvanceKeepsMissingFields(t *testing.T) {
+	t1 := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	t2 := t1.Add(time.Second)
+
+	// A stream that alternates between seq-only and timestamp-only updates
+	// must still reject a replay of either kind.
+	var clock updateClock
+	steps := []struct {
+		next updateClock
+		want models.UpdateOutcome
+	}{
+		{updateClock{deviceTime: t1, seq: 5}, models.UpdateApplied},
+		{updateClock{seq: 6}, models.UpdateApplied},
+		{updateClock{seq: 6}, models.UpdateDuplicate},
+		{updateClock{deviceTime: t2}, models.UpdateApplied},
+		{updateClock{deviceTime: t1}, models.UpdateStale},
+		{updateClock{seq: 5}, models.UpdateStale},
+		{updateClock{deviceTime: t2, seq: 7}, models.UpdateApplied},
+		{updateClock{}, models.UpdateApplied},
+		{updateClock{deviceTime: t2, seq: 7}, models.UpdateDuplicate},
+	}
+	for i, step := range steps {
+		got := clock.order(step.next)
+		if got != step.want {
+			t.Fatalf("step %d: order(%+v) after %+v = %v, want %v", i, step.next, clock, got, step.want)
+		}
+		if got == models.UpdateApplied {
+			clock = clock.advance(step.next)
+		}
+	}
+	if want := (updateClock{deviceTime: t2, seq: 7}); clock != want {
+		t.Fatalf("clock = %+v, want %+v", clock, want)
+	}
+}
@@ -0,0 +1,120 @@
+package manager
+
+import (
+	"fmt"
+	"time"
+	"uber-system/pkg/geospatial"
+)
+
+type RebuildReport struct {
+	Index    IndexType     `json:"index"`
+	Cities   int           `json:"cities"`
+	Drivers  int           `json:"drivers"`
+	CaughtUp int           `json:"caught_up"`
+	Duration time.Duration `json:"duration"`
+	Paused   time.Duration `json:"paused"`
+}
+
+// RebuildIndex replaces every city's index of indexType with a freshly built
+// one. Positions are collected one shard at a time and the new indexes are
+// built with no locks held, so updates and searches carry on against the old
+// indexes meanwhile. Writers are then paused just long enough to apply the
+// changes made since collection, by comparing indexed positions, before each
+// new index is swapped in. Searches never wait: they use whichever index
+// they loaded.
+func (dm *DriverManager) RebuildIndex(indexType IndexType) (RebuildReport, error) {
+	if !dm.isIndexType(indexType) {
+		return RebuildReport{}, fmt.Errorf("%w: %s", ErrUnknownIndex, indexType)
+	}
+
+	dm.rebuildMu.Lock()
+	defer dm.rebuildMu.Unlock()
+
+	start := time.Now()
+	report := RebuildReport{Index: indexType}
+
+	dm.citiesMu.RLock()
+	cities := make(map[string]*cityIndexes, len(dm.cities))
+	for city, ci := range dm.cities {
+		cities[city] = ci
+	}
+	dm.citiesMu.RUnlock()
+
+	positions := make(map[string][]geospatial.Position, len(cities))
+	for _, shard := range dm.shards {
+		shard.mu.RLock()
+		for driverID, driver := range shard.drivers {
+			city := shard.cities[driverID]
+			if _, exists := cities[city]; exists {
+				positions[city] = append(positions[city], positionOf(driver))
+			}
+		}
+		shard.mu.RUnlock()
+	}
+
+	built := make(map[string]geospatial.SpatialIndex, len(cities))
+	indexed := make(map[string]map[string]geospatial.Position, len(cities))
+	for city, ci := range cities {
+		index, err := ci.build(indexType, positions[city])
+		if err != nil {
+			return report, err
+		}
+		built[city] = index
+		indexed[city] = make(map[string]geospatial.Position, len(positions[city]))
+		for _, position := range positions[city] {
+			indexed[city][position.ID] = position
+		}
+		report.Drivers += len(positions[city])
+	}
+
+	paused := time.Now()
+	dm.lockAll()
+	defer dm.unlockAll()
+
+	for _, shard := range dm.shards {
+		for driverID, city := range shard.cities {
+			index, exists := built[city]
+			if !exists {
+				continue
+			}
+			// Versions restart when a driver is removed and added again, so
+			// the whole position is compared rather than just the version.
+			position := positionOf(shard.drivers[driverID])
+			collected, wasIndexed := indexed[city][driverID]
+			delete(indexed[city], driverID)
+			if wasIndexed && collected == position {
+				continue
+			}
+			var err error
+			if wasIndexed {
+				err = index.Update(position)
+			} else {
+				err = index.Insert(position)
+			}
+			if err != nil {
+				return report, fmt.Errorf("failed to catch up %s index for %s: %w", indexType, city, err)
+			}
+			report.CaughtUp++
+		}
+	}
+
+	dm.citiesMu.RLock()
+	defer dm.citiesMu.RUnlock()
+	for city, index := range built {
+		// A restore while the index was building replaces the city entries;
+		// the rebuilt index belongs to a driver set that no longer exists.
+		if dm.cities[city] != cities[city] {
+			continue
+		}
+		for driverID := range indexed[city] {
+			index.Remove(driverID)
+			report.CaughtUp++
+		}
+		cities[city].indexes[indexType].store(index)
+		report.Cities++
+	}
+
+	report.Paused = time.Since(paused)
+	report.Duration = time.Since(start)
+	return report, nil
+}
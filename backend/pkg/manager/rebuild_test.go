@@ -0,0 +1,67 @@
+package manager
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestRebuildIndexDuringUpdates(t *testing.T) {
+	const drivers = 5000
+	dm := newStressManager(t, drivers)
+
+	var stop atomic.Bool
+	var wg sync.WaitGroup
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func(seed int64) {
+			defer wg.Done()
+			rng := rand.New(rand.NewSource(seed))
+			for !stop.Load() {
+				city := stressCities[rng.Intn(len(stressCities))]
+				lat, lng := city.random(rng)
+				dm.UpdateLocation(fmt.Sprintf("driver-%d", rng.Intn(drivers)), lat, lng)
+			}
+		}(int64(w))
+	}
+
+	for round := 0; round < 3; round++ {
+		for _, indexType := range dm.indexOrder {
+			report, err := dm.RebuildIndex(indexType)
+			if err != nil {
+				t.Fatalf("RebuildIndex %s: %v", indexType, err)
+			}
+			if report.Drivers != drivers {
+				t.Errorf("rebuild of %s collected %d drivers, want %d", indexType, report.Drivers, drivers)
+			}
+		}
+	}
+	stop.Store(true)
+	wg.Wait()
+
+	checkIndexesMatchDrivers(t, dm)
+	for _, shard := range dm.shards {
+		for driverID, driver := range shard.drivers {
+			ci, _ := dm.cityIndexes(shard.cities[driverID])
+			for _, indexType := range dm.indexOrder {
+				found := false
+				for _, position := range ci.index(indexType).SearchRadius(driver.Location.Lat, driver.Location.Lng, 0.01) {
+					if position.ID == driverID {
+						found = position == positionOf(driver)
+						break
+					}
+				}
+				if !found {
+					t.Errorf("%s index does not hold %s at its latest position", indexType, driverID)
+				}
+			}
+		}
+	}
+
+	if _, err := dm.RebuildIndex("rtree"); !errors.Is(err, ErrUnknownIndex) {
+		t.Fatalf("RebuildIndex of an unknown index = %v, want ErrUnknownIndex", err)
+	}
+}
@@ -0,0 +1,228 @@
+package manager
+
+import (
+	"fmt"
+	"sort"
+	"time"
+	"uber-system/pkg/geospatial"
+	"uber-system/pkg/models"
+	"uber-system/pkg/validation"
+)
+
+// ReplayedLocation is a position recovered from the ingestion log or the
+// location history, stamped with the time it was originally recorded.
+type ReplayedLocation struct {
+	DriverID string
+	Lat      float64
+	Lng      float64
+	At       time.Time
+	Seq      uint64
+}
+
+// ReplayLocations rebuilds driver positions without anomaly checks, Redis
+// writes or events, keeping the original timestamps so staleness is judged
+// as it would have been before the restart. A position older than the one
+// already held is reported stale. Unknown drivers are registered from their
+// Redis metadata when available, otherwise as available with no metadata.
+func (dm *DriverManager) ReplayLocations(locations []ReplayedLocation) []LocationUpdateResult {
+	results := make([]LocationUpdateResult, len(locations))
+	valid := make([]int, 0, len(locations))
+	cities := make([]string, len(locations))
+	for i, location := range locations {
+		driverID := validation.NormalizeID(location.DriverID)
+		results[i].DriverID = driverID
+
+		var errs validation.Errors
+		validation.CheckID(&errs, "driver_id", driverID)
+		validation.CheckCoordinates(&errs, "", location.Lat, location.Lng)
+		if err := errs.Err(); err != nil {
+			results[i].Err = err
+			continue
+		}
+
+		city, err := dm.geoRouter.GetCity(location.Lat, location.Lng)
+		if err != nil {
+			results[i].Err = err
+			continue
+		}
+		if _, err := dm.getOrCreateCityIndexes(city); err != nil {
+			results[i].Err = err
+			continue
+		}
+		cities[i] = city
+		valid = append(valid, i)
+	}
+
+	cached := dm.replayMetadata(valid, results)
+	for _, group := range dm.groupByShard(valid, func(i int) string { return results[i].DriverID }) {
+		shard := group.shard
+		changes := make(map[string]*locationChange)
+		items := make(map[string][]int)
+		order := make([]string, 0, len(group.items))
+
+		shard.mu.Lock()
+		for _, i := range group.items {
+			location, driverID, city := locations[i], results[i].DriverID, cities[i]
+
+			driver, exists := shard.drivers[driverID]
+			previous := driver
+			if !exists {
+				driver = replayDriver(driverID, cached[driverID])
+				shard.recordTransition(driverID, "", driver.Status, "replayed", location.At)
+				results[i].Registered = true
+			} else if location.At.Before(driver.LocationUpdatedAt) {
+				results[i].Outcome = models.UpdateStale
+				continue
+			}
+
+			oldCity, previousClock := shard.cities[driverID], shard.clocks[driverID]
+			updated := *driver
+			updated.Location = models.Location{Lat: location.Lat, Lng: location.Lng}
+			updated.UpdatedAt = location.At
+			updated.LocationUpdatedAt = location.At
+			updated.Version++
+			driver = &updated
+			shard.put(driver)
+			shard.cities[driverID] = city
+			shard.clocks[driverID] = previousClock.advance(updateClock{deviceTime: location.At, seq: location.Seq})
+			results[i].Outcome = models.UpdateApplied
+
+			items[driverID] = append(items[driverID], i)
+			if pending, exists := changes[driverID]; exists {
+				pending.driver, pending.city = driver, city
+				continue
+			}
+			changes[driverID] = &locationChange{
+				driver:        driver,
+				oldCity:       oldCity,
+				city:          city,
+				previous:      previous,
+				previousClock: previousClock,
+			}
+			order = append(order, driverID)
+		}
+
+		failed := dm.indexLocationsLocked(changes, order)
+		for driverID := range failed {
+			dm.rollbackLocked(shard, changes[driverID])
+		}
+		shard.mu.Unlock()
+
+		for driverID, err := range failed {
+			for _, i := range items[driverID] {
+				results[i].Outcome, results[i].Err = "", err
+			}
+		}
+	}
+	return results
+}
+
+// replayMetadata reads the Redis metadata of drivers the manager does not
+// know yet, before any shard is locked.
+func (dm *DriverManager) replayMetadata(items []int, results []LocationUpdateResult) map[string]*models.Driver {
+	cached := make(map[string]*models.Driver)
+	if !dm.useRedis || dm.redisCache == nil {
+		return cached
+	}
+	for _, i := range items {
+		driverID := results[i].DriverID
+		if _, seen := cached[driverID]; seen {
+			continue
+		}
+		if _, exists := dm.lookup(driverID); exists {
+			continue
+		}
+		driver, err := dm.redisCache.GetDriver(driverID)
+		if err != nil || !driver.Status.IsValid() {
+			driver = nil
+		}
+		cached[driverID] = driver
+	}
+	return cached
+}
+
+func replayDriver(driverID string, cached *models.Driver) *models.Driver {
+	if cached != nil {
+		driver := *cached
+		return &driver
+	}
+	return &models.Driver{ID: driverID, Status: models.StatusAvailable}
+}
+
+type ConsistencyReport struct {
+	Checked    int                 `json:"checked"`
+	Consistent bool                `json:"consistent"`
+	Missing    map[string][]string `json:"missing_in_redis,omitempty"`
+	Extra      map[string][]string `json:"extra_in_redis,omitempty"`
+	Mismatched map[string][]string `json:"mismatched,omitempty"`
+}
+
+func (r ConsistencyReport) String() string {
+	count := func(byCity map[string][]string) int {
+		total := 0
+		for _, ids := range byCity {
+			total += len(ids)
+		}
+		return total
+	}
+	return fmt.Sprintf("%d drivers checked: %d missing in redis, %d extra in redis, %d mismatched",
+		r.Checked, count(r.Missing), count(r.Extra), count(r.Mismatched))
+}
+
+// CheckRedisConsistency compares every city's in-memory drivers with the
+// Redis geo set. Positions further apart than toleranceKm are reported as
+// mismatched; Redis stores geohashes, so a tolerance of a few metres is
+// needed to absorb its rounding.
+func (dm *DriverManager) CheckRedisConsistency(toleranceKm float64) (ConsistencyReport, error) {
+	if !dm.useRedis || dm.redisCache == nil {
+		return ConsistencyReport{}, fmt.Errorf("redis is not enabled")
+	}
+
+	expected := make(map[string]map[string]models.Location)
+	for _, shard := range dm.shards {
+		shard.mu.RLock()
+		for driverID, city := range shard.cities {
+			if expected[city] == nil {
+				expected[city] = make(map[string]models.Location)
+			}
+			expected[city][driverID] = shard.drivers[driverID].Location
+		}
+		shard.mu.RUnlock()
+	}
+
+	report := ConsistencyReport{
+		Missing:    make(map[string][]string),
+		Extra:      make(map[string][]string),
+		Mismatched: make(map[string][]string),
+	}
+	for _, city := range dm.geoRouter.ListCities() {
+		stored, err := dm.redisCache.CityLocations(city)
+		if err != nil {
+			return ConsistencyReport{}, fmt.Errorf("failed to read redis geo set for %s: %w", city, err)
+		}
+
+		for driverID, location := range expected[city] {
+			report.Checked++
+			cached, exists := stored[driverID]
+			switch {
+			case !exists:
+				report.Missing[city] = append(report.Missing[city], driverID)
+			case geospatial.Haversine(location.Lat, location.Lng, cached.Lat, cached.Lng) > toleranceKm:
+				report.Mismatched[city] = append(report.Mismatched[city], driverID)
+			}
+		}
+		for driverID := range stored {
+			if _, exists := expected[city][driverID]; !exists {
+				report.Extra[city] = append(report.Extra[city], driverID)
+			}
+		}
+	}
+
+	for _, ids := range []map[string][]string{report.Missing, report.Extra, report.Mismatched} {
+		for _, list := range ids {
+			sort.Strings(list)
+		}
+	}
+	report.Consistent = len(report.Missing) == 0 && len(report.Extra) == 0 && len(report.Mismatched) == 0
+	return report, nil
+}
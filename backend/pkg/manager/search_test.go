@@ -0,0 +1,93 @@
+package manager
+
+import (
+	"fmt"
+	"testing"
+	"uber-system/pkg/models"
+)
+
+// newBorderManager registers two cities that share the meridian 70.2 and
+// puts drivers on both sides of it.
+func newBorderManager(t *testing.T) *DriverManager {
+	t.Helper()
+	dm := newTestManager(t)
+	dm.GeoRouter().RegisterCity("west", 10.0, 10.2, 70.0, 70.2)
+	dm.GeoRouter().RegisterCity("east", 10.0, 10.2, 70.2, 70.4)
+
+	addTestDriver(t, dm, "west-near", 10.1, 70.195)
+	addTestDriver(t, dm, "west-far", 10.1, 70.15)
+	addTestDriver(t, dm, "east-near", 10.1, 70.2015)
+	addTestDriver(t, dm, "east-far", 10.1, 70.35)
+	for id, want := range map[string]string{"west-near": "west", "east-near": "east"} {
+		if city := dm.shardFor(id).cities[id]; city != want {
+			t.Fatalf("%s is in %q, want %q", id, city, want)
+		}
+	}
+	return dm
+}
+
+func resultIDs(results []models.DriverWithDistance) string {
+	ids := make([]string, len(results))
+	for i, result := range results {
+		ids[i] = result.Driver.ID
+	}
+	return fmt.Sprint(ids)
+}
+
+func TestSearchAcrossCityBoundary(t *testing.T) {
+	dm := newBorderManager(t)
+
+	tests := []struct {
+		name     string
+		lng      float64
+		radiusKm float64
+		want     string
+	}{
+		{"from the west side", 70.199, 1, "[east-near west-near]"},
+		{"from the east side", 70.2005, 1, "[east-near west-near]"},
+		{"radius short of the border", 70.19, 0.6, "[west-near]"},
+		{"radius over both cities", 70.2, 20, "[east-near west-near west-far east-far]"},
+	}
+	for _, indexType := range dm.IndexTypes() {
+		for _, tt := range tests {
+			t.Run(string(indexType)+"/"+tt.name, func(t *testing.T) {
+				results, _, err := dm.SearchWithIndex(10.1, tt.lng, tt.radiusKm, indexType, models.SearchFilter{})
+				if err != nil {
+					t.Fatalf("SearchWithIndex: %v", err)
+				}
+				if got := resultIDs(results); got != tt.want {
+					t.Fatalf("SearchWithIndex = %s, want %s", got, tt.want)
+				}
+			})
+		}
+	}
+}
+
+func TestFindNearestAcrossCityBoundary(t *testing.T) {
+	dm := newBorderManager(t)
+
+	tests := []struct {
+		name          string
+		k             int
+		maxDistanceKm float64
+		want          string
+	}{
+		{"nearest is across the border", 1, 0, "[east-near]"},
+		{"fills k from both cities", 3, 0, "[east-near west-near west-far]"},
+		{"every driver", 10, 0, "[east-near west-near west-far east-far]"},
+		{"bounded distance", 10, 1, "[east-near west-near]"},
+	}
+	for _, indexType := range dm.IndexTypes() {
+		for _, tt := range tests {
+			t.Run(string(indexType)+"/"+tt.name, func(t *testing.T) {
+				results, _, err := dm.FindNearest(10.1, 70.199, tt.k, tt.maxDistanceKm, indexType, models.SearchFilter{})
+				if err != nil {
+					t.Fatalf("FindNearest: %v", err)
+				}
+				if got := resultIDs(results); got != tt.want {
+					t.Fatalf("FindNearest = %s, want %s", got, tt.want)
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package manager
+
+import (
+	"hash/fnv"
+	"sync"
+	"time"
+	"uber-system/pkg/models"
+)
+
+const driverShardCount = 64
+
+// driverShard owns a slice of the driver ID space. Everything the manager
+// tracks per driver lives in the driver's shard and is guarded by its lock,
+// so updates for different drivers rarely contend. Driver records are
+// copy-on-write: a published *models.Driver is never modified, a change
+// stores a new record with the next Version and re-indexes its position, so
+// a reader holding the old pointer sees a consistent, if older, driver.
+//
+// Current records are also published to a sync.Map so searches can resolve
+// index positions without the shard lock: writers hold the shard lock while
+// they take index locks, so a reader inside an index must not wait on it.
+type driverShard struct {
+	drivers   map[string]*models.Driver
+	published sync.Map
+	cities    map[string]string
+	history   map[string][]models.StatusTransition
+	clocks    map[string]updateClock
+	mu        sync.RWMutex
+}
+
+func newDriverShard() *driverShard {
+	return &driverShard{
+		drivers: make(map[string]*models.Driver),
+		cities:  make(map[string]string),
+		history: make(map[string][]models.StatusTransition),
+		clocks:  make(map[string]updateClock),
+	}
+}
+
+// put publishes driver as the current record for its ID.
+func (shard *driverShard) put(driver *models.Driver) {
+	shard.drivers[driver.ID] = driver
+	shard.published.Store(driver.ID, driver)
+}
+
+func (shard *driverShard) delete(driverID string) {
+	delete(shard.drivers, driverID)
+	delete(shard.cities, driverID)
+	delete(shard.history, driverID)
+	delete(shard.clocks, driverID)
+	shard.published.Delete(driverID)
+}
+
+func (shard *driverShard) reset() {
+	for driverID := range shard.drivers {
+		shard.published.Delete(driverID)
+	}
+	shard.drivers = make(map[string]*models.Driver)
+	shard.cities = make(map[string]string)
+	shard.history = make(map[string][]models.StatusTransition)
+	shard.clocks = make(map[string]updateClock)
+}
+
+func (dm *DriverManager) shardFor(driverID string) *driverShard {
+	hash := fnv.New32a()
+	hash.Write([]byte(driverID))
+	return dm.shards[hash.Sum32()%driverShardCount]
+}
+
+// lookup returns the last published record for a driver without taking the
+// shard lock. The record is immutable, so it is safe to read at any time.
+func (dm *DriverManager) lookup(driverID string) (*models.Driver, bool) {
+	value, exists := dm.shardFor(driverID).published.Load(driverID)
+	if !exists {
+		return nil, false
+	}
+	return value.(*models.Driver), true
+}
+
+// lockAll takes every shard's write lock in a fixed order, for operations
+// that replace the whole driver set.
+func (dm *DriverManager) lockAll() {
+	for _, shard := range dm.shards {
+		shard.mu.Lock()
+	}
+}
+
+func (dm *DriverManager) unlockAll() {
+	for _, shard := range dm.shards {
+		shard.mu.Unlock()
+	}
+}
+
+// rlockAll takes every shard's read lock, giving a single point-in-time view
+// across shards.
+func (dm *DriverManager) rlockAll() {
+	for _, shard := range dm.shards {
+		shard.mu.RLock()
+	}
+}
+
+func (dm *DriverManager) runlockAll() {
+	for _, shard := range dm.shards {
+		shard.mu.RUnlock()
+	}
+}
+
+type shardGroup struct {
+	shard *driverShard
+	items []int
+}
+
+// groupByShard splits batch positions by the shard that owns each driver,
+// keeping batch order within a shard so updates for one driver still apply
+// in order. Shards are locked one group at a time.
+func (dm *DriverManager) groupByShard(items []int, driverID func(int) string) []shardGroup {
+	groups := make([]shardGroup, 0)
+	positions := make(map[*driverShard]int)
+	for _, i := range items {
+		shard := dm.shardFor(driverID(i))
+		position, exists := positions[shard]
+		if !exists {
+			position = len(groups)
+			positions[shard] = position
+			groups = append(groups, shardGroup{shard: shard})
+		}
+		groups[position].items = append(groups[position].items, i)
+	}
+	return groups
+}
+
+func (shard *driverShard) recordTransition(driverID string, from, to models.DriverStatus, reason string, at time.Time) {
+	history := append(shard.history[driverID], models.StatusTransition{
+		From:   from,
+		To:     to,
+		Reason: reason,
+		At:     at,
+	})
+	if len(history) > maxStatusHistory {
+		history = history[len(history)-maxStatusHistory:]
+	}
+	shard.history[driverID] = history
+}
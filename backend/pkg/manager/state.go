@@ -0,0 +1,164 @@
+package manager
+
+import (
+	"fmt"
+	"sort"
+	"time"
+	"uber-system/pkg/geospatial"
+	"uber-system/pkg/models"
+)
+
+// State is a point-in-time copy of everything the manager holds in memory.
+// Spatial indexes are not serialised; a restore rebuilds them from the
+// drivers with the index configuration of the manager being restored.
+type State struct {
+	TakenAt       time.Time
+	Drivers       []models.Driver
+	DriverCities  map[string]string
+	StatusHistory map[string][]models.StatusTransition
+	Clocks        map[string]DeviceClock
+	Counters      map[string]int
+}
+
+type DeviceClock struct {
+	Time time.Time
+	Seq  uint64
+}
+
+func (dm *DriverManager) Snapshot() State {
+	dm.rlockAll()
+	defer dm.runlockAll()
+
+	state := State{
+		TakenAt:       time.Now(),
+		DriverCities:  make(map[string]string),
+		StatusHistory: make(map[string][]models.StatusTransition),
+		Clocks:        make(map[string]DeviceClock),
+		Counters: map[string]int{
+			"stale_drivers":         int(dm.staleCount.Load()),
+			"evicted_drivers":       int(dm.evictCount.Load()),
+			"dropped_stale_updates": int(dm.staleUpdates.Load()),
+			"duplicate_updates":     int(dm.duplicateUpdates.Load()),
+		},
+	}
+
+	for _, shard := range dm.shards {
+		for driverID, driver := range shard.drivers {
+			state.Drivers = append(state.Drivers, *driver)
+			state.DriverCities[driverID] = shard.cities[driverID]
+		}
+		for driverID, transitions := range shard.history {
+			state.StatusHistory[driverID] = append([]models.StatusTransition(nil), transitions...)
+		}
+		for driverID, clock := range shard.clocks {
+			state.Clocks[driverID] = DeviceClock{Time: clock.deviceTime, Seq: clock.seq}
+		}
+	}
+	sort.Slice(state.Drivers, func(i, j int) bool { return state.Drivers[i].ID < state.Drivers[j].ID })
+
+	return state
+}
+
+type RestoreReport struct {
+	Drivers  int      `json:"drivers"`
+	Rerouted int      `json:"rerouted"`
+	Dropped  []string `json:"dropped,omitempty"`
+}
+
+// Restore replaces all in-memory state with state and rebuilds every city's
+// indexes with the current index configuration. A driver whose saved city is
+// no longer registered is routed again from its location, and dropped if no
+// city covers it. Redis is left untouched; CheckRedisConsistency reports any
+// drift between the two.
+//
+// Each city's indexes are bulk-built before any lock is taken. The live state
+// is only replaced once every index has been built, so a failed restore leaves
+// the manager as it was.
+func (dm *DriverManager) Restore(state State) (RestoreReport, error) {
+	type restored struct {
+		driver *models.Driver
+		city   string
+	}
+
+	var report RestoreReport
+	drivers := make([]restored, 0, len(state.Drivers))
+	cities := make(map[string]*cityIndexes)
+	positions := make(map[string][]geospatial.Position)
+	for i := range state.Drivers {
+		driver := state.Drivers[i]
+		if driver.LocationUpdatedAt.IsZero() {
+			// Snapshots taken before the field existed only have UpdatedAt.
+			driver.LocationUpdatedAt = driver.UpdatedAt
+		}
+		city, routed := state.DriverCities[driver.ID]
+		if _, registered := dm.geoRouter.GetCityInfo(city); !routed || !registered {
+			var err error
+			if city, err = dm.geoRouter.GetCity(driver.Location.Lat, driver.Location.Lng); err != nil {
+				report.Dropped = append(report.Dropped, driver.ID)
+				continue
+			}
+			report.Rerouted++
+		}
+
+		if _, exists := cities[city]; !exists {
+			ci, err := dm.emptyCityIndexes(city)
+			if err != nil {
+				return RestoreReport{}, err
+			}
+			cities[city] = ci
+		}
+		positions[city] = append(positions[city], positionOf(&driver))
+		drivers = append(drivers, restored{driver: &driver, city: city})
+		report.Drivers++
+	}
+
+	for city, ci := range cities {
+		for _, indexType := range dm.indexOrder {
+			index, err := ci.build(indexType, positions[city])
+			if err != nil {
+				return RestoreReport{}, fmt.Errorf("failed to restore drivers: %w", err)
+			}
+			ci.indexes[indexType].store(index)
+		}
+	}
+
+	dm.lockAll()
+	defer dm.unlockAll()
+
+	anomalies := dm.Anomalies()
+	for _, shard := range dm.shards {
+		for driverID := range shard.drivers {
+			anomalies.Forget(driverID)
+		}
+		shard.reset()
+	}
+	dm.citiesMu.Lock()
+	dm.cities = cities
+	dm.citiesMu.Unlock()
+
+	for _, entry := range drivers {
+		shard := dm.shardFor(entry.driver.ID)
+		shard.put(entry.driver)
+		shard.cities[entry.driver.ID] = entry.city
+		anomalies.Forget(entry.driver.ID)
+	}
+
+	for driverID, transitions := range state.StatusHistory {
+		shard := dm.shardFor(driverID)
+		if _, exists := shard.drivers[driverID]; exists {
+			shard.history[driverID] = append([]models.StatusTransition(nil), transitions...)
+		}
+	}
+	for driverID, clock := range state.Clocks {
+		shard := dm.shardFor(driverID)
+		if _, exists := shard.drivers[driverID]; exists {
+			shard.clocks[driverID] = updateClock{deviceTime: clock.Time, seq: clock.Seq}
+		}
+	}
+	dm.staleCount.Store(int64(state.Counters["stale_drivers"]))
+	dm.evictCount.Store(int64(state.Counters["evicted_drivers"]))
+	dm.staleUpdates.Store(int64(state.Counters["dropped_stale_updates"]))
+	dm.duplicateUpdates.Store(int64(state.Counters["duplicate_updates"]))
+
+	return report, nil
+}
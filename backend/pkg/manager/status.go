@@ -0,0 +1,87 @@
+package manager
+
+import (
+	"fmt"
+	"time"
+	"uber-system/pkg/models"
+)
+
+const maxStatusHistory = 100
+
+func (dm *DriverManager) UpdateStatus(driverID string, status models.DriverStatus) error {
+	shard := dm.shardFor(driverID)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+
+	driver, exists := shard.drivers[driverID]
+	if !exists {
+		return fmt.Errorf("%w: %s", ErrDriverNotFound, driverID)
+	}
+	updated, err := dm.transitionLocked(shard, driver, status, "status_update", time.Now())
+	if err != nil || updated == driver {
+		return err
+	}
+	return dm.publishLocked(shard, updated)
+}
+
+func (dm *DriverManager) UpdateStatusIf(driverID string, expected, status models.DriverStatus, reason string) error {
+	shard := dm.shardFor(driverID)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+
+	driver, exists := shard.drivers[driverID]
+	if !exists {
+		return fmt.Errorf("%w: %s", ErrDriverNotFound, driverID)
+	}
+	if driver.Status != expected {
+		return fmt.Errorf("%w: %s is %s, expected %s", ErrStatusConflict, driverID, driver.Status, expected)
+	}
+	updated, err := dm.transitionLocked(shard, driver, status, reason, time.Now())
+	if err != nil || updated == driver {
+		return err
+	}
+	return dm.publishLocked(shard, updated)
+}
+
+// transitionLocked checks and records a status change, returning the new
+// driver record for the caller to publish. An unchanged status returns
+// driver itself.
+func (dm *DriverManager) transitionLocked(shard *driverShard, driver *models.Driver, status models.DriverStatus, reason string, now time.Time) (*models.Driver, error) {
+	if !status.IsValid() {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidStatus, status)
+	}
+	if driver.Status == status {
+		return driver, nil
+	}
+	if !driver.Status.CanTransitionTo(status) {
+		return nil, fmt.Errorf("%w: %s -> %s", ErrInvalidTransition, driver.Status, status)
+	}
+
+	shard.recordTransition(driver.ID, driver.Status, status, reason, now)
+	updated := *driver
+	updated.Status = status
+	updated.UpdatedAt = now
+	updated.Version++
+	return &updated, nil
+}
+
+// publishLocked replaces a driver's record in place in its city's indexes,
+// so searches filtering on the record's fields see the new version.
+func (dm *DriverManager) publishLocked(shard *driverShard, driver *models.Driver) error {
+	shard.put(driver)
+	if ci, ok := dm.cityIndexes(shard.cities[driver.ID]); ok {
+		return ci.update(driver, dm.indexOrder)
+	}
+	return nil
+}
+
+func (dm *DriverManager) GetStatusHistory(driverID string) ([]models.StatusTransition, error) {
+	shard := dm.shardFor(driverID)
+	shard.mu.RLock()
+	defer shard.mu.RUnlock()
+
+	if _, exists := shard.drivers[driverID]; !exists {
+		return nil, fmt.Errorf("%w: %s", ErrDriverNotFound, driverID)
+	}
+	return append([]models.StatusTransition(nil), shard.history[driverID]...), nil
+}
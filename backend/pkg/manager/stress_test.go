@@ -0,0 +1,173 @@
+package manager
+
+import (
+	"fmt"
+	"math/rand"
+	"sync"
+	"testing"
+	"uber-system/pkg/anomaly"
+	"uber-system/pkg/models"
+)
+
+type stressCity struct {
+	name                           string
+	minLat, maxLat, minLng, maxLng float64
+}
+
+var stressCities = []stressCity{
+	{"bangalore", 12.90, 13.05, 77.55, 77.70},
+	{"chennai", 12.90, 13.10, 80.15, 80.25},
+}
+
+func (c stressCity) random(rng *rand.Rand) (float64, float64) {
+	return c.minLat + rng.Float64()*(c.maxLat-c.minLat), c.minLng + rng.Float64()*(c.maxLng-c.minLng)
+}
+
+func newStressManager(t *testing.T, drivers int) *DriverManager {
+	t.Helper()
+	dm, err := NewDriverManager("", false)
+	if err != nil {
+		t.Fatalf("NewDriverManager: %v", err)
+	}
+	t.Cleanup(func() { dm.Close() })
+	// Updates jump between cities faster than any car could, which the
+	// default detector would reject.
+	dm.SetAnomalyDetector(anomaly.NewDetector(anomaly.Config{}))
+
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < drivers; i++ {
+		lat, lng := stressCities[i%len(stressCities)].random(rng)
+		driver := &models.Driver{
+			ID:       fmt.Sprintf("driver-%d", i),
+			Location: models.Location{Lat: lat, Lng: lng},
+			Status:   models.StatusAvailable,
+			CarType:  "sedan",
+		}
+		if err := dm.AddDriver(driver); err != nil {
+			t.Fatalf("AddDriver: %v", err)
+		}
+	}
+	return dm
+}
+
+// checkIndexesMatchDrivers fails t unless every index of every city holds
+// exactly the drivers routed to that city.
+func checkIndexesMatchDrivers(t *testing.T, dm *DriverManager) {
+	t.Helper()
+	counts := make(map[string]int)
+	for _, shard := range dm.shards {
+		shard.mu.RLock()
+		for _, city := range shard.cities {
+			counts[city]++
+		}
+		shard.mu.RUnlock()
+	}
+
+	dm.citiesMu.RLock()
+	defer dm.citiesMu.RUnlock()
+	for city, ci := range dm.cities {
+		for _, indexType := range dm.indexOrder {
+			if n := ci.index(indexType).Len(); n != counts[city] {
+				t.Errorf("%s %s index holds %d drivers, want %d", city, indexType, n, counts[city])
+			}
+		}
+	}
+	for city := range counts {
+		if _, exists := dm.cities[city]; !exists {
+			t.Errorf("%d drivers routed to %s, which has no indexes", counts[city], city)
+		}
+	}
+}
+
+func TestConcurrentUpdatesAndSearches(t *testing.T) {
+	const (
+		drivers    = 200
+		workers    = 4
+		iterations = 300
+	)
+	dm := newStressManager(t, drivers)
+
+	var wg sync.WaitGroup
+	run := func(seed int64, work func(rng *rand.Rand)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			rng := rand.New(rand.NewSource(seed))
+			for i := 0; i < iterations; i++ {
+				work(rng)
+			}
+		}()
+	}
+	driverID := func(rng *rand.Rand) string {
+		return fmt.Sprintf("driver-%d", rng.Intn(drivers))
+	}
+	city := func(rng *rand.Rand) stressCity {
+		return stressCities[rng.Intn(len(stressCities))]
+	}
+
+	var seqMu sync.Mutex
+	seqs := make(map[string]uint64)
+	nextSeq := func(id string) uint64 {
+		seqMu.Lock()
+		defer seqMu.Unlock()
+		seqs[id]++
+		return seqs[id]
+	}
+	for w := 0; w < workers; w++ {
+		seed := int64(w) * 100
+		run(seed+1, func(rng *rand.Rand) {
+			lat, lng := city(rng).random(rng)
+			dm.UpdateLocation(driverID(rng), lat, lng)
+		})
+		run(seed+2, func(rng *rand.Rand) {
+			reqs := make([]models.UpdateLocationRequest, 8)
+			for i := range reqs {
+				id := driverID(rng)
+				lat, lng := city(rng).random(rng)
+				reqs[i] = models.UpdateLocationRequest{DriverID: id, Lat: lat, Lng: lng, Seq: nextSeq(id)}
+			}
+			dm.ApplyLocationUpdates(reqs)
+		})
+		run(seed+3, func(rng *rand.Rand) {
+			status := models.StatusAvailable
+			if rng.Intn(2) == 0 {
+				status = models.StatusOffline
+			}
+			dm.UpdateStatus(driverID(rng), status)
+		})
+		run(seed+4, func(rng *rand.Rand) {
+			lat, lng := city(rng).random(rng)
+			indexType := dm.indexOrder[rng.Intn(len(dm.indexOrder))]
+			results, _, err := dm.SearchWithIndex(lat, lng, 5, indexType, models.SearchFilter{})
+			if err != nil {
+				t.Errorf("SearchWithIndex: %v", err)
+				return
+			}
+			checkDistinct(t, "SearchWithIndex "+string(indexType), results)
+		})
+		run(seed+5, func(rng *rand.Rand) {
+			lat, lng := city(rng).random(rng)
+			indexType := dm.indexOrder[rng.Intn(len(dm.indexOrder))]
+			results, _, err := dm.FindNearest(lat, lng, 10, 0, indexType, models.SearchFilter{})
+			if err != nil {
+				t.Errorf("FindNearest: %v", err)
+				return
+			}
+			checkDistinct(t, "FindNearest "+string(indexType), results)
+		})
+	}
+	wg.Wait()
+
+	checkIndexesMatchDrivers(t, dm)
+}
+
+func checkDistinct(t *testing.T, op string, results []models.DriverWithDistance) {
+	t.Helper()
+	seen := make(map[string]bool, len(results))
+	for _, result := range results {
+		if seen[result.Driver.ID] {
+			t.Errorf("%s returned %s twice", op, result.Driver.ID)
+		}
+		seen[result.Driver.ID] = true
+	}
+}
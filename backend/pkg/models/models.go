@@ -8,18 +8,39 @@ type Location struct {
 }
 
 type Driver struct {
-	ID        string    `json:"id"`
-	Location  Location  `json:"location"`
-	Status    string    `json:"status"`
-	Rating    float64   `json:"rating"`
-	CarType   string    `json:"car_type"`
-	UpdatedAt time.Time `json:"updated_at"`
+	ID        string       `json:"id"`
+	Location  Location     `json:"location"`
+	Status    DriverStatus `json:"status"`
+	Rating    float64      `json:"rating"`
+	CarType   string       `json:"car_type"`
+	UpdatedAt time.Time    `json:"updated_at"`
+	Version   uint64       `json:"version"`
+
+	// LocationUpdatedAt is when Location was last set. UpdatedAt also moves
+	// on status changes, so it says nothing about how fresh the position is.
+	LocationUpdatedAt time.Time `json:"location_updated_at"`
+}
+
+type SearchFilter struct {
+	CarTypes       []string       `json:"car_type,omitempty"`
+	MinRating      float64        `json:"min_rating,omitempty"`
+	Statuses       []DriverStatus `json:"statuses,omitempty"`
+	MaxLocationAge float64        `json:"max_location_age,omitempty"`
 }
 
 type SearchRequest struct {
 	Location  Location `json:"location"`
 	Radius    float64  `json:"radius"`
 	IndexType string   `json:"index_type,omitempty"`
+	SearchFilter
+}
+
+type NearestRequest struct {
+	Location    Location `json:"location"`
+	K           int      `json:"k"`
+	MaxDistance float64  `json:"max_distance,omitempty"`
+	IndexType   string   `json:"index_type,omitempty"`
+	SearchFilter
 }
 
 type SearchResponse struct {
@@ -34,20 +55,46 @@ type DriverWithDistance struct {
 	Distance float64 `json:"distance"`
 }
 
+// UpdateLocationRequest carries an optional device clock. Timestamp is the
+// time the fix was taken on the device and Seq a per-device counter; either
+// lets the server discard retries that arrive after a newer position.
 type UpdateLocationRequest struct {
-	DriverID string  `json:"driver_id"`
-	Lat      float64 `json:"lat"`
-	Lng      float64 `json:"lng"`
+	DriverID  string    `json:"driver_id"`
+	Lat       float64   `json:"lat"`
+	Lng       float64   `json:"lng"`
+	Timestamp time.Time `json:"timestamp,omitempty"`
+	Seq       uint64    `json:"seq,omitempty"`
 }
 
+type UpdateOutcome string
+
+const (
+	UpdateApplied   UpdateOutcome = "applied"
+	UpdateDuplicate UpdateOutcome = "duplicate"
+	UpdateStale     UpdateOutcome = "stale"
+)
+
 type UpdateStatusRequest struct {
-	DriverID string `json:"driver_id"`
-	Status   string `json:"status"`
+	DriverID string       `json:"driver_id"`
+	Status   DriverStatus `json:"status"`
 }
 
-type ComparisonResult struct {
-	QuadTree map[string]interface{} `json:"quadtree"`
-	Grid     map[string]interface{} `json:"grid"`
-	Redis    map[string]interface{} `json:"redis,omitempty"`
-}
+type ComparisonResult map[string]map[string]interface{}
+
+type DriverEventType string
 
+const (
+	EventDriverAdded     DriverEventType = "driver_added"
+	EventLocationUpdated DriverEventType = "location_updated"
+	EventDriverRemoved   DriverEventType = "driver_removed"
+	EventDriverStale     DriverEventType = "driver_stale"
+	EventDriverEvicted   DriverEventType = "driver_evicted"
+)
+
+type DriverEvent struct {
+	Type      DriverEventType `json:"type"`
+	DriverID  string          `json:"driver_id"`
+	City      string          `json:"city,omitempty"`
+	Driver    Driver          `json:"driver"`
+	Timestamp time.Time       `json:"timestamp"`
+}
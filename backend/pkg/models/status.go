@@ -0,0 +1,55 @@
+package models
+
+import (
+	"fmt"
+	"time"
+)
+
+type DriverStatus string
+
+const (
+	StatusOffline   DriverStatus = "offline"
+	StatusAvailable DriverStatus = "available"
+	StatusReserved  DriverStatus = "reserved"
+	StatusOnTrip    DriverStatus = "on_trip"
+)
+
+var driverStatusTransitions = map[DriverStatus][]DriverStatus{
+	StatusOffline:   {StatusAvailable},
+	StatusAvailable: {StatusOffline, StatusReserved},
+	StatusReserved:  {StatusOnTrip, StatusAvailable, StatusOffline},
+	StatusOnTrip:    {StatusAvailable, StatusOffline},
+}
+
+func DriverStatuses() []DriverStatus {
+	return []DriverStatus{StatusOffline, StatusAvailable, StatusReserved, StatusOnTrip}
+}
+
+func ParseDriverStatus(value string) (DriverStatus, error) {
+	status := DriverStatus(value)
+	if !status.IsValid() {
+		return "", fmt.Errorf("unknown driver status: %q", value)
+	}
+	return status, nil
+}
+
+func (s DriverStatus) IsValid() bool {
+	_, exists := driverStatusTransitions[s]
+	return exists
+}
+
+func (s DriverStatus) CanTransitionTo(next DriverStatus) bool {
+	for _, allowed := range driverStatusTransitions[s] {
+		if allowed == next {
+			return true
+		}
+	}
+	return false
+}
+
+type StatusTransition struct {
+	From   DriverStatus `json:"from,omitempty"`
+	To     DriverStatus `json:"to"`
+	Reason string       `json:"reason"`
+	At     time.Time    `json:"at"`
+}
@@ -0,0 +1,41 @@
+package models
+
+import "testing"
+
+func TestDriverStatusTransitions(t *testing.T) {
+	allowed := map[[2]DriverStatus]bool{
+		{StatusOffline, StatusAvailable}:  true,
+		{StatusAvailable, StatusOffline}:  true,
+		{StatusAvailable, StatusReserved}: true,
+		{StatusReserved, StatusOnTrip}:    true,
+		{StatusReserved, StatusAvailable}: true,
+		{StatusReserved, StatusOffline}:   true,
+		{StatusOnTrip, StatusAvailable}:   true,
+		{StatusOnTrip, StatusOffline}:     true,
+	}
+
+	// Every pair of statuses, including staying put, is either in the table
+	// above or forbidden.
+	statuses := append(DriverStatuses(), "Available", "")
+	for _, from := range statuses {
+		for _, to := range statuses {
+			want := allowed[[2]DriverStatus{from, to}]
+			if got := from.CanTransitionTo(to); got != want {
+				t.Errorf("%q -> %q allowed = %v, want %v", from, to, got, want)
+			}
+		}
+	}
+}
+
+func TestParseDriverStatus(t *testing.T) {
+	for _, status := range DriverStatuses() {
+		if got, err := ParseDriverStatus(string(status)); err != nil || got != status {
+			t.Errorf("ParseDriverStatus(%q) = %q, %v", status, got, err)
+		}
+	}
+	for _, value := range []string{"", "Available", "busy", " offline"} {
+		if _, err := ParseDriverStatus(value); err == nil {
+			t.Errorf("ParseDriverStatus(%q) succeeded", value)
+		}
+	}
+}
@@ -0,0 +1,292 @@
+package replay
+
+import (
+	"container/heap"
+	"encoding/json"
+	"fmt"
+	"time"
+	"uber-system/pkg/history"
+	"uber-system/pkg/manager"
+	"uber-system/pkg/models"
+	"uber-system/pkg/stream"
+)
+
+type Source string
+
+const (
+	SourceLog     Source = "log"
+	SourceHistory Source = "history"
+)
+
+const (
+	DefaultBatchSize     = 1000
+	DefaultProgressEvery = 10000
+)
+
+func ParseSource(value string) (Source, error) {
+	switch source := Source(value); source {
+	case SourceLog, SourceHistory:
+		return source, nil
+	default:
+		return "", fmt.Errorf("unknown replay source %q", value)
+	}
+}
+
+// Run opens the source stored under dir and replays it into mgr. The
+// ingestion log is opened read-only, so it can be replayed while a server is
+// still appending to it.
+func Run(mgr *manager.DriverManager, source Source, dir string, options Options) (Progress, error) {
+	switch source {
+	case SourceLog:
+		log, err := stream.Open(dir, stream.Options{ReadOnly: true})
+		if err != nil {
+			return Progress{}, err
+		}
+		defer log.Close()
+		return FromLog(mgr, log, options)
+	case SourceHistory:
+		store, err := history.Open(history.Config{Dir: dir})
+		if err != nil {
+			return Progress{}, err
+		}
+		defer store.Close()
+		return FromHistory(mgr, store, options)
+	default:
+		return Progress{}, fmt.Errorf("unknown replay source %q", source)
+	}
+}
+
+type Options struct {
+	// FromOffset is the first offset replayed in every log partition.
+	FromOffset int64
+	// From and To bound the recorded time of replayed positions; zero
+	// values leave that side open.
+	From          time.Time
+	To            time.Time
+	BatchSize     int
+	ProgressEvery int
+	Progress      func(Progress)
+}
+
+type Progress struct {
+	Source     Source        `json:"source"`
+	Processed  int           `json:"processed"`
+	Applied    int           `json:"applied"`
+	Registered int           `json:"registered"`
+	Stale      int           `json:"stale"`
+	Skipped    int           `json:"skipped"`
+	Failed     int           `json:"failed"`
+	Elapsed    time.Duration `json:"elapsed"`
+	Done       bool          `json:"done"`
+}
+
+func (p Progress) String() string {
+	rate := 0.0
+	if p.Elapsed > 0 {
+		rate = float64(p.Processed) / p.Elapsed.Seconds()
+	}
+	return fmt.Sprintf("%s replay: %d processed (%d applied, %d registered, %d stale, %d skipped, %d failed) in %v, %.0f/s",
+		p.Source, p.Processed, p.Applied, p.Registered, p.Stale, p.Skipped, p.Failed, p.Elapsed.Round(time.Millisecond), rate)
+}
+
+type replayer struct {
+	mgr      *manager.DriverManager
+	options  Options
+	progress Progress
+	started  time.Time
+	pending  []manager.ReplayedLocation
+	reported int
+}
+
+func newReplayer(mgr *manager.DriverManager, source Source, options Options) *replayer {
+	if options.BatchSize <= 0 {
+		options.BatchSize = DefaultBatchSize
+	}
+	if options.ProgressEvery <= 0 {
+		options.ProgressEvery = DefaultProgressEvery
+	}
+	return &replayer{
+		mgr:      mgr,
+		options:  options,
+		progress: Progress{Source: source},
+		started:  time.Now(),
+	}
+}
+
+func (r *replayer) inRange(at time.Time) bool {
+	return !at.Before(r.options.From) && (r.options.To.IsZero() || !at.After(r.options.To))
+}
+
+func (r *replayer) add(location manager.ReplayedLocation) {
+	r.pending = append(r.pending, location)
+	if len(r.pending) >= r.options.BatchSize {
+		r.flush()
+		r.report()
+	}
+}
+
+func (r *replayer) skip() {
+	r.progress.Processed++
+	r.progress.Skipped++
+	r.report()
+}
+
+func (r *replayer) flush() {
+	if len(r.pending) == 0 {
+		return
+	}
+	for _, result := range r.mgr.ReplayLocations(r.pending) {
+		r.progress.Processed++
+		switch {
+		case result.Err != nil:
+			r.progress.Failed++
+		case result.Outcome == models.UpdateStale:
+			r.progress.Stale++
+		default:
+			r.progress.Applied++
+		}
+		if result.Registered {
+			r.progress.Registered++
+		}
+	}
+	r.pending = r.pending[:0]
+}
+
+func (r *replayer) report() {
+	if r.options.Progress == nil || r.progress.Processed-r.reported < r.options.ProgressEvery {
+		return
+	}
+	r.reported = r.progress.Processed
+	r.progress.Elapsed = time.Since(r.started)
+	r.options.Progress(r.progress)
+}
+
+func (r *replayer) finish() Progress {
+	r.flush()
+	r.progress.Elapsed = time.Since(r.started)
+	r.progress.Done = true
+	if r.options.Progress != nil {
+		r.options.Progress(r.progress)
+	}
+	return r.progress
+}
+
+// FromHistory replays recorded positions from the location history store in
+// time order.
+func FromHistory(mgr *manager.DriverManager, store *history.Store, options Options) (Progress, error) {
+	r := newReplayer(mgr, SourceHistory, options)
+	err := store.Scan(options.From, options.To, func(record history.Record) error {
+		r.add(manager.ReplayedLocation{
+			DriverID: record.DriverID,
+			Lat:      record.Lat,
+			Lng:      record.Lng,
+			At:       record.Timestamp,
+		})
+		return nil
+	})
+	return r.finish(), err
+}
+
+// FromLog replays the ingestion log. Partitions are merged by append time so
+// a driver that crossed cities is replayed in the order it was ingested.
+// Updates without a device timestamp take their append time.
+func FromLog(mgr *manager.DriverManager, log *stream.Log, options Options) (Progress, error) {
+	r := newReplayer(mgr, SourceLog, options)
+
+	cursors := &cursorHeap{}
+	for _, partition := range log.Partitions() {
+		offset := options.FromOffset
+		if end := log.EndOffset(partition); offset > end {
+			offset = end
+		}
+		cursor := &cursor{log: log, partition: partition, offset: offset, batch: r.options.BatchSize}
+		if err := cursor.fill(); err != nil {
+			return r.finish(), err
+		}
+		if cursor.current() != nil {
+			heap.Push(cursors, cursor)
+		}
+	}
+
+	for cursors.Len() > 0 {
+		cursor := (*cursors)[0]
+		message := cursor.current()
+
+		var req models.UpdateLocationRequest
+		at := message.Timestamp
+		err := json.Unmarshal(message.Value, &req)
+		if err == nil && !req.Timestamp.IsZero() {
+			at = req.Timestamp
+		}
+		if err != nil || !r.inRange(at) {
+			r.skip()
+		} else {
+			r.add(manager.ReplayedLocation{
+				DriverID: req.DriverID,
+				Lat:      req.Lat,
+				Lng:      req.Lng,
+				At:       at,
+				Seq:      req.Seq,
+			})
+		}
+
+		if err := cursor.advance(); err != nil {
+			return r.finish(), err
+		}
+		if cursor.current() == nil {
+			heap.Pop(cursors)
+		} else {
+			heap.Fix(cursors, 0)
+		}
+	}
+	return r.finish(), nil
+}
+
+type cursor struct {
+	log       *stream.Log
+	partition string
+	offset    int64
+	batch     int
+	messages  []stream.Message
+	index     int
+}
+
+func (c *cursor) fill() error {
+	messages, err := c.log.Read(c.partition, c.offset, c.batch)
+	if err != nil {
+		return err
+	}
+	c.messages, c.index = messages, 0
+	c.offset += int64(len(messages))
+	return nil
+}
+
+func (c *cursor) current() *stream.Message {
+	if c.index >= len(c.messages) {
+		return nil
+	}
+	return &c.messages[c.index]
+}
+
+func (c *cursor) advance() error {
+	c.index++
+	if c.index < len(c.messages) {
+		return nil
+	}
+	return c.fill()
+}
+
+type cursorHeap []*cursor
+
+func (h cursorHeap) Len() int { return len(h) }
+func (h cursorHeap) Less(i, j int) bool {
+	return h[i].current().Timestamp.Before(h[j].current().Timestamp)
+}
+func (h cursorHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *cursorHeap) Push(x interface{}) { *h = append(*h, x.(*cursor)) }
+func (h *cursorHeap) Pop() interface{} {
+	old := *h
+	item := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return item
+}
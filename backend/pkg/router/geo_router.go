@@ -2,10 +2,36 @@ package router
 
 import (
 	"fmt"
+	"math"
+	"sort"
 	"sync"
 )
 
 type City struct {
+	Name      string
+	MinLat    float64
+	MaxLat    float64
+	MinLng    float64
+	MaxLng    float64
+	Priority  int
+	Exclusion bool
+	Polygons  []Polygon
+}
+
+func (c *City) Contains(lat, lng float64) bool {
+	if lat < c.MinLat || lat > c.MaxLat || lng < c.MinLng || lng > c.MaxLng {
+		return false
+	}
+	for _, polygon := range c.Polygons {
+		if polygon.Contains(lat, lng) {
+			return true
+		}
+	}
+	return false
+}
+
+// CityBounds is a city registered by its bounding box.
+type CityBounds struct {
 	Name   string
 	MinLat float64
 	MaxLat float64
@@ -13,9 +39,20 @@ type City struct {
 	MaxLng float64
 }
 
+// DefaultCities are the cities every manager starts with. GeoJSON boundaries
+// loaded with LoadGeoJSONDir replace them by name.
+var DefaultCities = []CityBounds{
+	{Name: "mumbai", MinLat: 18.8928, MaxLat: 19.2705, MinLng: 72.7758, MaxLng: 72.9866},
+	{Name: "delhi", MinLat: 28.3949, MaxLat: 28.8836, MinLng: 76.8389, MaxLng: 77.3456},
+	{Name: "bangalore", MinLat: 12.8342, MaxLat: 13.1476, MinLng: 77.4577, MaxLng: 77.7878},
+	{Name: "hyderabad", MinLat: 17.2403, MaxLat: 17.6868, MinLng: 78.1636, MaxLng: 78.6569},
+	{Name: "chennai", MinLat: 12.7948, MaxLat: 13.2402, MinLng: 80.0889, MaxLng: 80.3044},
+}
+
 type GeoRouter struct {
-	cities map[string]*City
-	mu     sync.RWMutex
+	cities  map[string]*City
+	ordered []*City
+	mu      sync.RWMutex
 }
 
 func NewGeoRouter() *GeoRouter {
@@ -25,39 +62,106 @@ func NewGeoRouter() *GeoRouter {
 }
 
 func (gr *GeoRouter) RegisterCity(name string, minLat, maxLat, minLng, maxLng float64) {
+	gr.register(&City{
+		Name:     name,
+		Polygons: []Polygon{RectanglePolygon(minLat, maxLat, minLng, maxLng)},
+	})
+}
+
+func (gr *GeoRouter) RegisterCities(cities []CityBounds) {
+	for _, city := range cities {
+		gr.RegisterCity(city.Name, city.MinLat, city.MaxLat, city.MinLng, city.MaxLng)
+	}
+}
+
+func (gr *GeoRouter) RegisterCityGeometry(name string, priority int, exclusion bool, polygons []Polygon) error {
+	if name == "" {
+		return fmt.Errorf("city name is required")
+	}
+	if len(polygons) == 0 {
+		return fmt.Errorf("city %s has no polygons", name)
+	}
+	for _, polygon := range polygons {
+		if len(polygon) == 0 || len(polygon[0]) < 3 {
+			return fmt.Errorf("city %s has a polygon with fewer than 3 vertices", name)
+		}
+	}
+
+	gr.register(&City{
+		Name:      name,
+		Priority:  priority,
+		Exclusion: exclusion,
+		Polygons:  polygons,
+	})
+	return nil
+}
+
+func (gr *GeoRouter) register(city *City) {
+	city.MinLat, city.MaxLat = math.Inf(1), math.Inf(-1)
+	city.MinLng, city.MaxLng = math.Inf(1), math.Inf(-1)
+	for _, polygon := range city.Polygons {
+		for _, vertex := range polygon[0] {
+			city.MinLat = math.Min(city.MinLat, vertex.Lat)
+			city.MaxLat = math.Max(city.MaxLat, vertex.Lat)
+			city.MinLng = math.Min(city.MinLng, vertex.Lng)
+			city.MaxLng = math.Max(city.MaxLng, vertex.Lng)
+		}
+	}
+
 	gr.mu.Lock()
 	defer gr.mu.Unlock()
-	gr.cities[name] = &City{
-		Name:   name,
-		MinLat: minLat,
-		MaxLat: maxLat,
-		MinLng: minLng,
-		MaxLng: maxLng,
+	gr.cities[city.Name] = city
+
+	gr.ordered = make([]*City, 0, len(gr.cities))
+	for _, c := range gr.cities {
+		gr.ordered = append(gr.ordered, c)
 	}
+	sort.Slice(gr.ordered, func(i, j int) bool {
+		if gr.ordered[i].Priority != gr.ordered[j].Priority {
+			return gr.ordered[i].Priority > gr.ordered[j].Priority
+		}
+		return gr.ordered[i].Name < gr.ordered[j].Name
+	})
 }
 
 func (gr *GeoRouter) GetCity(lat, lng float64) (string, error) {
 	gr.mu.RLock()
 	defer gr.mu.RUnlock()
 
-	for name, city := range gr.cities {
-		if lat >= city.MinLat && lat <= city.MaxLat &&
-			lng >= city.MinLng && lng <= city.MaxLng {
-			return name, nil
+	for _, city := range gr.ordered {
+		if !city.Contains(lat, lng) {
+			continue
+		}
+		if city.Exclusion {
+			return "", fmt.Errorf("location %f, %f is inside exclusion zone %s", lat, lng, city.Name)
 		}
+		return city.Name, nil
 	}
 
 	return "", fmt.Errorf("no city found for location: %f, %f", lat, lng)
 }
 
+func (gr *GeoRouter) GetCityInfo(name string) (City, bool) {
+	gr.mu.RLock()
+	defer gr.mu.RUnlock()
+
+	city, exists := gr.cities[name]
+	if !exists {
+		return City{}, false
+	}
+	return *city, true
+}
+
 func (gr *GeoRouter) ListCities() []string {
 	gr.mu.RLock()
 	defer gr.mu.RUnlock()
 
 	cities := make([]string, 0, len(gr.cities))
-	for name := range gr.cities {
-		cities = append(cities, name)
+	for name, city := range gr.cities {
+		if !city.Exclusion {
+			cities = append(cities, name)
+		}
 	}
+	sort.Strings(cities)
 	return cities
 }
-
@@ -0,0 +1,89 @@
+package router
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestGetCityResolvesOverlapsByPriority(t *testing.T) {
+	gr := NewGeoRouter()
+	gr.RegisterCity("region", 0, 10, 0, 10)
+	square := []Polygon{RectanglePolygon(4, 8, 4, 8)}
+	if err := gr.RegisterCityGeometry("downtown", 2, false, square); err != nil {
+		t.Fatal(err)
+	}
+	// Equal priority falls back to name order, so "annex" wins over "region".
+	if err := gr.RegisterCityGeometry("annex", 0, false, []Polygon{RectanglePolygon(0, 2, 0, 2)}); err != nil {
+		t.Fatal(err)
+	}
+	if err := gr.RegisterCityGeometry("airport", 5, true, []Polygon{RectanglePolygon(6, 7, 6, 7)}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		lat, lng float64
+		want     string
+		err      string
+	}{
+		{"region only", 3, 9, "region", ""},
+		{"downtown over region", 5, 5, "downtown", ""},
+		{"downtown edge", 4, 6, "downtown", ""},
+		{"equal priority by name", 1, 1, "annex", ""},
+		{"inside exclusion zone", 6.5, 6.5, "", "exclusion zone airport"},
+		{"exclusion zone edge", 7, 6.5, "", "exclusion zone airport"},
+		{"outside every city", 11, 5, "", "no city found"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			city, err := gr.GetCity(tt.lat, tt.lng)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("GetCity(%v, %v) = %q, %v, want an error containing %q", tt.lat, tt.lng, city, err, tt.err)
+				}
+				return
+			}
+			if err != nil || city != tt.want {
+				t.Fatalf("GetCity(%v, %v) = %q, %v, want %q", tt.lat, tt.lng, city, err, tt.want)
+			}
+		})
+	}
+
+	if want := []string{"annex", "downtown", "region"}; !slices.Equal(gr.ListCities(), want) {
+		t.Fatalf("ListCities = %v, want %v", gr.ListCities(), want)
+	}
+	if airport, ok := gr.GetCityInfo("airport"); !ok || airport.MinLat != 6 || airport.MaxLng != 7 {
+		t.Fatalf("GetCityInfo(airport) = %+v, %v", airport, ok)
+	}
+}
+
+func TestGetCityHonoursHoles(t *testing.T) {
+	gr := NewGeoRouter()
+	gr.RegisterCity("outer", 0, 10, 0, 10)
+	if err := gr.RegisterCityGeometry("ring", 1, false, []Polygon{donut}); err != nil {
+		t.Fatal(err)
+	}
+	if city, _ := gr.GetCity(5, 5); city != "outer" {
+		t.Fatalf("GetCity in the hole = %q, want the lower-priority city", city)
+	}
+	if city, _ := gr.GetCity(2, 2); city != "ring" {
+		t.Fatalf("GetCity outside the hole = %q, want ring", city)
+	}
+}
+
+func TestRegisterCityGeometryRejectsEmpty(t *testing.T) {
+	gr := NewGeoRouter()
+	if err := gr.RegisterCityGeometry("", 0, false, []Polygon{donut}); err == nil {
+		t.Fatal("a city without a name was registered")
+	}
+	if err := gr.RegisterCityGeometry("empty", 0, false, nil); err == nil {
+		t.Fatal("a city without polygons was registered")
+	}
+	if err := gr.RegisterCityGeometry("line", 0, false, []Polygon{{Ring{{0, 0}, {1, 1}}}}); err == nil {
+		t.Fatal("a city with a degenerate polygon was registered")
+	}
+	if len(gr.ListCities()) != 0 {
+		t.Fatalf("ListCities = %v, want none", gr.ListCities())
+	}
+}
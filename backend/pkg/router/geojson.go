@@ -0,0 +1,195 @@
+package router
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+type geoJSONObject struct {
+	Type        string                 `json:"type"`
+	Features    []geoJSONObject        `json:"features"`
+	Geometry    *geoJSONObject         `json:"geometry"`
+	Geometries  []geoJSONObject        `json:"geometries"`
+	Properties  map[string]interface{} `json:"properties"`
+	Coordinates json.RawMessage        `json:"coordinates"`
+}
+
+type cityDefinition struct {
+	name      string
+	priority  int
+	exclusion bool
+	polygons  []Polygon
+}
+
+func (gr *GeoRouter) LoadGeoJSONDir(dir string) ([]string, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.geojson"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+
+	loaded := make([]string, 0)
+	for _, file := range files {
+		names, err := gr.LoadGeoJSONFile(file)
+		if err != nil {
+			return loaded, err
+		}
+		loaded = append(loaded, names...)
+	}
+	return loaded, nil
+}
+
+func (gr *GeoRouter) LoadGeoJSONFile(path string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	defaultName := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	definitions, err := parseGeoJSON(data, defaultName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+
+	names := make([]string, 0, len(definitions))
+	for _, def := range definitions {
+		if err := gr.RegisterCityGeometry(def.name, def.priority, def.exclusion, def.polygons); err != nil {
+			return names, fmt.Errorf("failed to register %s from %s: %w", def.name, path, err)
+		}
+		names = append(names, def.name)
+	}
+	return names, nil
+}
+
+func parseGeoJSON(data []byte, defaultName string) ([]*cityDefinition, error) {
+	var root geoJSONObject
+	if err := json.Unmarshal(data, &root); err != nil {
+		return nil, err
+	}
+
+	byName := make(map[string]*cityDefinition)
+	order := make([]string, 0)
+
+	addFeature := func(feature geoJSONObject) error {
+		if feature.Geometry == nil {
+			return fmt.Errorf("feature has no geometry")
+		}
+		polygons, err := parseGeometry(*feature.Geometry)
+		if err != nil {
+			return err
+		}
+
+		name := stringProperty(feature.Properties, "name")
+		if name == "" {
+			name = defaultName
+		}
+		def, exists := byName[name]
+		if !exists {
+			def = &cityDefinition{name: name}
+			byName[name] = def
+			order = append(order, name)
+		}
+		if priority, ok := feature.Properties["priority"].(float64); ok && int(priority) > def.priority {
+			def.priority = int(priority)
+		}
+		if exclusion, ok := feature.Properties["exclusion"].(bool); ok && exclusion {
+			def.exclusion = true
+		}
+		def.polygons = append(def.polygons, polygons...)
+		return nil
+	}
+
+	switch root.Type {
+	case "FeatureCollection":
+		for _, feature := range root.Features {
+			if err := addFeature(feature); err != nil {
+				return nil, err
+			}
+		}
+	case "Feature":
+		if err := addFeature(root); err != nil {
+			return nil, err
+		}
+	default:
+		if err := addFeature(geoJSONObject{Geometry: &root}); err != nil {
+			return nil, err
+		}
+	}
+
+	definitions := make([]*cityDefinition, 0, len(order))
+	for _, name := range order {
+		definitions = append(definitions, byName[name])
+	}
+	return definitions, nil
+}
+
+func parseGeometry(geometry geoJSONObject) ([]Polygon, error) {
+	switch geometry.Type {
+	case "Polygon":
+		var coordinates [][][]float64
+		if err := json.Unmarshal(geometry.Coordinates, &coordinates); err != nil {
+			return nil, err
+		}
+		polygon, err := toPolygon(coordinates)
+		if err != nil {
+			return nil, err
+		}
+		return []Polygon{polygon}, nil
+	case "MultiPolygon":
+		var coordinates [][][][]float64
+		if err := json.Unmarshal(geometry.Coordinates, &coordinates); err != nil {
+			return nil, err
+		}
+		polygons := make([]Polygon, 0, len(coordinates))
+		for _, rings := range coordinates {
+			polygon, err := toPolygon(rings)
+			if err != nil {
+				return nil, err
+			}
+			polygons = append(polygons, polygon)
+		}
+		return polygons, nil
+	case "GeometryCollection":
+		polygons := make([]Polygon, 0)
+		for _, child := range geometry.Geometries {
+			childPolygons, err := parseGeometry(child)
+			if err != nil {
+				return nil, err
+			}
+			polygons = append(polygons, childPolygons...)
+		}
+		return polygons, nil
+	default:
+		return nil, fmt.Errorf("unsupported geometry type: %q", geometry.Type)
+	}
+}
+
+func toPolygon(rings [][][]float64) (Polygon, error) {
+	polygon := make(Polygon, 0, len(rings))
+	for _, ring := range rings {
+		if len(ring) < 4 {
+			return nil, fmt.Errorf("ring has fewer than 4 positions")
+		}
+		converted := make(Ring, 0, len(ring))
+		for _, position := range ring {
+			if len(position) < 2 {
+				return nil, fmt.Errorf("position needs longitude and latitude")
+			}
+			converted = append(converted, Vertex{Lat: position[1], Lng: position[0]})
+		}
+		if converted[0] != converted[len(converted)-1] {
+			return nil, fmt.Errorf("ring is not closed")
+		}
+		polygon = append(polygon, converted)
+	}
+	return polygon, nil
+}
+
+func stringProperty(properties map[string]interface{}, key string) string {
+	value, _ := properties[key].(string)
+	return value
+}
@@ -0,0 +1,120 @@
+package router
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+const cityCollection = `{
+	"type": "FeatureCollection",
+	"features": [
+		{
+			"type": "Feature",
+			"properties": {"name": "metro", "priority": 1},
+			"geometry": {"type": "Polygon", "coordinates": [
+				[[0, 0], [10, 0], [10, 10], [0, 10], [0, 0]],
+				[[4, 4], [6, 4], [6, 6], [4, 6], [4, 4]]
+			]}
+		},
+		{
+			"type": "Feature",
+			"properties": {"name": "metro"},
+			"geometry": {"type": "MultiPolygon", "coordinates": [
+				[[[20, 0], [22, 0], [22, 2], [20, 2], [20, 0]]]
+			]}
+		},
+		{
+			"type": "Feature",
+			"properties": {"name": "airport", "priority": 5, "exclusion": true},
+			"geometry": {"type": "Polygon", "coordinates": [
+				[[1, 1], [2, 1], [2, 2], [1, 2], [1, 1]]
+			]}
+		}
+	]
+}`
+
+func TestParseGeoJSON(t *testing.T) {
+	definitions, err := parseGeoJSON([]byte(cityCollection), "fallback")
+	if err != nil {
+		t.Fatalf("parseGeoJSON: %v", err)
+	}
+	if len(definitions) != 2 {
+		t.Fatalf("parsed %d cities, want 2", len(definitions))
+	}
+
+	metro, airport := definitions[0], definitions[1]
+	if metro.name != "metro" || metro.priority != 1 || metro.exclusion || len(metro.polygons) != 2 {
+		t.Fatalf("metro = %s priority %d exclusion %v with %d polygons", metro.name, metro.priority, metro.exclusion, len(metro.polygons))
+	}
+	// GeoJSON positions are [lng, lat].
+	if hole := metro.polygons[0][1]; len(hole) != 5 || hole[1] != (Vertex{Lat: 4, Lng: 6}) {
+		t.Fatalf("metro hole = %v", hole)
+	}
+	if airport.name != "airport" || airport.priority != 5 || !airport.exclusion {
+		t.Fatalf("airport = %s priority %d exclusion %v", airport.name, airport.priority, airport.exclusion)
+	}
+
+	bare := `{"type": "Polygon", "coordinates": [[[0, 0], [1, 0], [1, 1], [0, 0]]]}`
+	definitions, err = parseGeoJSON([]byte(bare), "fallback")
+	if err != nil || len(definitions) != 1 || definitions[0].name != "fallback" {
+		t.Fatalf("bare geometry = %v, %v, want one city named after the file", definitions, err)
+	}
+}
+
+func TestParseGeoJSONRejectsMalformed(t *testing.T) {
+	tests := []struct {
+		name, data, want string
+	}{
+		{"not json", `{"type": "Polygon"`, "unexpected end"},
+		{"unclosed ring", `{"type": "Polygon", "coordinates": [[[0, 0], [1, 0], [1, 1], [0, 1]]]}`, "not closed"},
+		{"unclosed hole", `{"type": "Polygon", "coordinates": [[[0, 0], [4, 0], [4, 4], [0, 0]], [[1, 1], [2, 1], [2, 2], [1, 2]]]}`, "not closed"},
+		{"too few positions", `{"type": "Polygon", "coordinates": [[[0, 0], [1, 0], [0, 0]]]}`, "fewer than 4"},
+		{"missing latitude", `{"type": "Polygon", "coordinates": [[[0, 0], [1], [1, 1], [0, 0]]]}`, "longitude and latitude"},
+		{"point", `{"type": "Point", "coordinates": [0, 0]}`, "unsupported geometry type"},
+		{"line string", `{"type": "LineString", "coordinates": [[0, 0], [1, 1]]}`, "unsupported geometry type"},
+		{"polygon coordinates too shallow", `{"type": "Polygon", "coordinates": [[0, 0], [1, 0], [1, 1], [0, 0]]}`, "cannot unmarshal"},
+		{"feature without geometry", `{"type": "Feature", "properties": {"name": "x"}}`, "no geometry"},
+		{"bad member of a collection", `{"type": "GeometryCollection", "geometries": [{"type": "Point", "coordinates": [0, 0]}]}`, "unsupported geometry type"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseGeoJSON([]byte(tt.data), "city")
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("parseGeoJSON = %v, want an error containing %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadGeoJSONDir(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, data string) {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("cities.geojson", cityCollection)
+	write("suburb.geojson", `{"type": "Polygon", "coordinates": [[[30, 30], [31, 30], [31, 31], [30, 30]]]}`)
+	write("notes.txt", "not a boundary")
+
+	gr := NewGeoRouter()
+	loaded, err := gr.LoadGeoJSONDir(dir)
+	if err != nil {
+		t.Fatalf("LoadGeoJSONDir: %v", err)
+	}
+	if want := []string{"metro", "airport", "suburb"}; !slices.Equal(loaded, want) {
+		t.Fatalf("loaded %v, want %v", loaded, want)
+	}
+	if city, err := gr.GetCity(1, 21); err != nil || city != "metro" {
+		t.Fatalf("GetCity in metro's second polygon = %q, %v", city, err)
+	}
+
+	write("broken.geojson", `{"type": "Polygon", "coordinates": [[[0, 0], [1, 0], [1, 1], [0, 1]]]}`)
+	if _, err := NewGeoRouter().LoadGeoJSONDir(dir); err == nil || !strings.Contains(err.Error(), "broken.geojson") {
+		t.Fatalf("LoadGeoJSONDir with a broken file = %v, want an error naming it", err)
+	}
+}
@@ -0,0 +1,70 @@
+package router
+
+type Vertex struct {
+	Lat float64
+	Lng float64
+}
+
+type Ring []Vertex
+
+// Polygon is an outer ring followed by zero or more holes.
+type Polygon []Ring
+
+func RectanglePolygon(minLat, maxLat, minLng, maxLng float64) Polygon {
+	return Polygon{Ring{
+		{Lat: minLat, Lng: minLng},
+		{Lat: minLat, Lng: maxLng},
+		{Lat: maxLat, Lng: maxLng},
+		{Lat: maxLat, Lng: minLng},
+		{Lat: minLat, Lng: minLng},
+	}}
+}
+
+func (p Polygon) Contains(lat, lng float64) bool {
+	if len(p) == 0 || !p[0].Contains(lat, lng) {
+		return false
+	}
+	for _, hole := range p[1:] {
+		if hole.Contains(lat, lng) && !hole.onBoundary(lat, lng) {
+			return false
+		}
+	}
+	return true
+}
+
+func (r Ring) Contains(lat, lng float64) bool {
+	if len(r) < 3 {
+		return false
+	}
+	if r.onBoundary(lat, lng) {
+		return true
+	}
+
+	inside := false
+	for i, j := 0, len(r)-1; i < len(r); j, i = i, i+1 {
+		a, b := r[i], r[j]
+		if (a.Lat > lat) != (b.Lat > lat) {
+			crossLng := a.Lng + (lat-a.Lat)*(b.Lng-a.Lng)/(b.Lat-a.Lat)
+			if lng < crossLng {
+				inside = !inside
+			}
+		}
+	}
+	return inside
+}
+
+func (r Ring) onBoundary(lat, lng float64) bool {
+	const epsilon = 1e-12
+	for i, j := 0, len(r)-1; i < len(r); j, i = i, i+1 {
+		a, b := r[i], r[j]
+		cross := (b.Lng-a.Lng)*(lat-a.Lat) - (b.Lat-a.Lat)*(lng-a.Lng)
+		if cross > epsilon || cross < -epsilon {
+			continue
+		}
+		if lat >= min(a.Lat, b.Lat) && lat <= max(a.Lat, b.Lat) &&
+			lng >= min(a.Lng, b.Lng) && lng <= max(a.Lng, b.Lng) {
+			return true
+		}
+	}
+	return false
+}
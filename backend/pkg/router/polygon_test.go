@@ -0,0 +1,59 @@
+package router
+
+import "testing"
+
+// donut is a 10x10 square with a 2x2 hole in its middle.
+var donut = Polygon{
+	Ring{{0, 0}, {0, 10}, {10, 10}, {10, 0}, {0, 0}},
+	Ring{{4, 4}, {4, 6}, {6, 6}, {6, 4}, {4, 4}},
+}
+
+func TestPolygonContains(t *testing.T) {
+	tests := []struct {
+		name     string
+		lat, lng float64
+		want     bool
+	}{
+		{"interior", 2, 2, true},
+		{"outer edge", 0, 5, true},
+		{"outer vertex", 10, 10, true},
+		{"outside", 11, 5, false},
+		{"outside on an edge's line", 0, 12, false},
+		{"inside the hole", 5, 5, false},
+		{"hole edge", 4, 5, true},
+		{"hole vertex", 6, 6, true},
+		{"between hole and outer edge", 5, 8, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := donut.Contains(tt.lat, tt.lng); got != tt.want {
+				t.Fatalf("Contains(%v, %v) = %v, want %v", tt.lat, tt.lng, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRingContainsConcave(t *testing.T) {
+	// A U shape opening north: the notch between the arms is outside.
+	u := Ring{{0, 0}, {3, 0}, {3, 1}, {1, 1}, {1, 2}, {3, 2}, {3, 3}, {0, 3}, {0, 0}}
+	tests := []struct {
+		lat, lng float64
+		want     bool
+	}{
+		{0.5, 1.5, true},
+		{2, 0.5, true},
+		{2, 2.5, true},
+		{2, 1.5, false},
+		{1, 1.5, true},
+		{3, 1.5, false},
+	}
+	for _, tt := range tests {
+		if got := u.Contains(tt.lat, tt.lng); got != tt.want {
+			t.Errorf("Contains(%v, %v) = %v, want %v", tt.lat, tt.lng, got, tt.want)
+		}
+	}
+
+	if (Ring{{0, 0}, {1, 1}}).Contains(0, 0) {
+		t.Fatal("a ring of two vertices contains a point")
+	}
+}
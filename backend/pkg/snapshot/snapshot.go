@@ -0,0 +1,269 @@
+package snapshot
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+	"uber-system/pkg/manager"
+)
+
+// A snapshot file is a fixed header followed by a gob-encoded manager.State:
+//
+//	magic [8]byte | version uint32 | length uint64 | crc32 uint32 | payload
+const (
+	magic         = "UBERSNAP"
+	formatVersion = 1
+	headerSize    = len(magic) + 4 + 8 + 4
+)
+
+var ErrCorrupt = errors.New("snapshot is corrupt")
+
+type Info struct {
+	Path     string        `json:"path"`
+	Drivers  int           `json:"drivers"`
+	Cities   int           `json:"cities"`
+	Bytes    int64         `json:"bytes"`
+	TakenAt  time.Time     `json:"taken_at"`
+	Duration time.Duration `json:"duration"`
+}
+
+// Write encodes state to path. The file is written next to path, synced and
+// renamed over it, so a crash leaves either the previous snapshot or the new
+// one, never a partial file.
+func Write(path string, state manager.State) (Info, error) {
+	start := time.Now()
+
+	var payload bytes.Buffer
+	if err := gob.NewEncoder(&payload).Encode(state); err != nil {
+		return Info{}, fmt.Errorf("failed to encode snapshot: %w", err)
+	}
+
+	header := make([]byte, headerSize)
+	copy(header, magic)
+	binary.BigEndian.PutUint32(header[8:], formatVersion)
+	binary.BigEndian.PutUint64(header[12:], uint64(payload.Len()))
+	binary.BigEndian.PutUint32(header[20:], crc32.ChecksumIEEE(payload.Bytes()))
+
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return Info{}, fmt.Errorf("failed to create snapshot dir: %w", err)
+	}
+	tmp, err := os.CreateTemp(dir, filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return Info{}, err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(header); err != nil {
+		tmp.Close()
+		return Info{}, err
+	}
+	if _, err := tmp.Write(payload.Bytes()); err != nil {
+		tmp.Close()
+		return Info{}, err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return Info{}, err
+	}
+	if err := tmp.Close(); err != nil {
+		return Info{}, err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return Info{}, err
+	}
+	if d, err := os.Open(dir); err == nil {
+		d.Sync()
+		d.Close()
+	}
+
+	return Info{
+		Path:     path,
+		Drivers:  len(state.Drivers),
+		Cities:   countCities(state),
+		Bytes:    int64(headerSize + payload.Len()),
+		TakenAt:  state.TakenAt,
+		Duration: time.Since(start),
+	}, nil
+}
+
+// Read decodes the snapshot at path, verifying its header and checksum. A
+// missing file is reported with an error satisfying os.IsNotExist.
+func Read(path string) (manager.State, Info, error) {
+	start := time.Now()
+	var state manager.State
+
+	file, err := os.Open(path)
+	if err != nil {
+		return state, Info{}, err
+	}
+	defer file.Close()
+
+	header := make([]byte, headerSize)
+	if _, err := io.ReadFull(file, header); err != nil {
+		return state, Info{}, fmt.Errorf("%w: short header", ErrCorrupt)
+	}
+	if string(header[:8]) != magic {
+		return state, Info{}, fmt.Errorf("%w: bad magic", ErrCorrupt)
+	}
+	if version := binary.BigEndian.Uint32(header[8:]); version != formatVersion {
+		return state, Info{}, fmt.Errorf("unsupported snapshot version %d", version)
+	}
+	length := binary.BigEndian.Uint64(header[12:])
+	checksum := binary.BigEndian.Uint32(header[20:])
+
+	stat, err := file.Stat()
+	if err != nil {
+		return state, Info{}, err
+	}
+	if uint64(stat.Size()) != uint64(headerSize)+length {
+		return state, Info{}, fmt.Errorf("%w: expected %d payload bytes, file has %d", ErrCorrupt, length, stat.Size()-int64(headerSize))
+	}
+
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(file, payload); err != nil {
+		return state, Info{}, fmt.Errorf("%w: %v", ErrCorrupt, err)
+	}
+	if crc32.ChecksumIEEE(payload) != checksum {
+		return state, Info{}, fmt.Errorf("%w: checksum mismatch", ErrCorrupt)
+	}
+	if err := gob.NewDecoder(bytes.NewReader(payload)).Decode(&state); err != nil {
+		return state, Info{}, fmt.Errorf("%w: %v", ErrCorrupt, err)
+	}
+
+	return state, Info{
+		Path:     path,
+		Drivers:  len(state.Drivers),
+		Cities:   countCities(state),
+		Bytes:    stat.Size(),
+		TakenAt:  state.TakenAt,
+		Duration: time.Since(start),
+	}, nil
+}
+
+func countCities(state manager.State) int {
+	cities := make(map[string]struct{})
+	for _, city := range state.DriverCities {
+		cities[city] = struct{}{}
+	}
+	return len(cities)
+}
+
+// Save snapshots mgr to path.
+func Save(mgr *manager.DriverManager, path string) (Info, error) {
+	start := time.Now()
+	info, err := Write(path, mgr.Snapshot())
+	info.Duration = time.Since(start)
+	return info, err
+}
+
+// Load restores mgr from the snapshot at path.
+func Load(mgr *manager.DriverManager, path string) (Info, manager.RestoreReport, error) {
+	start := time.Now()
+	state, info, err := Read(path)
+	if err != nil {
+		return info, manager.RestoreReport{}, err
+	}
+	report, err := mgr.Restore(state)
+	info.Duration = time.Since(start)
+	return info, report, err
+}
+
+// Scheduler writes a snapshot every interval until stopped. With a zero
+// interval it only takes snapshots on demand.
+type Scheduler struct {
+	mgr      *manager.DriverManager
+	path     string
+	interval time.Duration
+	last     Info
+	lastErr  error
+	stop     chan struct{}
+	wg       sync.WaitGroup
+	mu       sync.Mutex
+}
+
+func Start(mgr *manager.DriverManager, path string, interval time.Duration) *Scheduler {
+	s := &Scheduler{
+		mgr:      mgr,
+		path:     path,
+		interval: interval,
+		stop:     make(chan struct{}),
+	}
+	if interval > 0 {
+		s.wg.Add(1)
+		go s.run()
+	}
+	return s
+}
+
+func (s *Scheduler) run() {
+	defer s.wg.Done()
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+			if _, err := s.Save(); err != nil {
+				fmt.Printf("Snapshot error: %v\n", err)
+			}
+		}
+	}
+}
+
+// Save takes a snapshot now. Calls are serialised so a manual snapshot never
+// races the periodic one for the same file.
+func (s *Scheduler) Save() (Info, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	info, err := Save(s.mgr, s.path)
+	if err == nil {
+		s.last = info
+	}
+	s.lastErr = err
+	return info, err
+}
+
+// Restore loads the scheduler's snapshot file into the manager.
+func (s *Scheduler) Restore() (Info, manager.RestoreReport, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return Load(s.mgr, s.path)
+}
+
+// Stats reports the scheduler's configuration and its last snapshot.
+func (s *Scheduler) Stats() map[string]interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stats := map[string]interface{}{
+		"path":     s.path,
+		"interval": s.interval.String(),
+	}
+	if !s.last.TakenAt.IsZero() {
+		stats["last_taken_at"] = s.last.TakenAt
+		stats["last_drivers"] = s.last.Drivers
+		stats["last_bytes"] = s.last.Bytes
+	}
+	if s.lastErr != nil {
+		stats["last_error"] = s.lastErr.Error()
+	}
+	return stats
+}
+
+// Stop halts the periodic snapshots. It does not take a final one.
+func (s *Scheduler) Stop() {
+	close(s.stop)
+	s.wg.Wait()
+}
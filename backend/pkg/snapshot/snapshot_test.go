@@ -0,0 +1,109 @@
+package snapshot
+
+import (
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+	"uber-system/pkg/manager"
+	"uber-system/pkg/models"
+)
+
+func testState() manager.State {
+	takenAt := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+	return manager.State{
+		TakenAt: takenAt,
+		Drivers: []models.Driver{
+			{ID: "driver-1", Location: models.Location{Lat: 12.97, Lng: 77.59}, Status: models.StatusAvailable, UpdatedAt: takenAt, LocationUpdatedAt: takenAt},
+			{ID: "driver-2", Location: models.Location{Lat: 13.05, Lng: 80.25}, Status: models.StatusReserved, UpdatedAt: takenAt, LocationUpdatedAt: takenAt},
+		},
+		DriverCities: map[string]string{"driver-1": "bangalore", "driver-2": "chennai"},
+		StatusHistory: map[string][]models.StatusTransition{
+			"driver-2": {{From: models.StatusAvailable, To: models.StatusReserved, At: takenAt}},
+		},
+		Clocks:   map[string]manager.DeviceClock{"driver-1": {Time: takenAt, Seq: 7}},
+		Counters: map[string]int{"stale_drivers": 3},
+	}
+}
+
+func writeTestSnapshot(t *testing.T) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "snapshot.bin")
+	if _, err := Write(path, testState()); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	return path
+}
+
+func TestWriteReadRoundTrip(t *testing.T) {
+	want := testState()
+	path := filepath.Join(t.TempDir(), "nested", "snapshot.bin")
+	written, err := Write(path, want)
+	if err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+
+	got, read, err := Read(path)
+	if err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("Read = %+v, want %+v", got, want)
+	}
+	if read.Drivers != 2 || read.Cities != 2 || read.Bytes != written.Bytes || !read.TakenAt.Equal(want.TakenAt) {
+		t.Fatalf("Read info = %+v, Write info = %+v", read, written)
+	}
+
+	leftovers, _ := filepath.Glob(filepath.Join(filepath.Dir(path), "*.tmp-*"))
+	if len(leftovers) != 0 {
+		t.Fatalf("Write left temp files behind: %v", leftovers)
+	}
+}
+
+func TestReadRejectsCorruptFiles(t *testing.T) {
+	tests := []struct {
+		name    string
+		damage  func(data []byte) []byte
+		corrupt bool
+	}{
+		{"short header", func(data []byte) []byte { return data[:headerSize-1] }, true},
+		{"bad magic", func(data []byte) []byte { data[0] = 'X'; return data }, true},
+		{"truncated payload", func(data []byte) []byte { return data[:len(data)-1] }, true},
+		{"trailing bytes", func(data []byte) []byte { return append(data, 0) }, true},
+		{"bad checksum", func(data []byte) []byte { data[20] ^= 0xff; return data }, true},
+		{"flipped payload byte", func(data []byte) []byte { data[len(data)-1] ^= 0xff; return data }, true},
+		{"newer version", func(data []byte) []byte {
+			binary.BigEndian.PutUint32(data[8:], formatVersion+1)
+			return data
+		}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeTestSnapshot(t)
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatalf("ReadFile: %v", err)
+			}
+			if err := os.WriteFile(path, tt.damage(data), 0o644); err != nil {
+				t.Fatalf("WriteFile: %v", err)
+			}
+
+			_, _, err = Read(path)
+			if err == nil {
+				t.Fatal("Read accepted a damaged snapshot")
+			}
+			if errors.Is(err, ErrCorrupt) != tt.corrupt {
+				t.Fatalf("Read = %v, want ErrCorrupt %v", err, tt.corrupt)
+			}
+		})
+	}
+}
+
+func TestReadMissingFile(t *testing.T) {
+	if _, _, err := Read(filepath.Join(t.TempDir(), "snapshot.bin")); !os.IsNotExist(err) {
+		t.Fatalf("Read = %v, want a not-exist error", err)
+	}
+}
@@ -0,0 +1,179 @@
+package stream
+
+import (
+	"fmt"
+	"hash/fnv"
+	"sync"
+	"time"
+)
+
+// Handler processes a batch of messages from one partition. Returning an
+// error leaves the offset uncommitted so the batch is delivered again.
+type Handler func(partition string, messages []Message) error
+
+type ConsumerConfig struct {
+	Workers      int
+	BatchSize    int
+	PollInterval time.Duration
+	RetryBackoff time.Duration
+}
+
+func DefaultConsumerConfig() ConsumerConfig {
+	return ConsumerConfig{
+		Workers:      4,
+		BatchSize:    500,
+		PollInterval: 250 * time.Millisecond,
+		RetryBackoff: time.Second,
+	}
+}
+
+// Consumer runs a pool of workers for one group. Each partition is owned by
+// exactly one worker, so messages within a partition are handled in order.
+type Consumer struct {
+	log     *Log
+	group   *Group
+	config  ConsumerConfig
+	handler Handler
+	stop    chan struct{}
+	wg      sync.WaitGroup
+}
+
+func (l *Log) Consume(groupName string, config ConsumerConfig, handler Handler) (*Consumer, error) {
+	defaults := DefaultConsumerConfig()
+	if config.Workers <= 0 {
+		config.Workers = defaults.Workers
+	}
+	if config.BatchSize <= 0 {
+		config.BatchSize = defaults.BatchSize
+	}
+	if config.PollInterval <= 0 {
+		config.PollInterval = defaults.PollInterval
+	}
+	if config.RetryBackoff <= 0 {
+		config.RetryBackoff = defaults.RetryBackoff
+	}
+
+	group, err := l.Group(groupName)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Consumer{
+		log:     l,
+		group:   group,
+		config:  config,
+		handler: handler,
+		stop:    make(chan struct{}),
+	}
+	for worker := 0; worker < config.Workers; worker++ {
+		c.wg.Add(1)
+		go c.run(worker)
+	}
+	return c, nil
+}
+
+func (c *Consumer) owns(worker int, partition string) bool {
+	h := fnv.New32a()
+	h.Write([]byte(partition))
+	return int(h.Sum32()%uint32(c.config.Workers)) == worker
+}
+
+func (c *Consumer) run(worker int) {
+	defer c.wg.Done()
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+
+	for {
+		changed := c.log.Changed()
+		progressed, failed := false, false
+		for _, partition := range c.log.Partitions() {
+			if !c.owns(worker, partition) {
+				continue
+			}
+			n, err := c.poll(partition)
+			if err != nil {
+				fmt.Printf("Stream consumer %s error on %s: %v\n", c.group.Name(), partition, err)
+				failed = true
+			}
+			progressed = progressed || n > 0
+		}
+
+		if progressed && !failed {
+			select {
+			case <-c.stop:
+				return
+			default:
+				continue
+			}
+		}
+
+		wait := c.config.PollInterval
+		if failed {
+			wait = c.config.RetryBackoff
+			changed = nil
+		}
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		timer.Reset(wait)
+
+		select {
+		case <-c.stop:
+			return
+		case <-changed:
+		case <-timer.C:
+		}
+	}
+}
+
+func (c *Consumer) poll(partition string) (int, error) {
+	offset := c.group.Committed(partition)
+	messages, err := c.log.Read(partition, offset, c.config.BatchSize)
+	if err != nil || len(messages) == 0 {
+		return 0, err
+	}
+	if err := c.handler(partition, messages); err != nil {
+		return 0, err
+	}
+	return len(messages), c.group.Commit(partition, offset+int64(len(messages)))
+}
+
+// Lag reports how many messages in each partition the group has not yet
+// committed.
+func (c *Consumer) Lag() map[string]int64 {
+	lag := make(map[string]int64)
+	for _, partition := range c.log.Partitions() {
+		lag[partition] = c.log.EndOffset(partition) - c.group.Committed(partition)
+	}
+	return lag
+}
+
+// Drain blocks until every partition has been consumed up to its current end
+// offset or the timeout expires.
+func (c *Consumer) Drain(timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for {
+		done := true
+		for _, lag := range c.Lag() {
+			if lag > 0 {
+				done = false
+				break
+			}
+		}
+		if done {
+			return true
+		}
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func (c *Consumer) Close() {
+	close(c.stop)
+	c.wg.Wait()
+}
@@ -0,0 +1,162 @@
+package stream
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+type collector struct {
+	messages map[string][]Message
+	mu       sync.Mutex
+}
+
+func newCollector() *collector {
+	return &collector{messages: make(map[string][]Message)}
+}
+
+func (c *collector) handle(partition string, messages []Message) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.messages[partition] = append(c.messages[partition], messages...)
+	return nil
+}
+
+func (c *collector) received(partition string) []Message {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]Message(nil), c.messages[partition]...)
+}
+
+var testConsumerConfig = ConsumerConfig{
+	Workers:      2,
+	BatchSize:    4,
+	PollInterval: 10 * time.Millisecond,
+	RetryBackoff: 10 * time.Millisecond,
+}
+
+func TestConsumerDrainsEveryPartitionInOrder(t *testing.T) {
+	l := openLog(t, t.TempDir())
+	defer l.Close()
+	partitions := []string{"bangalore", "mumbai", "delhi"}
+	for _, partition := range partitions {
+		appendN(t, l, partition, 0, 25)
+	}
+
+	got := newCollector()
+	consumer, err := l.Consume("indexer", testConsumerConfig, got.handle)
+	if err != nil {
+		t.Fatalf("Consume: %v", err)
+	}
+	defer consumer.Close()
+
+	if !consumer.Drain(5 * time.Second) {
+		t.Fatalf("Drain timed out with lag %v", consumer.Lag())
+	}
+	for _, partition := range partitions {
+		messages := got.received(partition)
+		if len(messages) != 25 {
+			t.Fatalf("%s: received %d messages, want 25", partition, len(messages))
+		}
+		checkMessages(t, messages, partition, 0)
+	}
+
+	appendN(t, l, "mumbai", 25, 5)
+	if !consumer.Drain(5 * time.Second) {
+		t.Fatalf("Drain timed out with lag %v", consumer.Lag())
+	}
+	checkMessages(t, got.received("mumbai"), "mumbai", 0)
+	if n := len(got.received("mumbai")); n != 30 {
+		t.Fatalf("mumbai: received %d messages, want 30", n)
+	}
+}
+
+func TestConsumerResumesFromCommittedOffset(t *testing.T) {
+	dir := t.TempDir()
+	l := openLog(t, dir)
+	appendN(t, l, "hyderabad", 0, 10)
+
+	first := newCollector()
+	consumer, err := l.Consume("indexer", testConsumerConfig, first.handle)
+	if err != nil {
+		t.Fatalf("Consume: %v", err)
+	}
+	if !consumer.Drain(5 * time.Second) {
+		t.Fatalf("Drain timed out with lag %v", consumer.Lag())
+	}
+	consumer.Close()
+	appendN(t, l, "hyderabad", 10, 6)
+	l.Close()
+
+	l = openLog(t, dir)
+	defer l.Close()
+	group, err := l.Group("indexer")
+	if err != nil {
+		t.Fatalf("Group: %v", err)
+	}
+	if committed := group.Committed("hyderabad"); committed != 10 {
+		t.Fatalf("committed offset after reopen = %d, want 10", committed)
+	}
+
+	second := newCollector()
+	consumer, err = l.Consume("indexer", testConsumerConfig, second.handle)
+	if err != nil {
+		t.Fatalf("Consume: %v", err)
+	}
+	defer consumer.Close()
+	if !consumer.Drain(5 * time.Second) {
+		t.Fatalf("Drain timed out with lag %v", consumer.Lag())
+	}
+	messages := second.received("hyderabad")
+	if len(messages) != 6 {
+		t.Fatalf("resumed consumer received %d messages, want 6", len(messages))
+	}
+	checkMessages(t, messages, "hyderabad", 10)
+
+	other := newCollector()
+	fresh, err := l.Consume("auditor", testConsumerConfig, other.handle)
+	if err != nil {
+		t.Fatalf("Consume: %v", err)
+	}
+	defer fresh.Close()
+	if !fresh.Drain(5 * time.Second) {
+		t.Fatalf("Drain timed out with lag %v", fresh.Lag())
+	}
+	if n := len(other.received("hyderabad")); n != 16 {
+		t.Fatalf("new group received %d messages, want 16", n)
+	}
+}
+
+func TestConsumerRedeliversFailedBatch(t *testing.T) {
+	l := openLog(t, t.TempDir())
+	defer l.Close()
+	appendN(t, l, "chennai", 0, 3)
+
+	got := newCollector()
+	failures := 2
+	var mu sync.Mutex
+	handler := func(partition string, messages []Message) error {
+		mu.Lock()
+		defer mu.Unlock()
+		if failures > 0 {
+			failures--
+			return errors.New("index unavailable")
+		}
+		return got.handle(partition, messages)
+	}
+
+	consumer, err := l.Consume("indexer", testConsumerConfig, handler)
+	if err != nil {
+		t.Fatalf("Consume: %v", err)
+	}
+	defer consumer.Close()
+	if !consumer.Drain(5 * time.Second) {
+		t.Fatalf("Drain timed out with lag %v", consumer.Lag())
+	}
+	messages := got.received("chennai")
+	if len(messages) != 3 {
+		t.Fatalf("received %d messages, want 3", len(messages))
+	}
+	checkMessages(t, messages, "chennai", 0)
+}
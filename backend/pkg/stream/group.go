@@ -0,0 +1,116 @@
+package stream
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Group tracks the committed offsets of one consumer group. The offset for a
+// partition is the next message the group has yet to process.
+type Group struct {
+	name     string
+	path     string
+	offsets  map[string]int64
+	readOnly bool
+	mu       sync.Mutex
+}
+
+func (l *Log) Group(name string) (*Group, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if group, exists := l.groups[name]; exists {
+		return group, nil
+	}
+
+	group := &Group{
+		name:     name,
+		path:     filepath.Join(l.dir, "groups", url.PathEscape(name)+".json"),
+		offsets:  make(map[string]int64),
+		readOnly: l.options.ReadOnly,
+	}
+	data, err := os.ReadFile(group.path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &group.offsets); err != nil {
+			return nil, fmt.Errorf("failed to read offsets for group %s: %w", name, err)
+		}
+	}
+	l.groups[name] = group
+	return group, nil
+}
+
+func (g *Group) Name() string {
+	return g.name
+}
+
+func (g *Group) Committed(partition string) int64 {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.offsets[partition]
+}
+
+// Commit records offset as the next message to process and persists every
+// partition's offset atomically: the new offsets are synced to a temporary
+// file that is renamed over the old one, and the directory is synced so the
+// rename survives a crash. The offset is only recorded once it is on disk.
+func (g *Group) Commit(partition string, offset int64) error {
+	if g.readOnly {
+		return ErrReadOnly
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	previous, existed := g.offsets[partition]
+	g.offsets[partition] = offset
+	if err := g.persistLocked(); err != nil {
+		if existed {
+			g.offsets[partition] = previous
+		} else {
+			delete(g.offsets, partition)
+		}
+		return err
+	}
+	return nil
+}
+
+func (g *Group) persistLocked() error {
+	data, err := json.Marshal(g.offsets)
+	if err != nil {
+		return err
+	}
+
+	dir := filepath.Dir(g.path)
+	tmp, err := os.CreateTemp(dir, filepath.Base(g.path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), g.path); err != nil {
+		return err
+	}
+	if d, err := os.Open(dir); err == nil {
+		d.Sync()
+		d.Close()
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+package stream
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestGroupCommitPersistsAcrossReopen(t *testing.T) {
+	dir := t.TempDir()
+	l := openLog(t, dir)
+	group, err := l.Group("indexer/main")
+	if err != nil {
+		t.Fatalf("Group: %v", err)
+	}
+	for partition, offset := range map[string]int64{"bangalore": 7, "mumbai": 3} {
+		if err := group.Commit(partition, offset); err != nil {
+			t.Fatalf("Commit: %v", err)
+		}
+	}
+	if err := group.Commit("bangalore", 9); err != nil {
+		t.Fatalf("Commit: %v", err)
+	}
+	l.Close()
+
+	files, _ := filepath.Glob(filepath.Join(dir, "groups", "*"))
+	if len(files) != 1 || filepath.Base(files[0]) != "indexer%2Fmain.json" {
+		t.Fatalf("groups dir holds %v, want only the offsets file", files)
+	}
+
+	reopened, err := openLog(t, dir).Group("indexer/main")
+	if err != nil {
+		t.Fatalf("Group after reopen: %v", err)
+	}
+	if bangalore, mumbai := reopened.Committed("bangalore"), reopened.Committed("mumbai"); bangalore != 9 || mumbai != 3 {
+		t.Fatalf("committed offsets = %d, %d, want 9, 3", bangalore, mumbai)
+	}
+}
+
+func TestGroupCommitFailureKeepsOffset(t *testing.T) {
+	dir := t.TempDir()
+	l := openLog(t, dir)
+	defer l.Close()
+	group, err := l.Group("indexer")
+	if err != nil {
+		t.Fatalf("Group: %v", err)
+	}
+	if err := group.Commit("bangalore", 5); err != nil {
+		t.Fatalf("Commit: %v", err)
+	}
+
+	// With the groups dir gone the offsets cannot be written.
+	if err := os.RemoveAll(filepath.Join(dir, "groups")); err != nil {
+		t.Fatal(err)
+	}
+	if err := group.Commit("bangalore", 8); err == nil {
+		t.Fatal("Commit succeeded without a groups dir")
+	}
+	if err := group.Commit("mumbai", 2); err == nil {
+		t.Fatal("Commit succeeded without a groups dir")
+	}
+	if bangalore, mumbai := group.Committed("bangalore"), group.Committed("mumbai"); bangalore != 5 || mumbai != 0 {
+		t.Fatalf("committed offsets = %d, %d after failed commits, want 5, 0", bangalore, mumbai)
+	}
+}
@@ -0,0 +1,401 @@
+package stream
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Record frame: length (uint32) and CRC32 (uint32) of the body, followed by
+// the body itself: timestamp (int64 unix nanos), key length (uint16), key and
+// value. A torn frame at the tail of a partition is truncated on open.
+const (
+	frameHeaderSize = 8
+	bodyHeaderSize  = 10
+	maxKeySize      = 1<<16 - 1
+)
+
+var (
+	ErrClosed       = errors.New("stream log is closed")
+	ErrOffsetRange  = errors.New("offset out of range")
+	ErrKeyTooLarge  = errors.New("message key too large")
+	ErrReadOnly     = errors.New("stream log is open read-only")
+	errCorruptFrame = errors.New("corrupt record frame")
+)
+
+type Message struct {
+	Partition string    `json:"partition"`
+	Offset    int64     `json:"offset"`
+	Key       string    `json:"key"`
+	Value     []byte    `json:"value"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+type Options struct {
+	// SyncWrites fsyncs every append before acknowledging it.
+	SyncWrites bool
+	// ReadOnly opens existing partitions for reading only, for tools that
+	// read a log another process may still be appending to. Messages past
+	// the last complete frame at open are not visible, and a torn tail is
+	// left for the writer rather than truncated.
+	ReadOnly bool
+}
+
+type Log struct {
+	dir        string
+	options    Options
+	partitions map[string]*partition
+	groups     map[string]*Group
+	changed    chan struct{}
+	closed     bool
+	mu         sync.RWMutex
+}
+
+type partition struct {
+	name      string
+	file      *os.File
+	positions []int64
+	size      int64
+	broken    error
+	mu        sync.RWMutex
+}
+
+func Open(dir string, options Options) (*Log, error) {
+	if options.ReadOnly {
+		if _, err := os.Stat(filepath.Join(dir, "partitions")); err != nil {
+			return nil, fmt.Errorf("failed to open stream dir: %w", err)
+		}
+	} else {
+		for _, sub := range []string{"partitions", "groups"} {
+			if err := os.MkdirAll(filepath.Join(dir, sub), 0o755); err != nil {
+				return nil, fmt.Errorf("failed to create stream dir: %w", err)
+			}
+		}
+	}
+
+	l := &Log{
+		dir:        dir,
+		options:    options,
+		partitions: make(map[string]*partition),
+		groups:     make(map[string]*Group),
+		changed:    make(chan struct{}),
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "partitions", "*.log"))
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range files {
+		name, err := url.PathUnescape(strings.TrimSuffix(filepath.Base(file), ".log"))
+		if err != nil {
+			continue
+		}
+		p, err := openPartition(name, file, options.ReadOnly)
+		if err != nil {
+			l.Close()
+			return nil, err
+		}
+		l.partitions[name] = p
+	}
+	return l, nil
+}
+
+func openPartition(name, path string, readOnly bool) (*partition, error) {
+	flags := os.O_CREATE | os.O_RDWR | os.O_APPEND
+	if readOnly {
+		flags = os.O_RDONLY
+	}
+	file, err := os.OpenFile(path, flags, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open partition %s: %w", name, err)
+	}
+
+	p := &partition{name: name, file: file}
+	for {
+		length, err := p.frameLength(p.size)
+		if err != nil {
+			break
+		}
+		p.positions = append(p.positions, p.size)
+		p.size += frameHeaderSize + int64(length)
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	if info.Size() > p.size && !readOnly {
+		if err := file.Truncate(p.size); err != nil {
+			file.Close()
+			return nil, fmt.Errorf("failed to truncate torn tail of partition %s: %w", name, err)
+		}
+	}
+	return p, nil
+}
+
+// frameLength validates the frame starting at pos and returns its body length.
+func (p *partition) frameLength(pos int64) (uint32, error) {
+	header := make([]byte, frameHeaderSize)
+	if _, err := p.file.ReadAt(header, pos); err != nil {
+		return 0, err
+	}
+	length := binary.BigEndian.Uint32(header[0:4])
+	if length < bodyHeaderSize {
+		return 0, errCorruptFrame
+	}
+	body := make([]byte, length)
+	if _, err := p.file.ReadAt(body, pos+frameHeaderSize); err != nil {
+		return 0, err
+	}
+	if crc32.ChecksumIEEE(body) != binary.BigEndian.Uint32(header[4:8]) {
+		return 0, errCorruptFrame
+	}
+	return length, nil
+}
+
+func (l *Log) partition(name string, create bool) (*partition, error) {
+	l.mu.RLock()
+	p, exists := l.partitions[name]
+	closed := l.closed
+	l.mu.RUnlock()
+	if closed {
+		return nil, ErrClosed
+	}
+	if exists || !create {
+		return p, nil
+	}
+	if l.options.ReadOnly {
+		return nil, ErrReadOnly
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if p, exists := l.partitions[name]; exists {
+		return p, nil
+	}
+	p, err := openPartition(name, filepath.Join(l.dir, "partitions", url.PathEscape(name)+".log"), false)
+	if err != nil {
+		return nil, err
+	}
+	l.partitions[name] = p
+	return p, nil
+}
+
+// Append writes one message to the end of a partition and returns its offset.
+func (l *Log) Append(partitionName, key string, value []byte) (int64, error) {
+	if l.options.ReadOnly {
+		return 0, ErrReadOnly
+	}
+	if len(key) > maxKeySize {
+		return 0, ErrKeyTooLarge
+	}
+	p, err := l.partition(partitionName, true)
+	if err != nil {
+		return 0, err
+	}
+
+	body := make([]byte, bodyHeaderSize+len(key)+len(value))
+	binary.BigEndian.PutUint64(body[0:8], uint64(time.Now().UnixNano()))
+	binary.BigEndian.PutUint16(body[8:10], uint16(len(key)))
+	copy(body[bodyHeaderSize:], key)
+	copy(body[bodyHeaderSize+len(key):], value)
+
+	frame := make([]byte, frameHeaderSize+len(body))
+	binary.BigEndian.PutUint32(frame[0:4], uint32(len(body)))
+	binary.BigEndian.PutUint32(frame[4:8], crc32.ChecksumIEEE(body))
+	copy(frame[frameHeaderSize:], body)
+
+	p.mu.Lock()
+	if p.broken != nil {
+		p.mu.Unlock()
+		return 0, p.broken
+	}
+	if _, err := p.file.Write(frame); err != nil {
+		p.discardTail()
+		p.mu.Unlock()
+		return 0, fmt.Errorf("failed to append to partition %s: %w", partitionName, err)
+	}
+	if l.options.SyncWrites {
+		if err := p.file.Sync(); err != nil {
+			p.discardTail()
+			p.mu.Unlock()
+			return 0, err
+		}
+	}
+	offset := int64(len(p.positions))
+	p.positions = append(p.positions, p.size)
+	p.size += int64(len(frame))
+	p.mu.Unlock()
+
+	l.notify()
+	return offset, nil
+}
+
+// discardTail cuts off whatever a failed append left past the last complete
+// frame, so the next append starts at p.size and every offset keeps pointing
+// at its own frame. If that fails too, the partition refuses further appends,
+// which would otherwise land behind the torn frame; reopening it truncates
+// the tail.
+func (p *partition) discardTail() {
+	if err := p.file.Truncate(p.size); err != nil {
+		p.broken = fmt.Errorf("partition %s has a torn tail: %w", p.name, err)
+	}
+}
+
+func (l *Log) notify() {
+	l.mu.Lock()
+	if l.closed {
+		l.mu.Unlock()
+		return
+	}
+	close(l.changed)
+	l.changed = make(chan struct{})
+	l.mu.Unlock()
+}
+
+// Changed returns a channel that is closed on the next append to any
+// partition.
+func (l *Log) Changed() <-chan struct{} {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.changed
+}
+
+// Read returns up to max messages starting at offset. Reading at the end
+// offset returns no messages.
+func (l *Log) Read(partitionName string, offset int64, max int) ([]Message, error) {
+	p, err := l.partition(partitionName, false)
+	if err != nil {
+		return nil, err
+	}
+	if p == nil {
+		if offset == 0 {
+			return nil, nil
+		}
+		return nil, ErrOffsetRange
+	}
+
+	p.mu.RLock()
+	end := int64(len(p.positions))
+	if offset < 0 || offset > end {
+		p.mu.RUnlock()
+		return nil, fmt.Errorf("%w: %d not in [0, %d]", ErrOffsetRange, offset, end)
+	}
+	last := end
+	if max > 0 && offset+int64(max) < last {
+		last = offset + int64(max)
+	}
+	if last == offset {
+		p.mu.RUnlock()
+		return nil, nil
+	}
+	start := p.positions[offset]
+	stop := p.size
+	if last < end {
+		stop = p.positions[last]
+	}
+	p.mu.RUnlock()
+
+	data := make([]byte, stop-start)
+	if _, err := p.file.ReadAt(data, start); err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	messages := make([]Message, 0, last-offset)
+	for pos := 0; pos < len(data); {
+		length := int(binary.BigEndian.Uint32(data[pos : pos+4]))
+		body := data[pos+frameHeaderSize : pos+frameHeaderSize+length]
+		keyLen := int(binary.BigEndian.Uint16(body[8:10]))
+		messages = append(messages, Message{
+			Partition: partitionName,
+			Offset:    offset + int64(len(messages)),
+			Key:       string(body[bodyHeaderSize : bodyHeaderSize+keyLen]),
+			Value:     body[bodyHeaderSize+keyLen:],
+			Timestamp: time.Unix(0, int64(binary.BigEndian.Uint64(body[0:8]))),
+		})
+		pos += frameHeaderSize + length
+	}
+	return messages, nil
+}
+
+func (l *Log) EndOffset(partitionName string) int64 {
+	p, err := l.partition(partitionName, false)
+	if err != nil || p == nil {
+		return 0
+	}
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return int64(len(p.positions))
+}
+
+func (l *Log) Partitions() []string {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	names := make([]string, 0, len(l.partitions))
+	for name := range l.partitions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (l *Log) Stats() map[string]interface{} {
+	partitions := make(map[string]interface{})
+	for _, name := range l.Partitions() {
+		partitions[name] = l.EndOffset(name)
+	}
+
+	l.mu.RLock()
+	groupNames := make([]string, 0, len(l.groups))
+	for name := range l.groups {
+		groupNames = append(groupNames, name)
+	}
+	l.mu.RUnlock()
+
+	groups := make(map[string]interface{}, len(groupNames))
+	for _, name := range groupNames {
+		group, _ := l.Group(name)
+		lag := make(map[string]int64)
+		for _, partitionName := range l.Partitions() {
+			lag[partitionName] = l.EndOffset(partitionName) - group.Committed(partitionName)
+		}
+		groups[name] = map[string]interface{}{"lag": lag}
+	}
+
+	return map[string]interface{}{
+		"dir":           l.dir,
+		"end_offsets":   partitions,
+		"consumer_lags": groups,
+	}
+}
+
+func (l *Log) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		return nil
+	}
+	l.closed = true
+
+	var firstErr error
+	for _, p := range l.partitions {
+		p.mu.Lock()
+		if err := p.file.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+		p.mu.Unlock()
+	}
+	close(l.changed)
+	return firstErr
+}
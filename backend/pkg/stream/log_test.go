@@ -0,0 +1,197 @@
+package stream
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func openLog(t *testing.T, dir string) *Log {
+	t.Helper()
+	l, err := Open(dir, Options{})
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	return l
+}
+
+func appendN(t *testing.T, l *Log, partition string, from, n int) {
+	t.Helper()
+	for i := from; i < from+n; i++ {
+		offset, err := l.Append(partition, fmt.Sprintf("key-%d", i), []byte(fmt.Sprintf("value-%d", i)))
+		if err != nil {
+			t.Fatalf("Append %d: %v", i, err)
+		}
+		if offset != int64(i) {
+			t.Fatalf("Append %d returned offset %d", i, offset)
+		}
+	}
+}
+
+func checkMessages(t *testing.T, messages []Message, partition string, from int) {
+	t.Helper()
+	for i, message := range messages {
+		want := from + i
+		if message.Partition != partition || message.Offset != int64(want) {
+			t.Fatalf("message %d is %s@%d, want %s@%d", i, message.Partition, message.Offset, partition, want)
+		}
+		if message.Key != fmt.Sprintf("key-%d", want) || string(message.Value) != fmt.Sprintf("value-%d", want) {
+			t.Fatalf("message %d is %q=%q", want, message.Key, message.Value)
+		}
+	}
+}
+
+func TestAppendAndReadAcrossReopen(t *testing.T) {
+	dir := t.TempDir()
+	l := openLog(t, dir)
+	appendN(t, l, "bangalore", 0, 10)
+	appendN(t, l, "mumbai", 0, 3)
+	if err := l.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	l = openLog(t, dir)
+	defer l.Close()
+	if got := l.Partitions(); len(got) != 2 || got[0] != "bangalore" || got[1] != "mumbai" {
+		t.Fatalf("Partitions = %v", got)
+	}
+	if end := l.EndOffset("bangalore"); end != 10 {
+		t.Fatalf("EndOffset = %d, want 10", end)
+	}
+
+	appendN(t, l, "bangalore", 10, 5)
+	messages, err := l.Read("bangalore", 0, 0)
+	if err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	if len(messages) != 15 {
+		t.Fatalf("read %d messages, want 15", len(messages))
+	}
+	checkMessages(t, messages, "bangalore", 0)
+
+	messages, err = l.Read("bangalore", 8, 4)
+	if err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	if len(messages) != 4 {
+		t.Fatalf("read %d messages, want 4", len(messages))
+	}
+	checkMessages(t, messages, "bangalore", 8)
+
+	if messages, err := l.Read("bangalore", 15, 10); err != nil || len(messages) != 0 {
+		t.Fatalf("Read at end = %d messages, %v", len(messages), err)
+	}
+	if _, err := l.Read("bangalore", 16, 10); err == nil {
+		t.Fatal("Read past end succeeded")
+	}
+}
+
+func TestTornTailIsTruncatedOnOpen(t *testing.T) {
+	dir := t.TempDir()
+	l := openLog(t, dir)
+	appendN(t, l, "delhi", 0, 5)
+	l.Close()
+
+	path := filepath.Join(dir, "partitions", "delhi.log")
+	intact, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A frame header promising more body than was written.
+	file.Write([]byte{0, 0, 0, 64, 1, 2, 3, 4, 'p', 'a', 'r', 't'})
+	file.Close()
+
+	l = openLog(t, dir)
+	defer l.Close()
+	if end := l.EndOffset("delhi"); end != 5 {
+		t.Fatalf("EndOffset = %d, want 5", end)
+	}
+	if info, _ := os.Stat(path); info.Size() != intact.Size() {
+		t.Fatalf("size after open = %d, want %d", info.Size(), intact.Size())
+	}
+
+	appendN(t, l, "delhi", 5, 2)
+	messages, err := l.Read("delhi", 0, 0)
+	if err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	if len(messages) != 7 {
+		t.Fatalf("read %d messages, want 7", len(messages))
+	}
+	checkMessages(t, messages, "delhi", 0)
+}
+
+func TestAppendAfterFailedWriteKeepsOffsets(t *testing.T) {
+	l := openLog(t, t.TempDir())
+	defer l.Close()
+	appendN(t, l, "chennai", 0, 3)
+
+	// Simulate a write that stopped partway through a frame.
+	p, _ := l.partition("chennai", false)
+	p.mu.Lock()
+	p.file.Write([]byte{0, 0, 0, 32, 9, 9})
+	p.discardTail()
+	p.mu.Unlock()
+
+	appendN(t, l, "chennai", 3, 2)
+	messages, err := l.Read("chennai", 0, 0)
+	if err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	if len(messages) != 5 {
+		t.Fatalf("read %d messages, want 5", len(messages))
+	}
+	checkMessages(t, messages, "chennai", 0)
+}
+
+func TestReadOnlyLeavesLiveLogUntouched(t *testing.T) {
+	dir := t.TempDir()
+	writer := openLog(t, dir)
+	defer writer.Close()
+	appendN(t, writer, "mumbai", 0, 4)
+
+	// A frame the writer has only partly written so far.
+	path := filepath.Join(dir, "partitions", "mumbai.log")
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.Write([]byte{0, 0, 0, 64, 1, 2})
+	file.Close()
+	before, _ := os.Stat(path)
+
+	reader, err := Open(dir, Options{ReadOnly: true})
+	if err != nil {
+		t.Fatalf("Open read-only: %v", err)
+	}
+	defer reader.Close()
+	if end := reader.EndOffset("mumbai"); end != 4 {
+		t.Fatalf("EndOffset = %d, want 4", end)
+	}
+	messages, err := reader.Read("mumbai", 0, 0)
+	if err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	if len(messages) != 4 {
+		t.Fatalf("read %d messages, want 4", len(messages))
+	}
+	checkMessages(t, messages, "mumbai", 0)
+
+	if after, _ := os.Stat(path); after.Size() != before.Size() {
+		t.Fatalf("read-only open changed the partition from %d to %d bytes", before.Size(), after.Size())
+	}
+	if _, err := reader.Append("mumbai", "k", nil); err != ErrReadOnly {
+		t.Fatalf("Append on read-only log = %v, want ErrReadOnly", err)
+	}
+	if _, err := reader.Append("pune", "k", nil); err != ErrReadOnly {
+		t.Fatalf("Append to new partition on read-only log = %v, want ErrReadOnly", err)
+	}
+	if _, err := Open(filepath.Join(dir, "missing"), Options{ReadOnly: true}); err == nil {
+		t.Fatal("read-only Open of a missing dir succeeded")
+	}
+}
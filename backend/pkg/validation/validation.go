@@ -0,0 +1,150 @@
+package validation
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+	"time"
+	"uber-system/pkg/models"
+)
+
+const (
+	CodeRequired   = "required"
+	CodeOutOfRange = "out_of_range"
+	CodeInvalid    = "invalid"
+	CodeNullIsland = "null_island"
+	CodeUnknown    = "unknown_value"
+	CodeDuplicate  = "duplicate"
+
+	// NullIslandToleranceDeg is how close to (0, 0) a fix may be before it
+	// is treated as an uninitialised GPS reading.
+	NullIslandToleranceDeg = 1e-6
+	MaxRating              = 5.0
+	// MaxClockSkew bounds how far ahead a device timestamp may run; a fast
+	// clock would otherwise mark every later update from the driver stale.
+	MaxClockSkew = 5 * time.Minute
+)
+
+// KnownCarTypes lists the fleet's car types. Deployments with other types
+// replace it at startup (CAR_TYPES) before any driver registers.
+var KnownCarTypes = []string{"auto", "bike", "mini", "premium", "sedan", "suv", "xl"}
+
+// ParseCarTypes reads a comma-separated CAR_TYPES value into normalised car
+// types, skipping empty entries and repeats.
+func ParseCarTypes(value string) []string {
+	carTypes := make([]string, 0)
+	for _, carType := range strings.Split(value, ",") {
+		carType = NormalizeCarType(carType)
+		if carType != "" && !slices.Contains(carTypes, carType) {
+			carTypes = append(carTypes, carType)
+		}
+	}
+	return carTypes
+}
+
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e FieldError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Field, e.Message)
+}
+
+// Errors collects every field problem in a request so clients can fix them
+// in one round trip.
+type Errors []FieldError
+
+func (e Errors) Error() string {
+	messages := make([]string, len(e))
+	for i, fieldErr := range e {
+		messages[i] = fieldErr.Error()
+	}
+	return "validation failed: " + strings.Join(messages, "; ")
+}
+
+func (e *Errors) Add(field, code, message string) {
+	*e = append(*e, FieldError{Field: field, Code: code, Message: message})
+}
+
+// Err returns nil when no problems were recorded so callers can return it
+// directly.
+func (e Errors) Err() error {
+	if len(e) == 0 {
+		return nil
+	}
+	return e
+}
+
+func NormalizeID(id string) string {
+	return strings.TrimSpace(id)
+}
+
+func NormalizeCarType(carType string) string {
+	return strings.ToLower(strings.TrimSpace(carType))
+}
+
+func CheckID(errs *Errors, field, id string) {
+	if id == "" {
+		errs.Add(field, CodeRequired, "must not be empty")
+	}
+}
+
+func CheckCoordinates(errs *Errors, prefix string, lat, lng float64) {
+	latField, lngField := prefix+"lat", prefix+"lng"
+	valid := true
+	if math.IsNaN(lat) || math.IsInf(lat, 0) || lat < -90 || lat > 90 {
+		errs.Add(latField, CodeOutOfRange, "must be between -90 and 90")
+		valid = false
+	}
+	if math.IsNaN(lng) || math.IsInf(lng, 0) || lng < -180 || lng > 180 {
+		errs.Add(lngField, CodeOutOfRange, "must be between -180 and 180")
+		valid = false
+	}
+	if valid && math.Abs(lat) < NullIslandToleranceDeg && math.Abs(lng) < NullIslandToleranceDeg {
+		errs.Add(latField, CodeNullIsland, "(0, 0) is not a valid location fix")
+	}
+}
+
+func CheckCarType(errs *Errors, field, carType string) {
+	if carType == "" {
+		return
+	}
+	for _, known := range KnownCarTypes {
+		if carType == known {
+			return
+		}
+	}
+	errs.Add(field, CodeUnknown, fmt.Sprintf("must be one of %s", strings.Join(KnownCarTypes, ", ")))
+}
+
+// Driver normalises a driver registration in place and reports every field
+// that cannot be accepted.
+func Driver(driver *models.Driver) error {
+	driver.ID = NormalizeID(driver.ID)
+	driver.CarType = NormalizeCarType(driver.CarType)
+
+	var errs Errors
+	CheckID(&errs, "id", driver.ID)
+	CheckCoordinates(&errs, "location.", driver.Location.Lat, driver.Location.Lng)
+	CheckCarType(&errs, "car_type", driver.CarType)
+	if math.IsNaN(driver.Rating) || driver.Rating < 0 || driver.Rating > MaxRating {
+		errs.Add("rating", CodeOutOfRange, fmt.Sprintf("must be between 0 and %.0f", MaxRating))
+	}
+	if driver.Status != "" && !driver.Status.IsValid() {
+		errs.Add("status", CodeInvalid, fmt.Sprintf("unknown driver status %q", driver.Status))
+	}
+	return errs.Err()
+}
+
+func LocationUpdate(req models.UpdateLocationRequest, now time.Time) error {
+	var errs Errors
+	CheckID(&errs, "driver_id", NormalizeID(req.DriverID))
+	CheckCoordinates(&errs, "", req.Lat, req.Lng)
+	if req.Timestamp.After(now.Add(MaxClockSkew)) {
+		errs.Add("timestamp", CodeOutOfRange, fmt.Sprintf("must not be more than %v ahead of server time", MaxClockSkew))
+	}
+	return errs.Err()
+}
@@ -0,0 +1,155 @@
+package validation
+
+import (
+	"errors"
+	"math"
+	"slices"
+	"testing"
+	"time"
+	"uber-system/pkg/models"
+)
+
+func fields(err error) []string {
+	var errs Errors
+	if !errors.As(err, &errs) {
+		return nil
+	}
+	names := make([]string, len(errs))
+	for i, fieldErr := range errs {
+		names[i] = fieldErr.Field + ":" + fieldErr.Code
+	}
+	return names
+}
+
+func TestNormalize(t *testing.T) {
+	ids := map[string]string{
+		"driver-1":       "driver-1",
+		"  driver-1\t\n": "driver-1",
+		"Driver-1":       "Driver-1",
+		"   ":            "",
+	}
+	for in, want := range ids {
+		if got := NormalizeID(in); got != want {
+			t.Errorf("NormalizeID(%q) = %q, want %q", in, got, want)
+		}
+	}
+	if got := NormalizeCarType(" SUV "); got != "suv" {
+		t.Errorf("NormalizeCarType = %q, want suv", got)
+	}
+}
+
+func TestCheckCoordinates(t *testing.T) {
+	tests := []struct {
+		name     string
+		lat, lng float64
+		want     []string
+	}{
+		{"valid", 12.97, 77.59, nil},
+		{"poles and antimeridian", -90, 180, nil},
+		{"other corner", 90, -180, nil},
+		{"lat too high", 90.0001, 10, []string{"lat:out_of_range"}},
+		{"lng too low", 10, -180.0001, []string{"lng:out_of_range"}},
+		{"both out of range", -91, 181, []string{"lat:out_of_range", "lng:out_of_range"}},
+		{"nan", math.NaN(), 10, []string{"lat:out_of_range"}},
+		{"infinite", 10, math.Inf(1), []string{"lng:out_of_range"}},
+		{"null island", 0, 0, []string{"lat:null_island"}},
+		{"near null island", 1e-7, -1e-7, []string{"lat:null_island"}},
+		{"on the equator", 0, 0.001, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var errs Errors
+			CheckCoordinates(&errs, "", tt.lat, tt.lng)
+			if got := fields(errs.Err()); !slices.Equal(got, tt.want) {
+				t.Fatalf("errors = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	var errs Errors
+	CheckCoordinates(&errs, "pickup.", 95, 0)
+	if got := fields(errs.Err()); !slices.Equal(got, []string{"pickup.lat:out_of_range"}) {
+		t.Fatalf("prefixed errors = %v", got)
+	}
+}
+
+func TestDriver(t *testing.T) {
+	driver := &models.Driver{
+		ID:       "  driver-1 ",
+		CarType:  " Sedan",
+		Location: models.Location{Lat: 12.97, Lng: 77.59},
+		Rating:   4.8,
+	}
+	if err := Driver(driver); err != nil {
+		t.Fatalf("Driver: %v", err)
+	}
+	if driver.ID != "driver-1" || driver.CarType != "sedan" {
+		t.Fatalf("normalised to %q, %q", driver.ID, driver.CarType)
+	}
+
+	bad := &models.Driver{
+		ID:       " ",
+		CarType:  "hovercraft",
+		Location: models.Location{Lat: 100, Lng: 77.59},
+		Rating:   5.5,
+		Status:   "Available",
+	}
+	want := []string{"id:required", "location.lat:out_of_range", "car_type:unknown_value", "rating:out_of_range", "status:invalid"}
+	if got := fields(Driver(bad)); !slices.Equal(got, want) {
+		t.Fatalf("errors = %v, want %v", got, want)
+	}
+}
+
+func TestLocationUpdate(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name string
+		req  models.UpdateLocationRequest
+		want []string
+	}{
+		{"valid", models.UpdateLocationRequest{DriverID: "driver-1", Lat: 12.97, Lng: 77.59}, nil},
+		{"blank id", models.UpdateLocationRequest{DriverID: " \t", Lat: 12.97, Lng: 77.59}, []string{"driver_id:required"}},
+		{"within skew", models.UpdateLocationRequest{DriverID: "driver-1", Lat: 12.97, Lng: 77.59, Timestamp: now.Add(MaxClockSkew)}, nil},
+		{"past skew", models.UpdateLocationRequest{DriverID: "driver-1", Lat: 12.97, Lng: 77.59, Timestamp: now.Add(MaxClockSkew + time.Second)}, []string{"timestamp:out_of_range"}},
+		{"old timestamp", models.UpdateLocationRequest{DriverID: "driver-1", Lat: 12.97, Lng: 77.59, Timestamp: now.Add(-time.Hour)}, nil},
+		{"null island", models.UpdateLocationRequest{DriverID: "driver-1"}, []string{"lat:null_island"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := fields(LocationUpdate(tt.req, now)); !slices.Equal(got, tt.want) {
+				t.Fatalf("errors = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCarTypesOverride(t *testing.T) {
+	defaults := KnownCarTypes
+	t.Cleanup(func() { KnownCarTypes = defaults })
+
+	if got, want := ParseCarTypes(" Tuk-Tuk, sedan,,SEDAN , cab "), []string{"tuk-tuk", "sedan", "cab"}; !slices.Equal(got, want) {
+		t.Fatalf("ParseCarTypes = %v, want %v", got, want)
+	}
+	if got := ParseCarTypes(" , "); len(got) != 0 {
+		t.Fatalf("ParseCarTypes of blanks = %v, want none", got)
+	}
+
+	KnownCarTypes = ParseCarTypes("tuk-tuk,cab")
+	tests := []struct {
+		carType string
+		valid   bool
+	}{
+		{"", true},
+		{"tuk-tuk", true},
+		{"cab", true},
+		{"sedan", false},
+		{"Cab", false},
+	}
+	for _, tt := range tests {
+		var errs Errors
+		CheckCarType(&errs, "car_type", tt.carType)
+		if valid := errs.Err() == nil; valid != tt.valid {
+			t.Errorf("CheckCarType(%q) valid = %v, want %v", tt.carType, valid, tt.valid)
+		}
+	}
+}